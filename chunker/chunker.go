@@ -0,0 +1,122 @@
+package chunker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Content Defined Chunking (Gear Rolling Hash, FastCDC style Normalized Chunking)
+// Boundaries depend only on Content, so an Edit only changes the Chunks around it
+const (
+	CHUNK_MIN_SIZE = 16 * 1024
+	CHUNK_AVG_SIZE = 64 * 1024
+	CHUNK_MAX_SIZE = 256 * 1024
+
+	// Stricter Mask before Avg Size & Looser after it, keeps Chunk Sizes close to Avg
+	// Upper Bits're used as they depend on more of the Recent Bytes
+	MASK_S uint64 = 0x3FFFF << 46 // 18 Bits
+	MASK_L uint64 = 0x3FFF << 50  // 14 Bits
+)
+
+// Must never Change, else Chunks of older Stores won't Match
+const GEAR_SEED uint64 = 0x504B722D43444321 // "PKr-CDC!"
+
+var GEAR [256]uint64
+
+func init() {
+	// SplitMix64
+	state := GEAR_SEED
+	for i := range GEAR {
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		GEAR[i] = z ^ (z >> 31)
+	}
+}
+
+// Returns Length of the next Chunk in 'data'
+func nextCut(data []byte) int {
+	n := len(data)
+	if n <= CHUNK_MIN_SIZE {
+		return n
+	}
+	n = min(n, CHUNK_MAX_SIZE)
+	normal := min(n, CHUNK_AVG_SIZE)
+
+	var fp uint64
+	i := CHUNK_MIN_SIZE
+	for ; i < normal; i++ {
+		fp = (fp << 1) + GEAR[data[i]]
+		if fp&MASK_S == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + GEAR[data[i]]
+		if fp&MASK_L == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Calls 'fn' for every Chunk of 'reader', 'chunk' is only Valid till 'fn' Returns
+func Split(reader io.Reader, fn func(chunk []byte) error) error {
+	buffer := make([]byte, CHUNK_MAX_SIZE)
+	filled := 0
+	is_eof := false
+
+	for {
+		if !is_eof {
+			n, err := io.ReadFull(reader, buffer[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				is_eof = true
+			} else if err != nil {
+				fmt.Println("Error while Reading Data to Chunk:", err)
+				fmt.Println("Source: Split()")
+				return err
+			}
+		}
+		if filled == 0 {
+			return nil
+		}
+
+		cut := nextCut(buffer[:filled])
+		if err := fn(buffer[:cut]); err != nil {
+			return err
+		}
+		filled = copy(buffer, buffer[cut:filled])
+	}
+}
+
+func HashChunk(chunk []byte) string {
+	hash := sha256.Sum256(chunk)
+	return hex.EncodeToString(hash[:])
+}
+
+// Splits 'reader' into Chunks, Stores the ones not already in 'store' & Returns Chunk List
+func ChunkAndStore(store *Store, reader io.Reader) ([]models.FileChunk, error) {
+	file_chunks := []models.FileChunk{}
+	err := Split(reader, func(chunk []byte) error {
+		hash := HashChunk(chunk)
+		if !store.Has(hash) {
+			if err := store.Put(hash, chunk); err != nil {
+				return err
+			}
+		}
+		file_chunks = append(file_chunks, models.FileChunk{Hash: hash, Size: int64(len(chunk))})
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error while Chunking Data:", err)
+		fmt.Println("Source: ChunkAndStore()")
+		return nil, err
+	}
+	return file_chunks, nil
+}
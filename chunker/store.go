@@ -0,0 +1,207 @@
+package chunker
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+var ErrCorruptChunk = errors.New("chunk doesn't match its hash")
+
+// Chunks're Stored at WORKSPACE_PATH/.PKr/Chunks/<First 2 Chars of Hash>/<Hash>
+type Store struct {
+	root string
+}
+
+func GetStorePath(workspace_path string) string {
+	return filepath.Join(workspace_path, ".PKr", "Chunks")
+}
+
+func NewStore(workspace_path string) *Store {
+	return &Store{root: GetStorePath(workspace_path)}
+}
+
+func isValidHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) chunkPath(hash string) string {
+	return filepath.Join(s.root, hash[:2], hash)
+}
+
+func (s *Store) Has(hash string) bool {
+	if !isValidHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.chunkPath(hash))
+	return err == nil
+}
+
+// Written to a Temp File first, so a Crash never leaves a Partial Chunk behind
+func (s *Store) Put(hash string, chunk []byte) error {
+	if !isValidHash(hash) || HashChunk(chunk) != hash {
+		return ErrCorruptChunk
+	}
+
+	chunk_path := s.chunkPath(hash)
+	if err := os.MkdirAll(filepath.Dir(chunk_path), 0700); err != nil {
+		fmt.Println("Error while Creating Chunk Dir:", err)
+		fmt.Println("Source: Put()")
+		return err
+	}
+
+	tmp_path := chunk_path + ".tmp"
+	if err := os.WriteFile(tmp_path, chunk, 0600); err != nil {
+		fmt.Println("Error while Writing Chunk:", err)
+		fmt.Println("Source: Put()")
+		return err
+	}
+	return os.Rename(tmp_path, chunk_path)
+}
+
+func (s *Store) Get(hash string) ([]byte, error) {
+	if !isValidHash(hash) {
+		return nil, ErrCorruptChunk
+	}
+
+	chunk, err := os.ReadFile(s.chunkPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if HashChunk(chunk) != hash {
+		return nil, ErrCorruptChunk
+	}
+	return chunk, nil
+}
+
+// Chunk Lists of Files my Workspace is at, Chunks in it're kept across Pulls
+func (s *Store) indexPath() string {
+	return filepath.Join(s.root, "index.json")
+}
+
+// Missing Index is Empty
+func (s *Store) ReadIndex() (map[string][]models.FileChunk, error) {
+	data, err := os.ReadFile(s.indexPath())
+	if os.IsNotExist(err) {
+		return map[string][]models.FileChunk{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index map[string][]models.FileChunk
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	if index == nil {
+		index = map[string][]models.FileChunk{}
+	}
+	return index, nil
+}
+
+func (s *Store) WriteIndex(index map[string][]models.FileChunk) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		fmt.Println("Error while Encoding Chunk Index:", err)
+		fmt.Println("Source: WriteIndex()")
+		return err
+	}
+
+	if err = os.MkdirAll(s.root, 0700); err != nil {
+		fmt.Println("Error while Creating Chunk Store Dir:", err)
+		fmt.Println("Source: WriteIndex()")
+		return err
+	}
+
+	tmp_path := s.indexPath() + ".tmp"
+	if err = os.WriteFile(tmp_path, data, 0600); err != nil {
+		fmt.Println("Error while Writing Chunk Index:", err)
+		fmt.Println("Source: WriteIndex()")
+		return err
+	}
+	return os.Rename(tmp_path, s.indexPath())
+}
+
+// Removes every Chunk not in 'keep'
+func (s *Store) Prune(keep map[string]bool) error {
+	dirs, err := os.ReadDir(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		dir_path := filepath.Join(s.root, dir.Name())
+		entries, err := os.ReadDir(dir_path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if keep[entry.Name()] {
+				continue
+			}
+			if err = os.Remove(filepath.Join(dir_path, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Writes Chunks in Order into 'dst_path'
+func (s *Store) Assemble(file_chunks []models.FileChunk, dst_path string) error {
+	if err := os.MkdirAll(filepath.Dir(dst_path), 0700); err != nil {
+		fmt.Println("Error while Creating Dir for Assembled File:", err)
+		fmt.Println("Source: Assemble()")
+		return err
+	}
+
+	dst_file, err := os.Create(dst_path)
+	if err != nil {
+		fmt.Println("Error while Creating Assembled File:", err)
+		fmt.Println("Source: Assemble()")
+		return err
+	}
+	defer dst_file.Close()
+
+	writer := bufio.NewWriter(dst_file)
+	for _, file_chunk := range file_chunks {
+		chunk, err := s.Get(file_chunk.Hash)
+		if err != nil {
+			fmt.Println("Error while Getting Chunk from Store:", err)
+			fmt.Println("Source: Assemble()")
+			return err
+		}
+		if _, err = writer.Write(chunk); err != nil {
+			fmt.Println("Error while Writing Chunk into Assembled File:", err)
+			fmt.Println("Source: Assemble()")
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		fmt.Println("Error while Flushing Assembled File:", err)
+		fmt.Println("Source: Assemble()")
+		return err
+	}
+	return dst_file.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"sync"
 
 	"github.com/PKr-Parivar/PKr-Base/encrypt"
@@ -13,6 +14,9 @@ import (
 
 var TREE_REL_PATH = filepath.Join(".PKr", "file-tree.json")
 
+// Trees of Pushes Pulled into a Listener's Workspace, Stored by Push Num, see filetracker.ApplyUpdatesToWorkspace()
+var PUSH_TREES_REL_PATH = filepath.Join(".PKr", "Trees")
+
 type FileTree struct {
 	Nodes []Node
 }
@@ -53,25 +57,37 @@ func CreateFileTreeIfNotExits(workspace_path string) error {
 func FetchAllFilesPaths(folder_path string) ([]FilePath, error) {
 	files := []FilePath{}
 
-	err := filepath.Walk(folder_path, func(path string, info os.FileInfo, err error) error {
+	matcher, err := LoadIgnoreMatcher(folder_path)
+	if err != nil {
+		fmt.Println("Error while Loading Ignore Patterns:", err)
+		fmt.Println("Source: FetchAllFilesPaths()")
+		return []FilePath{}, err
+	}
+
+	err = filepath.Walk(folder_path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err // skip files we can't read
 		}
 
-		if info.IsDir() && (info.Name() == ".PKr" || info.Name() == "tmp") {
-			return filepath.SkipDir
+		relPath, err := filepath.Rel(folder_path, path)
+		if err != nil {
+			fmt.Println("Error while Getting Relative Path:", err)
+			fmt.Println("Source: FetchAllFilesPaths()")
+			return err
+		}
+
+		if matcher.Match(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		} else if !info.IsDir() {
-			if info.Name() == "PKr-Base.exe" || info.Name() == "PKr-Cli.exe" || info.Name() == "PKr-Base" || info.Name() == "PKr-Cli" {
+			// Walk doesn't Follow Symlinks, so 'info' is of the Entry itself
+			// Opening a FIFO would Block & Sockets or Symlinks to Dirs can't be Read, so only Regular Files're Shared
+			if !info.Mode().IsRegular() {
+				fmt.Println("Skipping File which isn't a Regular File:", relPath)
 				return nil
 			}
-
-			relPath, err := filepath.Rel(folder_path, path)
-			if err != nil {
-				fmt.Println("Error while Getting Relative Path:", err)
-				fmt.Println("Source: FetchAllFilesPaths()")
-				return err
-			}
-
 			files = append(files, FilePath{
 				FilePath:    path,
 				RelFilePath: relPath,
@@ -234,3 +250,63 @@ func CompareTrees(oldTree, newTree FileTree) []FileChange {
 	}
 	return changes
 }
+
+func getPushTreePath(workspace_path string, push_num int) string {
+	return filepath.Join(workspace_path, PUSH_TREES_REL_PATH, strconv.Itoa(push_num)+".json")
+}
+
+// Hashes of Files as they were Pulled at 'push_num'
+func ReadPushTree(workspace_path string, push_num int) (FileTree, error) {
+	tree_bytes, err := os.ReadFile(getPushTreePath(workspace_path, push_num))
+	if err != nil {
+		return FileTree{}, err
+	}
+
+	var file_tree FileTree
+	if err = json.Unmarshal(tree_bytes, &file_tree); err != nil {
+		fmt.Println("Error while Unmarshalling Push Tree:", err)
+		fmt.Println("Source: ReadPushTree()")
+		return FileTree{}, err
+	}
+	return file_tree, nil
+}
+
+// Written to a Temp File first, so a Crash never leaves a Half Written Tree
+func WritePushTree(workspace_path string, push_num int, file_tree FileTree) error {
+	if err := os.MkdirAll(filepath.Join(workspace_path, PUSH_TREES_REL_PATH), 0700); err != nil {
+		fmt.Println("Error while Creating .PKr/Trees Directory:", err)
+		fmt.Println("Source: WritePushTree()")
+		return err
+	}
+
+	tree_bytes, err := json.MarshalIndent(file_tree, "", "	")
+	if err != nil {
+		fmt.Println("Error while Marshalling Push Tree:", err)
+		fmt.Println("Source: WritePushTree()")
+		return err
+	}
+
+	tree_path := getPushTreePath(workspace_path, push_num)
+	tmp_path := tree_path + ".tmp"
+	if err = os.WriteFile(tmp_path, tree_bytes, 0600); err != nil {
+		fmt.Println("Error while Writing Push Tree:", err)
+		fmt.Println("Source: WritePushTree()")
+		return err
+	}
+	if err = os.Rename(tmp_path, tree_path); err != nil {
+		fmt.Println("Error while Renaming Push Tree:", err)
+		fmt.Println("Source: WritePushTree()")
+		os.Remove(tmp_path)
+		return err
+	}
+	return nil
+}
+
+// Trees of Pushes older than the one Workspace is at aren't Needed anymore
+func RemovePushTree(workspace_path string, push_num int) error {
+	err := os.Remove(getPushTreePath(workspace_path, push_num))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Manifest of the Push a Listener's Workspace is at, Served to other Listeners along with Files
+var MANIFEST_REL_PATH = filepath.Join(".PKr", "manifest.json")
+
+// Manifests of my Pushes, Stored by Push Num, so every Listener gets the same Signed Manifest of a Push
+var PUSH_MANIFESTS_REL_PATH = filepath.Join(".PKr", "Manifests")
+
+var ErrInvalidManifest = errors.New("push manifest isn't signed by workspace owner")
+
+// Manifest is Built from the File Tree of Latest Push & Signed with My Private Key
+func NewSignedPushManifest(workspace_path, workspace_owner string, workspace_conf PKRConfig) (models.SignedPushManifest, error) {
+	file_tree, err := ReadFromTreeFile(workspace_path)
+	if err != nil {
+		fmt.Println("Error while Reading File Tree:", err)
+		fmt.Println("Source: NewSignedPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	manifest := models.PushManifest{
+		WorkspaceName:  workspace_conf.WorkspaceName,
+		WorkspaceOwner: workspace_owner,
+		PushNum:        workspace_conf.LastPushNum,
+		Files:          []models.ManifestFile{},
+	}
+	if workspace_conf.LastPushNum >= 0 && workspace_conf.LastPushNum < len(workspace_conf.AllUpdates) {
+		manifest.PushDesc = workspace_conf.AllUpdates[workspace_conf.LastPushNum].PushDesc
+	}
+	listeners, err := GetListenersOfSendWorkspace(workspace_conf.WorkspaceName)
+	if err != nil {
+		fmt.Println("Error while Getting Listeners of Workspace:", err)
+		fmt.Println("Source: NewSignedPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+	manifest.Listeners = []string{}
+	for _, listener := range listeners {
+		if !listener.Revoked {
+			manifest.Listeners = append(manifest.Listeners, listener.Username)
+		}
+	}
+
+	for _, node := range file_tree.Nodes {
+		if node.FilePath == "" {
+			continue
+		}
+		manifest.Files = append(manifest.Files, models.ManifestFile{FilePath: node.FilePath, Hash: node.Hash})
+	}
+
+	zip_path := filepath.Join(workspace_path, ".PKr", "Files", "Current", strconv.Itoa(workspace_conf.LastPushNum)+".zip")
+	manifest.ArchiveHash, err = encrypt.GenerateHashFromFileNames_BufferedAndPooled(zip_path)
+	if err != nil {
+		fmt.Println("Error while Generating Hash of Zip of Push:", err)
+		fmt.Println("Source: NewSignedPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	manifest_bytes, err := json.Marshal(manifest)
+	if err != nil {
+		fmt.Println("Error while Marshalling Push Manifest:", err)
+		fmt.Println("Source: NewSignedPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	signature, err := encrypt.RSASignData(manifest_bytes)
+	if err != nil {
+		fmt.Println("Error while Signing Push Manifest:", err)
+		fmt.Println("Source: NewSignedPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	return models.SignedPushManifest{
+		Manifest:  manifest_bytes,
+		Signature: signature,
+	}, nil
+}
+
+// Called once a Push is Done, Manifest of the Push is Signed & Stored in .PKr/Manifests/<Push Num>.json
+func StorePushManifest(workspace_path, workspace_owner string, workspace_conf PKRConfig) (models.SignedPushManifest, error) {
+	signed_manifest, err := NewSignedPushManifest(workspace_path, workspace_owner, workspace_conf)
+	if err != nil {
+		fmt.Println("Error while Creating Signed Push Manifest:", err)
+		fmt.Println("Source: StorePushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	manifests_path := filepath.Join(workspace_path, PUSH_MANIFESTS_REL_PATH)
+	if err = os.MkdirAll(manifests_path, 0700); err != nil {
+		fmt.Println("Error while Creating .PKr/Manifests Directory:", err)
+		fmt.Println("Source: StorePushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	manifest_bytes, err := json.MarshalIndent(signed_manifest, "", "	")
+	if err != nil {
+		fmt.Println("Error while Marshalling Push Manifest:", err)
+		fmt.Println("Source: StorePushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	// Written to a Temp File first, so a Listener never Reads a Half Written Manifest
+	manifest_path := filepath.Join(manifests_path, strconv.Itoa(workspace_conf.LastPushNum)+".json")
+	tmp_path := manifest_path + ".tmp"
+	if err = os.WriteFile(tmp_path, manifest_bytes, 0600); err != nil {
+		fmt.Println("Error while Writing Push Manifest:", err)
+		fmt.Println("Source: StorePushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+	if err = os.Rename(tmp_path, manifest_path); err != nil {
+		fmt.Println("Error while Renaming Push Manifest:", err)
+		fmt.Println("Source: StorePushManifest()")
+		os.Remove(tmp_path)
+		return models.SignedPushManifest{}, err
+	}
+	return signed_manifest, nil
+}
+
+// Manifest of Latest Push is Signed again with Listeners as they're now, see models.PushManifest.Listeners
+// Called once Listeners Change, so Peers stop Serving Revoked ones from the next Pull they make from me
+func RefreshPushManifest(workspace_name, workspace_owner string) error {
+	workspace_path, err := GetSendWorkspaceFilePath(workspace_name)
+	if err != nil {
+		fmt.Println("Error while Fetching File Path of 'Send Workspace':", err)
+		fmt.Println("Source: RefreshPushManifest()")
+		return err
+	}
+
+	workspace_conf, err := ReadFromWorkspaceConfigFile(filepath.Join(workspace_path, WORKSPACE_CONFIG_FILE_PATH))
+	if err != nil {
+		fmt.Println("Error while Reading from workspace-config:", err)
+		fmt.Println("Source: RefreshPushManifest()")
+		return err
+	}
+	// Nothing is Pushed yet
+	if workspace_conf.LastPushNum < 0 {
+		return nil
+	}
+
+	if _, err = StorePushManifest(workspace_path, workspace_owner, workspace_conf); err != nil {
+		fmt.Println("Error while Storing Push Manifest:", err)
+		fmt.Println("Source: RefreshPushManifest()")
+		return err
+	}
+	return nil
+}
+
+// Stored Manifest of Latest Push, see UpdateLastPushNum()
+// Pushes made without one (by Older PKr) get it now
+func GetPushManifest(workspace_path, workspace_owner string, workspace_conf PKRConfig) (models.SignedPushManifest, error) {
+	manifest_path := filepath.Join(workspace_path, PUSH_MANIFESTS_REL_PATH, strconv.Itoa(workspace_conf.LastPushNum)+".json")
+	manifest_bytes, err := os.ReadFile(manifest_path)
+	if errors.Is(err, os.ErrNotExist) {
+		return StorePushManifest(workspace_path, workspace_owner, workspace_conf)
+	}
+	if err != nil {
+		fmt.Println("Error while Reading Push Manifest:", err)
+		fmt.Println("Source: GetPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+
+	var signed_manifest models.SignedPushManifest
+	if err = json.Unmarshal(manifest_bytes, &signed_manifest); err != nil {
+		fmt.Println("Error while Unmarshalling Push Manifest:", err)
+		fmt.Println("Source: GetPushManifest()")
+		return models.SignedPushManifest{}, err
+	}
+	return signed_manifest, nil
+}
+
+// Verifies Signature using Public Key of Workspace Owner & that Manifest belongs to the Workspace
+func VerifySignedPushManifest(signed_manifest models.SignedPushManifest, workspace_name, workspace_owner string) (models.PushManifest, error) {
+	public_key, err := GetPublicKeyUsingUsername(workspace_owner)
+	if err != nil {
+		fmt.Println("Error while Getting Public Key of Workspace Owner:", err)
+		fmt.Println("Source: VerifySignedPushManifest()")
+		return models.PushManifest{}, err
+	}
+
+	if err = encrypt.RSAVerifySignature(signed_manifest.Manifest, signed_manifest.Signature, string(public_key)); err != nil {
+		fmt.Println("Error while Verifying Signature of Push Manifest:", err)
+		fmt.Println("Source: VerifySignedPushManifest()")
+		return models.PushManifest{}, ErrInvalidManifest
+	}
+
+	var manifest models.PushManifest
+	if err = json.Unmarshal(signed_manifest.Manifest, &manifest); err != nil {
+		fmt.Println("Error while Unmarshalling Push Manifest:", err)
+		fmt.Println("Source: VerifySignedPushManifest()")
+		return models.PushManifest{}, err
+	}
+
+	if manifest.WorkspaceName != workspace_name || manifest.WorkspaceOwner != workspace_owner {
+		fmt.Println("Push Manifest is of another Workspace:", manifest.WorkspaceOwner, manifest.WorkspaceName)
+		fmt.Println("Source: VerifySignedPushManifest()")
+		return models.PushManifest{}, ErrInvalidManifest
+	}
+	return manifest, nil
+}
+
+func ReadManifestFile(workspace_path string) (models.SignedPushManifest, error) {
+	manifest_bytes, err := os.ReadFile(filepath.Join(workspace_path, MANIFEST_REL_PATH))
+	if err != nil {
+		return models.SignedPushManifest{}, err
+	}
+
+	var signed_manifest models.SignedPushManifest
+	if err = json.Unmarshal(manifest_bytes, &signed_manifest); err != nil {
+		fmt.Println("Error while Unmarshalling Manifest File:", err)
+		fmt.Println("Source: ReadManifestFile()")
+		return models.SignedPushManifest{}, err
+	}
+	return signed_manifest, nil
+}
+
+func WriteManifestFile(workspace_path string, signed_manifest models.SignedPushManifest) error {
+	manifest_bytes, err := json.MarshalIndent(signed_manifest, "", "	")
+	if err != nil {
+		fmt.Println("Error while Marshalling Manifest File:", err)
+		fmt.Println("Source: WriteManifestFile()")
+		return err
+	}
+
+	// Replaced instead of Overwritten, so a Manifest File Written by Older PKr doesn't keep its Mode
+	manifest_path := filepath.Join(workspace_path, MANIFEST_REL_PATH)
+	tmp_path := manifest_path + ".tmp"
+	if err = os.WriteFile(tmp_path, manifest_bytes, 0600); err != nil {
+		fmt.Println("Error while Writing Manifest File:", err)
+		fmt.Println("Source: WriteManifestFile()")
+		return err
+	}
+	if err = os.Rename(tmp_path, manifest_path); err != nil {
+		fmt.Println("Error while Renaming Manifest File:", err)
+		fmt.Println("Source: WriteManifestFile()")
+		os.Remove(tmp_path)
+		return err
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/PKr-Parivar/PKr-Base/ignore"
 	"github.com/PKr-Parivar/PKr-Base/utils"
 )
 
@@ -126,15 +127,30 @@ func UpdateLastPushNum(workspace_name string, last_push_num int) error {
 		return err
 	}
 
-	workspace_path = filepath.Join(workspace_path, WORKSPACE_CONFIG_FILE_PATH)
-	workspace_json, err := ReadFromWorkspaceConfigFile(workspace_path)
+	workspace_config_path := filepath.Join(workspace_path, WORKSPACE_CONFIG_FILE_PATH)
+	workspace_json, err := ReadFromWorkspaceConfigFile(workspace_config_path)
 	if err != nil {
 		fmt.Println("Error while Reading from workspace-config:", err)
 		fmt.Println("Source: UpdateLastPushNum()")
+		return err
+	}
+
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while Reading from user-config:", err)
+		fmt.Println("Source: UpdateLastPushNum()")
+		return err
 	}
 
+	// Manifest is Stored before Push Num is Updated, so Listeners never Pull a Push without one
 	workspace_json.LastPushNum = last_push_num
-	if err := writeToWorkspaceConfigFile(workspace_path, workspace_json); err != nil {
+	if _, err = StorePushManifest(workspace_path, user_conf.Username, workspace_json); err != nil {
+		fmt.Println("Error while Storing Push Manifest:", err)
+		fmt.Println("Source: UpdateLastPushNum()")
+		return err
+	}
+
+	if err := writeToWorkspaceConfigFile(workspace_config_path, workspace_json); err != nil {
 		fmt.Println("Error while Writing in workspace-config:", err)
 		fmt.Println("Source: UpdateLastPushNum()")
 		return err
@@ -209,3 +225,41 @@ func MergeUpdates(workspace_path string, start_push_num, end_push_num int) ([]Fi
 	}
 	return merged_changes, nil
 }
+
+// Patterns from Workspace Config & '.pkrignore' at Workspace Root, '.pkrignore' takes Precedence
+func LoadIgnoreMatcher(workspace_path string) (*ignore.Matcher, error) {
+	patterns := []string{}
+
+	workspace_config_path := filepath.Join(workspace_path, WORKSPACE_CONFIG_FILE_PATH)
+	if _, err := os.Stat(workspace_config_path); err == nil {
+		workspace_conf, err := ReadFromWorkspaceConfigFile(workspace_config_path)
+		if err != nil {
+			fmt.Println("Error while Reading from workspace-config:", err)
+			fmt.Println("Source: LoadIgnoreMatcher()")
+			return nil, err
+		}
+		patterns = append(patterns, workspace_conf.IgnorePatterns...)
+	}
+
+	file_patterns, err := ignore.ReadPatternsFromFile(filepath.Join(workspace_path, ignore.IGNORE_FILE_NAME))
+	if err != nil {
+		fmt.Println("Error while Reading .pkrignore:", err)
+		fmt.Println("Source: LoadIgnoreMatcher()")
+		return nil, err
+	}
+	patterns = append(patterns, file_patterns...)
+
+	return ignore.NewMatcher(patterns), nil
+}
+
+// Archive Formats I can Extract, Sent to Users so they can Pick one
+var SUPPORTED_ARCHIVE_FORMATS = []string{ARCHIVE_FORMAT_ZIP, ARCHIVE_FORMAT_TAR_ZSTD}
+
+// Name by which Archive of 'push_range' is Requested via GetData & Cached
+// Zip keeps the Bare Push Range, as that's what Older Users Request
+func GetArchiveName(push_range, archive_format string) string {
+	if archive_format == ARCHIVE_FORMAT_TAR_ZSTD {
+		return push_range + "." + ARCHIVE_FORMAT_TAR_ZSTD
+	}
+	return push_range
+}
@@ -1,9 +1,17 @@
 package config
 
+// Formats of Archives Sent to Listeners, Pushes're always Stored as Zip
+const (
+	ARCHIVE_FORMAT_ZIP      = "zip"
+	ARCHIVE_FORMAT_TAR_ZSTD = "tar.zst"
+)
+
 type PKRConfig struct {
-	WorkspaceName string    `json:"workspace_name"`
-	LastPushNum   int       `json:"last_push_num"`
-	AllUpdates    []Updates `json:"all_updates"`
+	WorkspaceName  string    `json:"workspace_name"`
+	LastPushNum    int       `json:"last_push_num"`
+	AllUpdates     []Updates `json:"all_updates"`
+	IgnorePatterns []string  `json:"ignore_patterns,omitempty"` // Same Syntax as .pkrignore
+	ArchiveFormat  string    `json:"archive_format,omitempty"`  // Zip if Empty, Listeners which don't Support it get Zip too
 }
 
 type FileChange struct {
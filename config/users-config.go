@@ -1,16 +1,28 @@
 package config
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/models"
 	"github.com/PKr-Parivar/PKr-Base/utils"
 )
 
+// Bytes of Randomness in Access Tokens Issued to Listeners
+const ACCESS_TOKEN_SIZE = 32
+
+var ErrNoSuchListener = errors.New("no such listener of workspace")
+
 func CreateUserConfigIfNotExists(username, password, server_ip string, grpc_port, ws_port int) error {
 	user_config_file_path, err := utils.GetUserConfigFilePath()
 	if err != nil {
@@ -179,7 +191,8 @@ func RegisterNewSendWorkspace(workspace_name, workspace_path, workspace_password
 	return nil
 }
 
-func RegisterNewGetWorkspace(workspace_name, workspace_owner_name, workspace_path, workspace_password string, last_push_num int) error {
+// 'access_token' is from InitNewWorkSpaceConnection, Empty if Workspace Owner is Older
+func RegisterNewGetWorkspace(workspace_name, workspace_owner_name, workspace_path, workspace_password, access_token string, last_push_num int) error {
 	user_conf, err := ReadFromUserConfigFile()
 	if err != nil {
 		fmt.Println("Error in reading From the UserConfig File...")
@@ -192,6 +205,7 @@ func RegisterNewGetWorkspace(workspace_name, workspace_owner_name, workspace_pat
 		WorkspaceName:      workspace_name,
 		WorkspacePath:      workspace_path,
 		WorkspacePassword:  workspace_password,
+		AccessToken:        access_token,
 		LastPushNum:        last_push_num,
 	}
 
@@ -217,7 +231,7 @@ func GetGetWorkspaceFilePath(workspace_name string) (string, error) {
 			return workspace.WorkspacePath, nil
 		}
 	}
-	return "", errors.New("no such workspace found")
+	return "", models.ErrNoSuchWorkspaceFound
 }
 
 func GetSendWorkspaceFilePath(workspace_name string) (string, error) {
@@ -233,7 +247,7 @@ func GetSendWorkspaceFilePath(workspace_name string) (string, error) {
 			return workspace.WorkspacePath, nil
 		}
 	}
-	return "", errors.New("no such workspace found")
+	return "", models.ErrNoSuchWorkspaceFound
 }
 
 // Returns Workspace Path if Username and Password Correct
@@ -250,10 +264,10 @@ func AuthenticateWorkspaceInfo(workspace_name string, workspace_password string)
 			if workspace.WorkSpacePassword == workspace_password {
 				return workspace.WorkspacePath, nil
 			}
-			return "", errors.New("incorrect password")
+			return "", models.ErrIncorrectPassword
 		}
 	}
-	return "", errors.New("no such workspace found")
+	return "", models.ErrNoSuchWorkspaceFound
 }
 
 // Update Last Push Num (Used during Pulls)
@@ -297,3 +311,248 @@ func GetPublicKeyUsingUsername(username string) ([]byte, error) {
 	}
 	return public_key, nil
 }
+
+// Records Listener of a Send Workspace, so other Listeners can be told about them
+// Returns a New Access Token of Listener, bound to 'public_key', any Older Token of it is no longer Valid
+// models.ErrPeerAuthFailed is Returned if Username or Key is already Registered with another one
+func RegisterListenerOfSendWorkspace(workspace_name, listener_username string, public_key []byte) (string, error) {
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while Reading from user-config file:", err)
+		fmt.Println("Source: RegisterListenerOfSendWorkspace()")
+		return "", err
+	}
+
+	token_bytes := make([]byte, ACCESS_TOKEN_SIZE)
+	if _, err = rand.Read(token_bytes); err != nil {
+		fmt.Println("Error while Generating Access Token:", err)
+		fmt.Println("Source: RegisterListenerOfSendWorkspace()")
+		return "", err
+	}
+	access_token := hex.EncodeToString(token_bytes)
+
+	new_listener := WorkspaceListener{
+		Username:      listener_username,
+		TokenHash:     hashForConfig([]byte(access_token)),
+		PublicKeyHash: hashForConfig(bytes.TrimSpace(public_key)),
+	}
+
+	for idx, workspace := range user_conf.SendWorkspaces {
+		if workspace.WorkspaceName != workspace_name {
+			continue
+		}
+
+		listener_idx := slices.IndexFunc(workspace.Listeners, func(listener WorkspaceListener) bool {
+			return listener.Username == listener_username
+		})
+		// Registration is bound to Key Listener Authenticated with, a Key can't Register under another Username
+		// & a Username can't be Taken over by another Key
+		key_idx := slices.IndexFunc(workspace.Listeners, func(listener WorkspaceListener) bool {
+			return listener.PublicKeyHash == new_listener.PublicKeyHash
+		})
+		if key_idx != -1 && workspace.Listeners[key_idx].Username != listener_username {
+			return "", models.ErrPeerAuthFailed
+		}
+
+		if listener_idx == -1 {
+			user_conf.SendWorkspaces[idx].Listeners = append(workspace.Listeners, new_listener)
+		} else if workspace.Listeners[listener_idx].Revoked {
+			return "", models.ErrListenerRevoked
+		} else if workspace.Listeners[listener_idx].PublicKeyHash != "" && workspace.Listeners[listener_idx].PublicKeyHash != new_listener.PublicKeyHash {
+			return "", models.ErrPeerAuthFailed
+		} else {
+			workspace.Listeners[listener_idx] = new_listener
+		}
+
+		if err := writeToUserConfigFile(user_conf); err != nil {
+			fmt.Println("Error while Writing in the user-config file:", err)
+			fmt.Println("Source: RegisterListenerOfSendWorkspace()")
+			return "", err
+		}
+		// Till it's Refreshed, Listener can only Fetch Latest Push from me, not from Peers
+		if err := RefreshPushManifest(workspace_name, user_conf.Username); err != nil {
+			fmt.Println("Error while Refreshing Push Manifest:", err)
+			fmt.Println("Source: RegisterListenerOfSendWorkspace()")
+		}
+		return access_token, nil
+	}
+	return "", models.ErrNoSuchWorkspaceFound
+}
+
+func hashForConfig(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func findListenerOfSendWorkspace(workspace_name, listener_username string) (WorkspaceListener, bool, error) {
+	listeners, err := GetListenersOfSendWorkspace(workspace_name)
+	if err != nil {
+		return WorkspaceListener{}, false, err
+	}
+	for _, listener := range listeners {
+		if listener.Username == listener_username {
+			return listener, true, nil
+		}
+	}
+	return WorkspaceListener{}, false, nil
+}
+
+// Access Token must be the one Issued to Listener, who must still have the Key it was Issued for
+// Returns Workspace Path, like AuthenticateWorkspaceInfo()
+func AuthenticateListenerToken(workspace_name, listener_username, access_token string, public_key []byte) (string, error) {
+	workspace_path, err := GetSendWorkspaceFilePath(workspace_name)
+	if err != nil {
+		return "", err
+	}
+
+	listener, found, err := findListenerOfSendWorkspace(workspace_name, listener_username)
+	if err != nil {
+		return "", err
+	}
+	if found && listener.Revoked {
+		return "", models.ErrListenerRevoked
+	}
+	if !found || listener.TokenHash == "" {
+		return "", models.ErrInvalidAccessToken
+	}
+
+	is_token_valid := subtle.ConstantTimeCompare([]byte(hashForConfig([]byte(access_token))), []byte(listener.TokenHash)) == 1
+	is_key_valid := listener.PublicKeyHash == hashForConfig(bytes.TrimSpace(public_key))
+	if !is_token_valid || !is_key_valid {
+		return "", models.ErrInvalidAccessToken
+	}
+	return workspace_path, nil
+}
+
+// Listeners with a Token must Authenticate by it, see AuthenticateListenerToken()
+// Revoked Listeners get models.ErrListenerRevoked
+func HasListenerToken(workspace_name, listener_username string) (bool, error) {
+	listener, found, err := findListenerOfSendWorkspace(workspace_name, listener_username)
+	if err != nil {
+		return false, err
+	}
+	if found && listener.Revoked {
+		return false, models.ErrListenerRevoked
+	}
+	return found && listener.TokenHash != "", nil
+}
+
+// Only Revoked Listeners're Refused, Listeners from before they were Recorded aren't Known to be one
+func CheckListenerAccess(workspace_name, listener_username string) error {
+	listener, found, err := findListenerOfSendWorkspace(workspace_name, listener_username)
+	if err != nil {
+		return err
+	}
+	if found && listener.Revoked {
+		return models.ErrListenerRevoked
+	}
+	return nil
+}
+
+// Listener's Token is Removed, it can't Fetch from me or Connect to the Workspace again
+func RevokeListenerOfSendWorkspace(workspace_name, listener_username string) error {
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while Reading from user-config file:", err)
+		fmt.Println("Source: RevokeListenerOfSendWorkspace()")
+		return err
+	}
+
+	for idx, workspace := range user_conf.SendWorkspaces {
+		if workspace.WorkspaceName != workspace_name {
+			continue
+		}
+
+		listener_idx := slices.IndexFunc(workspace.Listeners, func(listener WorkspaceListener) bool {
+			return listener.Username == listener_username
+		})
+		// Listeners from before they were Recorded get a Record, so their Password isn't Accepted either
+		// Only their Key was Stored then, so a User without one was never a Listener
+		revoked_listener := WorkspaceListener{Username: listener_username, Revoked: true}
+		if listener_idx == -1 {
+			if _, err := GetPublicKeyUsingUsername(listener_username); err != nil {
+				return ErrNoSuchListener
+			}
+			user_conf.SendWorkspaces[idx].Listeners = append(workspace.Listeners, revoked_listener)
+		} else {
+			user_conf.SendWorkspaces[idx].Listeners[listener_idx] = revoked_listener
+		}
+
+		if err := writeToUserConfigFile(user_conf); err != nil {
+			fmt.Println("Error while Writing in the user-config file:", err)
+			fmt.Println("Source: RevokeListenerOfSendWorkspace()")
+			return err
+		}
+		// Peers Serve only Listeners in Manifest, so Revoked Listener must be out of it
+		return RefreshPushManifest(workspace_name, user_conf.Username)
+	}
+	return models.ErrNoSuchWorkspaceFound
+}
+
+func GetListenersOfSendWorkspace(workspace_name string) ([]WorkspaceListener, error) {
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while Reading from user-config file:", err)
+		fmt.Println("Source: GetListenersOfSendWorkspace()")
+		return nil, err
+	}
+
+	for _, workspace := range user_conf.SendWorkspaces {
+		if workspace.WorkspaceName == workspace_name {
+			return workspace.Listeners, nil
+		}
+	}
+	return nil, models.ErrNoSuchWorkspaceFound
+}
+
+func GetGetWorkspace(workspace_name, workspace_owner_name string) (GetWorkspaceFolder, error) {
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while Reading from user-config file:", err)
+		fmt.Println("Source: GetGetWorkspace()")
+		return GetWorkspaceFolder{}, err
+	}
+
+	for _, workspace := range user_conf.GetWorkspaces {
+		if workspace.WorkspaceName == workspace_name && workspace.WorkspaceOwnerName == workspace_owner_name {
+			return workspace, nil
+		}
+	}
+	return GetWorkspaceFolder{}, models.ErrNoSuchWorkspaceFound
+}
+
+// Same as AuthenticateWorkspaceInfo, but for Workspaces I'm a Listener of
+func AuthenticateGetWorkspaceInfo(workspace_name, workspace_owner_name, workspace_password string) (GetWorkspaceFolder, error) {
+	workspace, err := GetGetWorkspace(workspace_name, workspace_owner_name)
+	if err != nil {
+		return GetWorkspaceFolder{}, err
+	}
+
+	if workspace.WorkspacePassword != workspace_password {
+		return GetWorkspaceFolder{}, models.ErrIncorrectPassword
+	}
+	return workspace, nil
+}
+
+func UpdatePeersOfGetWorkspace(workspace_name, workspace_owner_name string, peers []string) error {
+	user_conf, err := ReadFromUserConfigFile()
+	if err != nil {
+		fmt.Println("Error while reading user-config File:", err)
+		fmt.Println("Source: UpdatePeersOfGetWorkspace()")
+		return err
+	}
+
+	for idx, workspace := range user_conf.GetWorkspaces {
+		if workspace.WorkspaceName == workspace_name && workspace.WorkspaceOwnerName == workspace_owner_name {
+			user_conf.GetWorkspaces[idx].Peers = peers
+			break
+		}
+	}
+
+	if err := writeToUserConfigFile(user_conf); err != nil {
+		fmt.Println("Error while writing in user-config File:", err)
+		fmt.Println("Source: UpdatePeersOfGetWorkspace()")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/PKr-Base/utils"
+)
+
+const TEST_WORKSPACE_NAME = "test-workspace"
+
+var (
+	TEST_PUBLIC_KEY  = []byte("-----BEGIN PUBLIC KEY-----\nlistener\n-----END PUBLIC KEY-----\n")
+	OTHER_PUBLIC_KEY = []byte("-----BEGIN PUBLIC KEY-----\nsomeone else\n-----END PUBLIC KEY-----\n")
+)
+
+// User Config in a Temp Dir, with a Send Workspace that has nothing Pushed yet
+func setupTestSendWorkspace(t *testing.T) {
+	t.Helper()
+	prev_dir := utils.USER_CONFIF_FILE_DIR
+	t.Cleanup(func() { utils.USER_CONFIF_FILE_DIR = prev_dir })
+
+	root := t.TempDir()
+	if err := utils.SetUserConfigDir(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "Config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	workspace_path := filepath.Join(root, "workspace")
+	if err := os.MkdirAll(filepath.Join(workspace_path, ".PKr"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	workspace_conf := PKRConfig{WorkspaceName: TEST_WORKSPACE_NAME, LastPushNum: -1}
+	if err := writeToWorkspaceConfigFile(filepath.Join(workspace_path, WORKSPACE_CONFIG_FILE_PATH), workspace_conf); err != nil {
+		t.Fatal(err)
+	}
+
+	user_conf := UserConfig{
+		Username: "owner",
+		SendWorkspaces: []SendWorkspaceFolder{{
+			WorkspaceName:     TEST_WORKSPACE_NAME,
+			WorkspacePath:     workspace_path,
+			WorkSpacePassword: "password",
+		}},
+	}
+	if err := writeToUserConfigFile(user_conf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func registerTestListener(t *testing.T, username string, public_key []byte) string {
+	t.Helper()
+	access_token, err := RegisterListenerOfSendWorkspace(TEST_WORKSPACE_NAME, username, public_key)
+	if err != nil {
+		t.Fatal("Error while Registering Listener:", err)
+	}
+	return access_token
+}
+
+func TestAuthenticateListenerToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// Run after 'listener' is Registered with TEST_PUBLIC_KEY, Returns Token & Key to Authenticate with
+		setup func(t *testing.T, access_token string) (string, []byte)
+		want  error
+	}{
+		{
+			name:  "issued token and key",
+			setup: func(t *testing.T, access_token string) (string, []byte) { return access_token, TEST_PUBLIC_KEY },
+		},
+		{
+			name: "key with trailing whitespace",
+			setup: func(t *testing.T, access_token string) (string, []byte) {
+				return access_token, append(bytes.Clone(TEST_PUBLIC_KEY), '\n')
+			},
+		},
+		{
+			name:  "different public key",
+			setup: func(t *testing.T, access_token string) (string, []byte) { return access_token, OTHER_PUBLIC_KEY },
+			want:  models.ErrInvalidAccessToken,
+		},
+		{
+			name: "wrong token",
+			setup: func(t *testing.T, access_token string) (string, []byte) {
+				return access_token[:len(access_token)-1] + "x", TEST_PUBLIC_KEY
+			},
+			want: models.ErrInvalidAccessToken,
+		},
+		{
+			name:  "empty token",
+			setup: func(t *testing.T, access_token string) (string, []byte) { return "", TEST_PUBLIC_KEY },
+			want:  models.ErrInvalidAccessToken,
+		},
+		{
+			name: "token replaced by a newer one",
+			setup: func(t *testing.T, access_token string) (string, []byte) {
+				registerTestListener(t, "listener", TEST_PUBLIC_KEY)
+				return access_token, TEST_PUBLIC_KEY
+			},
+			want: models.ErrInvalidAccessToken,
+		},
+		{
+			name: "revoked listener",
+			setup: func(t *testing.T, access_token string) (string, []byte) {
+				if err := RevokeListenerOfSendWorkspace(TEST_WORKSPACE_NAME, "listener"); err != nil {
+					t.Fatal("Error while Revoking Listener:", err)
+				}
+				return access_token, TEST_PUBLIC_KEY
+			},
+			want: models.ErrListenerRevoked,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestSendWorkspace(t)
+			access_token, public_key := test.setup(t, registerTestListener(t, "listener", TEST_PUBLIC_KEY))
+
+			_, err := AuthenticateListenerToken(TEST_WORKSPACE_NAME, "listener", access_token, public_key)
+			if test.want == nil && err != nil {
+				t.Fatal("Valid Token was Refused:", err)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Fatalf("Error is %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+// handler.authenticateListener() only Accepts Workspace Password while this is false
+func TestHasListenerTokenRefusesPasswordFallback(t *testing.T) {
+	setupTestSendWorkspace(t)
+
+	has_token, err := HasListenerToken(TEST_WORKSPACE_NAME, "listener")
+	if err != nil || has_token {
+		t.Fatalf("Unregistered Listener: Has Token %v, Error %v, want false & nil", has_token, err)
+	}
+
+	registerTestListener(t, "listener", TEST_PUBLIC_KEY)
+	has_token, err = HasListenerToken(TEST_WORKSPACE_NAME, "listener")
+	if err != nil || !has_token {
+		t.Fatalf("Registered Listener: Has Token %v, Error %v, want true & nil", has_token, err)
+	}
+
+	if err = RevokeListenerOfSendWorkspace(TEST_WORKSPACE_NAME, "listener"); err != nil {
+		t.Fatal("Error while Revoking Listener:", err)
+	}
+	if _, err = HasListenerToken(TEST_WORKSPACE_NAME, "listener"); !errors.Is(err, models.ErrListenerRevoked) {
+		t.Fatalf("Revoked Listener: Error is %v, want %v", err, models.ErrListenerRevoked)
+	}
+}
+
+func TestRegisterListenerBindsKeyAndUsername(t *testing.T) {
+	tests := []struct {
+		name       string
+		username   string
+		public_key []byte
+		want       error
+	}{
+		{"same listener again", "listener", TEST_PUBLIC_KEY, nil},
+		{"username with another key", "listener", OTHER_PUBLIC_KEY, models.ErrPeerAuthFailed},
+		{"key under another username", "someone-else", TEST_PUBLIC_KEY, models.ErrPeerAuthFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestSendWorkspace(t)
+			registerTestListener(t, "listener", TEST_PUBLIC_KEY)
+
+			_, err := RegisterListenerOfSendWorkspace(TEST_WORKSPACE_NAME, test.username, test.public_key)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Error is %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	t.Run("revoked listener", func(t *testing.T) {
+		setupTestSendWorkspace(t)
+		registerTestListener(t, "listener", TEST_PUBLIC_KEY)
+		if err := RevokeListenerOfSendWorkspace(TEST_WORKSPACE_NAME, "listener"); err != nil {
+			t.Fatal("Error while Revoking Listener:", err)
+		}
+
+		if _, err := RegisterListenerOfSendWorkspace(TEST_WORKSPACE_NAME, "listener", TEST_PUBLIC_KEY); !errors.Is(err, models.ErrListenerRevoked) {
+			t.Fatalf("Error is %v, want %v", err, models.ErrListenerRevoked)
+		}
+	})
+}
@@ -7,14 +7,64 @@ type UserConfig struct {
 	ServerWSPort   int    `json:"server_ws_port"`
 	ServergRPCPort int    `json:"server_grpc_port"`
 
+	TransferStreams int             `json:"transfer_streams,omitempty"` // Parallel Sessions per Transfer, Default if 0
+	KCP             KCPConfig       `json:"kcp,omitzero"`
+	Bandwidth       BandwidthConfig `json:"bandwidth,omitzero"` // Reloaded while Running
+
 	SendWorkspaces []SendWorkspaceFolder `json:"send_workspace"`
 	GetWorkspaces  []GetWorkspaceFolder  `json:"get_workspace"`
 }
 
+// Tuning of KCP Sessions, Window Sizes're Agreed with the Peer before a Transfer
+type KCPConfig struct {
+	Profile string `json:"profile,omitempty"` // "fast", "normal", "lan", "metered" or "custom", "fast" if Empty
+
+	// Only Used with "custom" Profile
+	SendWindow   int  `json:"send_window,omitempty"`
+	RecvWindow   int  `json:"recv_window,omitempty"`
+	NoDelay      int  `json:"nodelay,omitempty"`
+	Interval     int  `json:"interval,omitempty"` // In ms
+	Resend       int  `json:"resend,omitempty"`
+	NoCongestion int  `json:"nc,omitempty"`
+	ACKNoDelay   bool `json:"ack_nodelay,omitempty"`
+	DSCP         int  `json:"dscp,omitempty"`
+
+	// Reed-Solomon FEC of Sent Packets, with any Profile, Off if 0
+	DataShards   int `json:"data_shards,omitempty"`
+	ParityShards int `json:"parity_shards,omitempty"`
+}
+
+// Limits on Data I Serve, in KB/s, 0 => Unlimited
+type BandwidthConfig struct {
+	UploadLimit int               `json:"upload_limit,omitempty"` // All Listeners together
+	PeerLimit   int               `json:"peer_limit,omitempty"`   // Each Listener, unless it's in 'PeerLimits'
+	PeerLimits  map[string]int    `json:"peer_limits,omitempty"`  // {"username": Limit}, Applies within Windows too
+	Windows     []BandwidthWindow `json:"windows,omitempty"`
+}
+
+// Limits within a Time of Day, i.e., {"start": "22:00", "end": "07:00"} with no Limits for Unlimited only at Night
+type BandwidthWindow struct {
+	Start       string `json:"start"` // "HH:MM" in Local Time
+	End         string `json:"end"`   // Excluded, may be Past Midnight
+	UploadLimit int    `json:"upload_limit,omitempty"`
+	PeerLimit   int    `json:"peer_limit,omitempty"`
+}
+
 type SendWorkspaceFolder struct {
-	WorkspaceName     string `json:"workspace_name"`
-	WorkspacePath     string `json:"workspace_path"`
-	WorkSpacePassword string `json:"workspace_password"`
+	WorkspaceName     string              `json:"workspace_name"`
+	WorkspacePath     string              `json:"workspace_path"`
+	WorkSpacePassword string              `json:"workspace_password"`
+	Listeners         []WorkspaceListener `json:"listeners,omitempty"`
+}
+
+type WorkspaceListener struct {
+	Username string `json:"username"`
+
+	// Only Hashes're Stored, Token is Valid only along with the Public Key it was Issued for
+	// Listeners from before Access Tokens have neither, they Use Workspace Password
+	TokenHash     string `json:"token_hash,omitempty"`
+	PublicKeyHash string `json:"public_key_hash,omitempty"`
+	Revoked       bool   `json:"revoked,omitempty"`
 }
 
 type GetWorkspaceFolder struct {
@@ -23,4 +73,8 @@ type GetWorkspaceFolder struct {
 	WorkspacePassword  string `json:"workspace_password"`
 	WorkspacePath      string `json:"workspace_path"`
 	LastPushNum        int    `json:"last_push_num"`
+	AccessToken        string `json:"access_token,omitempty"` // Issued by Workspace Owner, Older Owners don't, then Password is Used
+
+	// Other Listeners of the Workspace, Updates can be Fetched from them when Owner is Offline
+	Peers []string `json:"peers,omitempty"`
 }
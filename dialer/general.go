@@ -40,7 +40,7 @@ func CallKCP_RPC_WithContext(ctx context.Context, args, reply any, rpc_name stri
 	case <-ctx.Done():
 		return fmt.Errorf("RPC call timed out")
 	case err := <-done:
-		return err
+		return parseRPCError(err)
 	}
 }
 
@@ -0,0 +1,243 @@
+package dialer
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/kcp-go"
+)
+
+// KCP Listener tells Sessions apart only by Remote Address, so a new Session from the same
+// Punched Socket Replaces the previous one. Conv ID, the first 4 Bytes of every KCP Packet,
+// is made part of the Address, so one Socket can carry Parallel Sessions
+// With FEC, Data Packets carry Conv ID after FEC Header, Parity Packets don't carry it at all,
+// they're Routed to the Session which last Sent from that Address, so FEC Recovers less with Parallel Sessions
+
+const (
+	MUX_PACKET_QUEUE_SIZE = 1024
+
+	// See kcp-go's fec.go
+	FEC_HEADER_SIZE = 6
+	FEC_TYPE_DATA   = 0xf1
+	FEC_TYPE_PARITY = 0xf2
+)
+
+type convAddr struct {
+	addr net.Addr
+	conv uint32
+}
+
+func (a convAddr) Network() string { return a.addr.Network() }
+func (a convAddr) String() string {
+	return a.addr.String() + "/" + strconv.FormatUint(uint64(a.conv), 10)
+}
+
+// 'is_parity' is Set for FEC Parity Packets, which have no Conv ID
+func readConv(packet []byte) (conv uint32, is_parity bool, ok bool) {
+	if len(packet) < FEC_HEADER_SIZE {
+		return 0, false, false
+	}
+	// KCP Cmd & Frg never Overlap with FEC Type
+	switch binary.LittleEndian.Uint16(packet[4:]) {
+	case FEC_TYPE_PARITY:
+		return 0, true, true
+	case FEC_TYPE_DATA:
+		// FEC Header is followed by 2 Bytes of Size
+		packet = packet[FEC_HEADER_SIZE+2:]
+		if len(packet) < 4 {
+			return 0, false, false
+		}
+	}
+	return binary.LittleEndian.Uint32(packet), false, true
+}
+
+// Conv ID of Packet, Parity Packets take the Conv ID last Seen from 'addr'
+type convTracker struct {
+	mutex     sync.Mutex
+	last_conv map[string]uint32
+}
+
+func (t *convTracker) route(packet []byte, addr net.Addr) (uint32, bool) {
+	conv, is_parity, ok := readConv(packet)
+	if !ok {
+		return 0, false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.last_conv == nil {
+		t.last_conv = map[string]uint32{}
+	}
+	if is_parity {
+		conv, ok = t.last_conv[addr.String()]
+		return conv, ok
+	}
+	t.last_conv[addr.String()] = conv
+	return conv, true
+}
+
+// Punched Socket as Seen by KCP Listener, see kcp.ServeConn()
+type ConvPacketConn struct {
+	*net.UDPConn
+	tracker convTracker
+}
+
+func NewConvPacketConn(udp_conn *net.UDPConn) *ConvPacketConn {
+	return &ConvPacketConn{UDPConn: udp_conn}
+}
+
+func (c *ConvPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.UDPConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+		if conv, ok := c.tracker.route(p[:n], addr); ok {
+			return n, convAddr{addr: addr, conv: conv}, nil
+		}
+	}
+}
+
+func (c *ConvPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if conv_addr, ok := addr.(convAddr); ok {
+		addr = conv_addr.addr
+	}
+	return c.UDPConn.WriteTo(p, addr)
+}
+
+// Routes Packets Read from Punched Socket to the Session they belong to, by Conv ID
+// Socket mustn't be Read by anything else till Mux is Closed
+type KCPMux struct {
+	udp_conn *net.UDPConn
+	mutex    sync.Mutex
+	sessions map[uint32]*muxConn
+	tracker  convTracker
+	done     chan struct{}
+}
+
+func NewKCPMux(udp_conn *net.UDPConn) *KCPMux {
+	mux := &KCPMux{
+		udp_conn: udp_conn,
+		sessions: map[uint32]*muxConn{},
+		done:     make(chan struct{}),
+	}
+	go mux.readLoop()
+	return mux
+}
+
+func (m *KCPMux) readLoop() {
+	defer close(m.done)
+	buffer := make([]byte, 2048)
+	for {
+		n, addr, err := m.udp_conn.ReadFrom(buffer)
+		if err != nil {
+			m.mutex.Lock()
+			for _, conn := range m.sessions {
+				conn.closeOnce.Do(func() { close(conn.closed) })
+			}
+			m.mutex.Unlock()
+			return
+		}
+
+		conv, ok := m.tracker.route(buffer[:n], addr)
+		if !ok {
+			continue
+		}
+		m.mutex.Lock()
+		conn, ok := m.sessions[conv]
+		m.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		// KCP Retransmits whatever is Dropped, so a Slow Session never Blocks the others
+		select {
+		case conn.packets <- muxPacket{data: append([]byte(nil), buffer[:n]...), addr: addr}:
+		default:
+		}
+	}
+}
+
+// Dials a new KCP Session over Punched Socket with 'profile', Closing it Unregisters it from Mux
+func (m *KCPMux) Dial(raddr string, profile KCPProfile) (*kcp.UDPSession, error) {
+	udp_raddr, err := net.ResolveUDPAddr("udp", raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var conv uint32
+	if err = binary.Read(rand.Reader, binary.LittleEndian, &conv); err != nil {
+		return nil, err
+	}
+
+	conn := &muxConn{
+		mux:     m,
+		conv:    conv,
+		packets: make(chan muxPacket, MUX_PACKET_QUEUE_SIZE),
+		closed:  make(chan struct{}),
+	}
+	m.mutex.Lock()
+	m.sessions[conv] = conn
+	m.mutex.Unlock()
+
+	session, err := kcp.NewConn4(conv, udp_raddr, nil, profile.DataShards, profile.ParityShards, true, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ApplyKCPProfile(session, profile)
+	return session, nil
+}
+
+// Stops Routing, so Punched Socket can be used Directly again
+func (m *KCPMux) Close() error {
+	if err := m.udp_conn.SetReadDeadline(time.Now()); err != nil {
+		return err
+	}
+	<-m.done
+	return m.udp_conn.SetReadDeadline(time.Time{})
+}
+
+type muxPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// Packets of a single Session, as Routed by KCPMux
+type muxConn struct {
+	mux       *KCPMux
+	conv      uint32
+	packets   chan muxPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *muxConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-c.packets:
+		return copy(p, packet.data), packet.addr, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *muxConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.mux.udp_conn.WriteTo(p, addr)
+}
+
+func (c *muxConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.mux.mutex.Lock()
+	delete(c.mux.sessions, c.conv)
+	c.mux.mutex.Unlock()
+	return nil
+}
+
+func (c *muxConn) LocalAddr() net.Addr                { return c.mux.udp_conn.LocalAddr() }
+func (c *muxConn) SetDeadline(t time.Time) error      { return nil }
+func (c *muxConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *muxConn) SetWriteDeadline(t time.Time) error { return nil }
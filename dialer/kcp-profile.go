@@ -0,0 +1,150 @@
+package dialer
+
+import (
+	"fmt"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/kcp-go"
+)
+
+// Named KCP Tuning Profiles, see config.KCPConfig
+const (
+	KCP_PROFILE_FAST    = "fast"
+	KCP_PROFILE_NORMAL  = "normal"
+	KCP_PROFILE_LAN     = "lan"
+	KCP_PROFILE_METERED = "metered"
+	KCP_PROFILE_CUSTOM  = "custom"
+
+	DEFAULT_KCP_PROFILE = KCP_PROFILE_FAST
+	MAX_KCP_WINDOW      = 32768
+	MAX_FEC_SHARDS      = 256 // Data + Parity, Limit of Reed-Solomon
+)
+
+type KCPProfile struct {
+	Name string
+
+	SendWindow int
+	RecvWindow int
+
+	// See kcp.UDPSession.SetNoDelay()
+	NoDelay      int
+	Interval     int
+	Resend       int
+	NoCongestion int
+
+	ACKNoDelay bool
+	DSCP       int
+
+	// FEC is Off if 0, Peers needn't Agree on them, KCP Tunes its Decoder to what it Receives
+	DataShards   int
+	ParityShards int
+}
+
+var KCP_PROFILES = map[string]KCPProfile{
+	// Turbo Mode, Retransmits Early & doesn't Back Off, what was Hardcoded before
+	KCP_PROFILE_FAST: {SendWindow: 128, RecvWindow: 1024, NoDelay: 1, Interval: 10, Resend: 2, NoCongestion: 1, ACKNoDelay: true, DSCP: 46},
+	// Regular TCP like Behaviour, for Lossy or Shared Links
+	KCP_PROFILE_NORMAL: {SendWindow: 128, RecvWindow: 512, NoDelay: 0, Interval: 40, Resend: 0, NoCongestion: 0, DSCP: 46},
+	// Large Windows, Latency is Low & Bandwidth is Plenty
+	KCP_PROFILE_LAN: {SendWindow: 1024, RecvWindow: 1024, NoDelay: 1, Interval: 10, Resend: 2, NoCongestion: 1, ACKNoDelay: true, DSCP: 46},
+	// Small Windows & Congestion Control, so Transfers don't Eat up the Link
+	KCP_PROFILE_METERED: {SendWindow: 32, RecvWindow: 128, NoDelay: 0, Interval: 50, Resend: 0, NoCongestion: 0},
+}
+
+// Profile this User's Sessions Start with, Set from User Config
+var KCP_PROFILE = GetDefaultKCPProfile()
+
+func GetDefaultKCPProfile() KCPProfile {
+	profile := KCP_PROFILES[DEFAULT_KCP_PROFILE]
+	profile.Name = DEFAULT_KCP_PROFILE
+	return profile
+}
+
+// Named Profile, or Values of 'kcp_conf' if Profile is "custom", FEC is taken from 'kcp_conf' either way
+func ResolveKCPProfile(kcp_conf config.KCPConfig) (KCPProfile, error) {
+	name := kcp_conf.Profile
+	if name == "" {
+		name = DEFAULT_KCP_PROFILE
+	}
+
+	var profile KCPProfile
+	if name == KCP_PROFILE_CUSTOM {
+		profile = KCPProfile{
+			SendWindow:   kcp_conf.SendWindow,
+			RecvWindow:   kcp_conf.RecvWindow,
+			NoDelay:      kcp_conf.NoDelay,
+			Interval:     kcp_conf.Interval,
+			Resend:       kcp_conf.Resend,
+			NoCongestion: kcp_conf.NoCongestion,
+			ACKNoDelay:   kcp_conf.ACKNoDelay,
+			DSCP:         kcp_conf.DSCP,
+		}
+	} else {
+		var ok bool
+		profile, ok = KCP_PROFILES[name]
+		if !ok {
+			return KCPProfile{}, fmt.Errorf("unknown kcp profile: %s", name)
+		}
+	}
+	profile.Name = name
+	profile.DataShards = kcp_conf.DataShards
+	profile.ParityShards = kcp_conf.ParityShards
+
+	if err := profile.validate(); err != nil {
+		return KCPProfile{}, err
+	}
+	return profile, nil
+}
+
+func (p KCPProfile) validate() error {
+	if p.SendWindow <= 0 || p.SendWindow > MAX_KCP_WINDOW || p.RecvWindow <= 0 || p.RecvWindow > MAX_KCP_WINDOW {
+		return fmt.Errorf("kcp windows must be between 1 and %d", MAX_KCP_WINDOW)
+	}
+	if p.Interval < 10 || p.Interval > 5000 {
+		return fmt.Errorf("kcp interval must be between 10 and 5000 ms")
+	}
+	if p.NoDelay < 0 || p.Resend < 0 || p.NoCongestion < 0 {
+		return fmt.Errorf("kcp nodelay, resend & nc mustn't be negative")
+	}
+	if p.DSCP < 0 || p.DSCP > 63 {
+		return fmt.Errorf("dscp must be between 0 and 63")
+	}
+	if (p.DataShards > 0) != (p.ParityShards > 0) || p.DataShards < 0 || p.ParityShards < 0 {
+		return fmt.Errorf("fec needs both data & parity shards, or neither")
+	}
+	if p.DataShards+p.ParityShards > MAX_FEC_SHARDS {
+		return fmt.Errorf("fec data & parity shards mustn't exceed %d in total", MAX_FEC_SHARDS)
+	}
+	return nil
+}
+
+// Windows Agreed with a Peer whose Windows're 'remote_send' & 'remote_recv'
+// Sending more than Peer can Receive only Fills its Queue, so each Side's taken as the Smaller one
+// Zero means Peer is Older & didn't send its Windows, then Profile is Unchanged
+func (p KCPProfile) AgreeWindows(remote_send, remote_recv int) KCPProfile {
+	if remote_send <= 0 || remote_recv <= 0 {
+		return p
+	}
+	p.SendWindow = min(p.SendWindow, remote_recv)
+	p.RecvWindow = min(p.RecvWindow, remote_send)
+	return p
+}
+
+// Windows as Agreed by Peer, from its side, i.e., its Send Window is my Recv Window
+func (p KCPProfile) WithPeerWindows(peer_send, peer_recv int) KCPProfile {
+	if peer_send <= 0 || peer_recv <= 0 {
+		return p
+	}
+	p.SendWindow = peer_recv
+	p.RecvWindow = peer_send
+	return p
+}
+
+func ApplyKCPProfile(session *kcp.UDPSession, profile KCPProfile) {
+	session.SetWindowSize(profile.SendWindow, profile.RecvWindow)
+	session.SetNoDelay(profile.NoDelay, profile.Interval, profile.Resend, profile.NoCongestion)
+	session.SetACKNoDelay(profile.ACKNoDelay)
+	// DSCP is of the Socket, for Sessions of a KCP Listener it's Set via kcp.Listener.SetDSCP()
+	// Sessions over KCPMux Share the Socket of the first Session, so this Fails for them Harmlessly
+	session.SetDSCP(profile.DSCP)
+}
@@ -2,14 +2,52 @@ package dialer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/rpc"
 
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
 	"github.com/PKr-Parivar/PKr-Base/models"
 )
 
 type ClientCallHandler struct{}
 
+// Agreed Protocol Version & Capabilities, Users without Hello are Older than models.MIN_PROTOCOL_VERSION
+// & get models.ErrPeerMustUpgrade, Errors if they're Incompatible
+func (h *ClientCallHandler) CallHello(my_username, clientHandlerName string, rpc_client *rpc.Client) (models.HelloResponse, error) {
+	var req models.HelloRequest
+	var res models.HelloResponse
+
+	req.Username = my_username
+	req.ProtocolVersion = models.PROTOCOL_VERSION
+	req.MinProtocolVersion = models.MIN_PROTOCOL_VERSION
+	req.Capabilities = models.MY_CAPABILITIES
+
+	ctx, cancel := context.WithTimeout(context.Background(), CONTEXT_TIMEOUT)
+	defer cancel()
+
+	rpc_name := CLIENT_BASE_HANDLER_NAME + clientHandlerName + ".Hello"
+	err := CallKCP_RPC_WithContext(ctx, req, &res, rpc_name, rpc_client)
+	if errors.Is(err, models.ErrUnknownMethod) {
+		err = fmt.Errorf("%w (no hello)", models.ErrPeerMustUpgrade)
+	}
+	if err != nil {
+		fmt.Println("Error while Calling Hello:", err)
+		fmt.Println("Source: CallHello()")
+		return res, err
+	}
+
+	// User must've Agreed on something I Support too
+	res.ProtocolVersion, res.Capabilities, err = models.NegotiateProtocol(res.ProtocolVersion, res.ProtocolVersion, res.Capabilities)
+	if err != nil {
+		fmt.Println("Error while Negotiating Protocol:", err)
+		fmt.Println("Source: CallHello()")
+		return res, err
+	}
+	return res, nil
+}
+
 func (h *ClientCallHandler) CallGetPublicKey(clientHandlerName string, rpc_client *rpc.Client) ([]byte, error) {
 	var req models.PublicKeyRequest
 	var res models.PublicKeyResponse
@@ -26,7 +64,8 @@ func (h *ClientCallHandler) CallGetPublicKey(clientHandlerName string, rpc_clien
 	return res.PublicKey, nil
 }
 
-func (h *ClientCallHandler) CallInitNewWorkSpaceConnection(workspace_name, my_username, server_ip, workspace_password string, my_public_key []byte, clientHandlerName string, rpc_client *rpc.Client) error {
+// Returns Access Token Issued by Workspace Owner, Empty if Owner is Older, see config.RegisterNewGetWorkspace()
+func (h *ClientCallHandler) CallInitNewWorkSpaceConnection(workspace_name, my_username, server_ip, workspace_password string, my_public_key []byte, clientHandlerName string, rpc_client *rpc.Client) (string, error) {
 	var req models.InitWorkspaceConnectionRequest
 	var res models.InitWorkspaceConnectionResponse
 
@@ -44,20 +83,45 @@ func (h *ClientCallHandler) CallInitNewWorkSpaceConnection(workspace_name, my_us
 	if err := CallKCP_RPC_WithContext(ctx, req, &res, rpc_name, rpc_client); err != nil {
 		fmt.Println("Error while Calling Init New Workspace Connection:", err)
 		fmt.Println("Source: CallInitNewWorkSpaceConnection()")
-		return err
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", nil
+	}
+
+	access_token, err := encrypt.RSADecryptData(res.AccessToken)
+	if err != nil {
+		fmt.Println("Error while Decrypting Access Token:", err)
+		fmt.Println("Source: CallInitNewWorkSpaceConnection()")
+		return "", err
 	}
-	return nil
+	return access_token, nil
 }
 
-func (h *ClientCallHandler) CallGetMetaData(my_username, server_ip, workspace_name, workspace_password, clientHandlerName string, last_push_num int, rpc_client *rpc.Client) (*models.GetMetaDataResponse, error) {
+// 'workspace_owner' & 'file_hashes' are only needed when Fetching from another Listener
+// 'access_token' is only Sent to Workspace Owner, Encrypted like 'workspace_password'
+// 'capabilities' are from CallHello(), Features not in them aren't Asked for
+func (h *ClientCallHandler) CallGetMetaData(my_username, server_ip, workspace_name, workspace_owner, workspace_password, access_token, clientHandlerName string, last_push_num int, file_hashes map[string]string, capabilities models.Capability, rpc_client *rpc.Client) (*models.GetMetaDataResponse, error) {
 	var req models.GetMetaDataRequest
 	var res models.GetMetaDataResponse
 
 	req.Username = my_username
 	req.WorkspaceName = workspace_name
 	req.WorkspacePassword = workspace_password
+	req.AccessToken = access_token
 	req.LastPushNum = last_push_num
 	req.ServerIP = server_ip
+	req.EncryptionVersion = encrypt.ENCRYPTION_VERSION_AEAD
+	req.WorkspaceOwner = workspace_owner
+	req.FileHashes = file_hashes
+	// Chunks're only Fetched from Workspace Owner
+	req.SupportsChunks = workspace_owner == "" && capabilities.Has(models.CAP_CHUNKS)
+	req.ArchiveFormats = []string{config.ARCHIVE_FORMAT_ZIP}
+	if capabilities.Has(models.CAP_COMPRESSION) {
+		req.ArchiveFormats = config.SUPPORTED_ARCHIVE_FORMATS
+	}
+	req.KCPSendWindow = KCP_PROFILE.SendWindow
+	req.KCPRecvWindow = KCP_PROFILE.RecvWindow
 
 	ctx, cancel := context.WithTimeout(context.Background(), CONTEXT_TIMEOUT)
 	defer cancel()
@@ -70,3 +134,26 @@ func (h *ClientCallHandler) CallGetMetaData(my_username, server_ip, workspace_na
 	}
 	return &res, nil
 }
+
+func (h *ClientCallHandler) CallGetChunks(my_username, workspace_name, workspace_password, access_token, request_push_range, clientHandlerName string, chunk_hashes []string, rpc_client *rpc.Client) (*models.GetChunksResponse, error) {
+	var req models.GetChunksRequest
+	var res models.GetChunksResponse
+
+	req.Username = my_username
+	req.WorkspaceName = workspace_name
+	req.WorkspacePassword = workspace_password
+	req.AccessToken = access_token
+	req.RequestPushRange = request_push_range
+	req.ChunkHashes = chunk_hashes
+
+	ctx, cancel := context.WithTimeout(context.Background(), CONTEXT_TIMEOUT)
+	defer cancel()
+
+	rpc_name := CLIENT_BASE_HANDLER_NAME + clientHandlerName + ".GetChunks"
+	if err := CallKCP_RPC_WithContext(ctx, req, &res, rpc_name, rpc_client); err != nil {
+		fmt.Println("Error while Calling Get Chunks:", err)
+		fmt.Println("Source: CallGetChunks()")
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,246 @@
+package dialer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/framing"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/PKr-Base/utils"
+)
+
+// Every KCP Session is Authenticated both ways with RSA Keys, before its Type (RPC, KCP or KFR) is Sent
+//  1. Listener Sends AUTH_SESSION_TAG & an Auth Frame with its Username, Public Key & a Nonce
+//  2. Workspace Owner Replies with its Username, Public Key, a Nonce & its Signature over both Nonces
+//  3. Listener Verifies it & Replies with its own Signature, Owner Verifies it & Sends an Ack
+// Public Keys must be the ones Stored in Keys/Others, Unknown ones're Accepted only till Keys're Exchanged,
+// i.e., for GetPublicKey & InitNewWorkSpaceConnection
+
+const (
+	AUTH_SESSION_TAG = "AUT"
+	AUTH_NONCE_SIZE  = 32
+	AUTH_TIMEOUT     = 30 * time.Second
+)
+
+const (
+	AUTH_ROLE_LISTENER = "listener"
+	AUTH_ROLE_OWNER    = "owner"
+)
+
+type AuthenticatedPeer struct {
+	Username  string
+	PublicKey []byte // PEM, Peer has Proved it has the Private Key of it
+	IsKnown   bool   // PublicKey is the one Stored in Keys/Others
+}
+
+type authMessage struct {
+	Username  string `json:"username,omitempty"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// What each Side Signs, Role keeps Signature of one Side from being Replayed as the other's
+func authTranscript(role, listener_username, owner_username string, listener_nonce, owner_nonce []byte) []byte {
+	return fmt.Appendf(nil, "PKr-Auth;%s;%s;%s;%x;%x", role, listener_username, owner_username, listener_nonce, owner_nonce)
+}
+
+func newAuthNonce() ([]byte, error) {
+	nonce := make([]byte, AUTH_NONCE_SIZE)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// Username is Part of Path of its Key, so it mustn't Lead out of Keys/Others
+func isValidAuthUsername(username string) bool {
+	return username != "" && username != "." && username != ".." && filepath.Base(username) == username
+}
+
+// Known is false if there's no Stored Key of 'username', Errors if Stored Key is a different one
+func checkPeerPublicKey(username string, public_key []byte) (bool, error) {
+	other_keys_path, err := utils.GetOthersKeysPath()
+	if err != nil {
+		return false, err
+	}
+
+	stored_key, err := os.ReadFile(filepath.Join(other_keys_path, username+".pem"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(stored_key), bytes.TrimSpace(public_key)) {
+		return false, models.ErrPeerAuthFailed
+	}
+	return true, nil
+}
+
+func readAuthAck(conn net.Conn) error {
+	frame, err := framing.ReadFrame(conn)
+	if err != nil {
+		return err
+	}
+	switch frame.Type {
+	case framing.FRAME_ACK:
+		return nil
+	case framing.FRAME_ERROR:
+		return frame.Err()
+	}
+	return fmt.Errorf("%w: %s", framing.ErrUnexpectedFrame, frame.Type)
+}
+
+// Owners Older than Session Authentication Drop the Session on AUTH_SESSION_TAG without Replying,
+// so no Reply or one that isn't a Frame means Owner must Upgrade
+func authReplyError(err error) error {
+	// Coded Errors're Sent by Owner, e.g. models.ErrIncompatibleProtocol
+	if models.GetErrorCode(err) != "" {
+		return err
+	}
+	var net_err net.Error
+	is_timeout := errors.As(err, &net_err) && net_err.Timeout()
+	if is_timeout || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, framing.ErrUnexpectedFrame) || errors.Is(err, framing.ErrUnknownFrameType) || errors.Is(err, framing.ErrFrameTooLarge) {
+		return fmt.Errorf("%w: %v", models.ErrPeerMustUpgrade, err)
+	}
+	return err
+}
+
+// Called by Listener right after Dialing, Proves I'm 'my_username' & that other side is 'username'
+// Other side may be Unknown only if I don't have its Key yet, Caller decides whether that's Allowed
+func AuthenticateToUser(conn net.Conn, my_username, username string) (AuthenticatedPeer, error) {
+	if err := conn.SetDeadline(time.Now().Add(AUTH_TIMEOUT)); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	my_public_key, err := config.ReadMyPublicKey()
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	my_nonce, err := newAuthNonce()
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	if _, err = conn.Write([]byte(AUTH_SESSION_TAG)); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	err = framing.WriteJSONFrame(conn, framing.FRAME_AUTH, authMessage{Username: my_username, PublicKey: my_public_key, Nonce: my_nonce})
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	var reply authMessage
+	if err = framing.ReadJSONFrame(conn, framing.FRAME_AUTH, &reply); err != nil {
+		return AuthenticatedPeer{}, authReplyError(err)
+	}
+	if reply.Username != username || len(reply.Nonce) != AUTH_NONCE_SIZE {
+		return AuthenticatedPeer{}, models.ErrPeerAuthFailed
+	}
+
+	is_known, err := checkPeerPublicKey(username, reply.PublicKey)
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	owner_transcript := authTranscript(AUTH_ROLE_OWNER, my_username, username, my_nonce, reply.Nonce)
+	if err = encrypt.RSAVerifySignature(owner_transcript, reply.Signature, string(reply.PublicKey)); err != nil {
+		return AuthenticatedPeer{}, models.ErrPeerAuthFailed
+	}
+
+	signature, err := encrypt.RSASignData(authTranscript(AUTH_ROLE_LISTENER, my_username, username, my_nonce, reply.Nonce))
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	if err = framing.WriteJSONFrame(conn, framing.FRAME_AUTH, authMessage{Signature: signature}); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	if err = readAuthAck(conn); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	return AuthenticatedPeer{Username: username, PublicKey: reply.PublicKey, IsKnown: is_known}, nil
+}
+
+// Called by Workspace Owner once Listener has Sent AUTH_SESSION_TAG, Listener must be 'expected_username' if it's Set
+// Failures're Sent to Listener as Error Frames
+func AuthenticateListener(conn net.Conn, my_username, expected_username string) (AuthenticatedPeer, error) {
+	if err := conn.SetDeadline(time.Now().Add(AUTH_TIMEOUT)); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	peer, err := authenticateListener(conn, my_username, expected_username)
+	if err != nil {
+		// Internal Errors aren't Shown to Listener
+		var error_to_send error = models.ErrPeerAuthFailed
+		if models.GetErrorCode(err) != "" {
+			error_to_send = err
+		}
+		framing.WriteErrorFrame(conn, error_to_send)
+		return AuthenticatedPeer{}, err
+	}
+	return peer, nil
+}
+
+func authenticateListener(conn net.Conn, my_username, expected_username string) (AuthenticatedPeer, error) {
+	var hello authMessage
+	if err := framing.ReadJSONFrame(conn, framing.FRAME_AUTH, &hello); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	if !isValidAuthUsername(hello.Username) || len(hello.Nonce) != AUTH_NONCE_SIZE {
+		return AuthenticatedPeer{}, models.ErrPeerAuthFailed
+	}
+	if expected_username != "" && hello.Username != expected_username {
+		return AuthenticatedPeer{}, models.ErrPeerAuthFailed
+	}
+
+	is_known, err := checkPeerPublicKey(hello.Username, hello.PublicKey)
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	my_public_key, err := config.ReadMyPublicKey()
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	my_nonce, err := newAuthNonce()
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	signature, err := encrypt.RSASignData(authTranscript(AUTH_ROLE_OWNER, hello.Username, my_username, hello.Nonce, my_nonce))
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	err = framing.WriteJSONFrame(conn, framing.FRAME_AUTH, authMessage{Username: my_username, PublicKey: my_public_key, Nonce: my_nonce, Signature: signature})
+	if err != nil {
+		return AuthenticatedPeer{}, err
+	}
+
+	var proof authMessage
+	if err = framing.ReadJSONFrame(conn, framing.FRAME_AUTH, &proof); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	listener_transcript := authTranscript(AUTH_ROLE_LISTENER, hello.Username, my_username, hello.Nonce, my_nonce)
+	if err = encrypt.RSAVerifySignature(listener_transcript, proof.Signature, string(hello.PublicKey)); err != nil {
+		return AuthenticatedPeer{}, models.ErrPeerAuthFailed
+	}
+
+	if err = framing.WriteFrame(conn, framing.FRAME_ACK, nil); err != nil {
+		return AuthenticatedPeer{}, err
+	}
+	return AuthenticatedPeer{Username: hello.Username, PublicKey: hello.PublicKey, IsKnown: is_known}, nil
+}
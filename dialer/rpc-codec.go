@@ -0,0 +1,94 @@
+package dialer
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net/rpc"
+	"strings"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Same as net/rpc's Gob Codec, but also Reads 'ErrorCode' which handler's RPC Server Sends in Response Header
+// net/rpc only Passes on the Error String, so Code is Prefixed to it & Split off again in CallKCP_RPC_WithContext()
+
+const RPC_ERROR_CODE_SEPARATOR = "\x00"
+
+// Older Servers Send net/rpc's own Errors for Unknown Services & Methods, without a Code
+var LEGACY_UNKNOWN_METHOD_PREFIXES = []string{"rpc: can't find method ", "rpc: can't find service "}
+
+// Header of handler.Response, Gob Matches Fields by Name, so Older Servers just leave 'ErrorCode' Empty
+type rpcResponse struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+	ErrorCode     models.ErrorCode
+}
+
+type gobClientCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+}
+
+func (c *gobClientCodec) WriteRequest(r *rpc.Request, body any) (err error) {
+	if err = c.enc.Encode(r); err != nil {
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	var res rpcResponse
+	if err := c.dec.Decode(&res); err != nil {
+		return err
+	}
+	r.ServiceMethod = res.ServiceMethod
+	r.Seq = res.Seq
+	r.Error = res.Error
+	if res.Error != "" && res.ErrorCode != "" {
+		r.Error = string(res.ErrorCode) + RPC_ERROR_CODE_SEPARATOR + res.Error
+	}
+	return nil
+}
+
+func (c *gobClientCodec) ReadResponseBody(body any) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobClientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+func NewRPCClient(conn io.ReadWriteCloser) *rpc.Client {
+	encBuf := bufio.NewWriter(conn)
+	return rpc.NewClientWithCodec(&gobClientCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(encBuf),
+		encBuf: encBuf,
+	})
+}
+
+// Maps Errors Returned by Server's Methods back to models Errors, other Errors're Returned as they are
+func parseRPCError(err error) error {
+	server_err, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	code, message, ok := strings.Cut(string(server_err), RPC_ERROR_CODE_SEPARATOR)
+	if !ok {
+		for _, prefix := range LEGACY_UNKNOWN_METHOD_PREFIXES {
+			if strings.HasPrefix(string(server_err), prefix) {
+				return models.ErrUnknownMethod
+			}
+		}
+		return models.ErrorFromCode("", string(server_err))
+	}
+	return models.ErrorFromCode(models.ErrorCode(code), message)
+}
@@ -0,0 +1,107 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+func init() {
+	logger.LOGGER = log.New(io.Discard, "", 0)
+}
+
+func TestParseRPCError(t *testing.T) {
+	newer_peer_err := &models.CodedError{Code: "from_newer_peer"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"legacy unknown method", rpc.ServerError("rpc: can't find method ClientHandler1234.Hello"), models.ErrUnknownMethod},
+		{"legacy unknown service", rpc.ServerError("rpc: can't find service ClientHandler1234.Hello"), models.ErrUnknownMethod},
+		{"coded error", rpc.ServerError(string(models.ERR_CODE_LISTENER_REVOKED) + RPC_ERROR_CODE_SEPARATOR + "revoked"), models.ErrListenerRevoked},
+		{"coded unknown method", rpc.ServerError(string(models.ERR_CODE_UNKNOWN_METHOD) + RPC_ERROR_CODE_SEPARATOR + "unknown"), models.ErrUnknownMethod},
+		{"code of newer peer", rpc.ServerError("from_newer_peer" + RPC_ERROR_CODE_SEPARATOR + "something new"), newer_peer_err},
+		{"legacy message without code", rpc.ServerError("incorrect password"), models.ErrIncorrectPassword},
+		{"not a server error", io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := parseRPCError(test.err); !errors.Is(err, test.want) {
+				t.Fatalf("Error is %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	// Message that only Looks like it's about an Unknown Method mustn't be Mapped
+	err := parseRPCError(rpc.ServerError("no such workspace: rpc: can't find method"))
+	if errors.Is(err, models.ErrUnknownMethod) {
+		t.Fatal("Error not Starting with net/rpc's Prefix was Mapped to ErrUnknownMethod")
+	}
+}
+
+// ClientHandler of a Server from before Hello, which only has Methods it had back then
+type legacyClientHandler struct{}
+
+func (h *legacyClientHandler) GetPublicKey(req models.PublicKeyRequest, res *models.PublicKeyResponse) error {
+	res.PublicKey = []byte("public key")
+	return nil
+}
+
+// Unmodified net/rpc Server, it Sends neither Error Codes nor Hello
+func dialLegacyServer(t *testing.T, client_handler_name string) *rpc.Client {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName(CLIENT_BASE_HANDLER_NAME+client_handler_name, &legacyClientHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	server_conn, client_conn := net.Pipe()
+	go server.ServeConn(server_conn)
+	rpc_client := NewRPCClient(client_conn)
+	t.Cleanup(func() { rpc_client.Close() })
+	return rpc_client
+}
+
+func TestLegacyServerUnknownMethod(t *testing.T) {
+	rpc_client := dialLegacyServer(t, "1234")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var res models.PublicKeyResponse
+	if err := CallKCP_RPC_WithContext(ctx, models.PublicKeyRequest{}, &res, CLIENT_BASE_HANDLER_NAME+"1234.GetPublicKey", rpc_client); err != nil {
+		t.Fatal("Error while Calling Method Legacy Server has:", err)
+	}
+
+	var hello_res models.HelloResponse
+	err := CallKCP_RPC_WithContext(ctx, models.HelloRequest{}, &hello_res, CLIENT_BASE_HANDLER_NAME+"1234.Hello", rpc_client)
+	if !errors.Is(err, models.ErrUnknownMethod) {
+		t.Fatalf("Error for Missing Method is %v, want %v", err, models.ErrUnknownMethod)
+	}
+
+	err = CallKCP_RPC_WithContext(ctx, models.HelloRequest{}, &hello_res, "NoSuchService.Hello", rpc_client)
+	if !errors.Is(err, models.ErrUnknownMethod) {
+		t.Fatalf("Error for Missing Service is %v, want %v", err, models.ErrUnknownMethod)
+	}
+}
+
+// Owners without Hello're Older than models.MIN_PROTOCOL_VERSION
+func TestCallHelloRefusesLegacyServer(t *testing.T) {
+	rpc_client := dialLegacyServer(t, "1234")
+
+	var handler ClientCallHandler
+	_, err := handler.CallHello("listener", "1234", rpc_client)
+	if !errors.Is(err, models.ErrPeerMustUpgrade) {
+		t.Fatalf("Error is %v, want %v", err, models.ErrPeerMustUpgrade)
+	}
+}
@@ -0,0 +1,227 @@
+package encrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Encrypted Stream Format:
+//
+//	[Version (1 Byte)][Nonce Prefix (7 Bytes)][Sealed Chunk 0][Sealed Chunk 1]...
+//
+// Every Chunk is AEAD_CHUNK Bytes of Plaintext (Last one may be Shorter) Sealed with AES-GCM
+// Nonce of a Chunk = Nonce Prefix + Chunk Index (4 Bytes) + Final Chunk Flag (1 Byte)
+// So Chunks can't be Reordered, Dropped or Truncated without Failing Authentication
+const (
+	ENCRYPTION_VERSION_CTR  = 1
+	ENCRYPTION_VERSION_AEAD = 2
+
+	AEAD_CHUNK             = 64 * 1024 // 64KB of Plaintext per Chunk
+	AEAD_TAG_SIZE          = 16
+	AEAD_SEALED_CHUNK      = AEAD_CHUNK + AEAD_TAG_SIZE
+	AEAD_NONCE_PREFIX_SIZE = 7
+	AEAD_HEADER_SIZE       = 1 + AEAD_NONCE_PREFIX_SIZE
+)
+
+var (
+	ErrUnsupportedEncryptionVersion = errors.New("unsupported encryption version, please update PKr")
+	ErrInvalidEncryptionHeader      = errors.New("invalid encryption header")
+)
+
+type ChunkCipher struct {
+	aead         cipher.AEAD
+	nonce_prefix [AEAD_NONCE_PREFIX_SIZE]byte
+}
+
+// 'iv' is the AES IV already Shared with Listeners, its first Bytes're used as Nonce Prefix
+// Nonces depend only on Prefix & Chunk Index, so a Key & IV must Seal only one Stream
+// Prefix has to be Stable across Resumed Transfers of that Stream
+func NewChunkCipher(key, iv []byte) (*ChunkCipher, error) {
+	if len(iv) < AEAD_NONCE_PREFIX_SIZE {
+		return nil, errors.New("iv is too short for nonce prefix")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		fmt.Println("Error while Creating New Cipher Block:", err)
+		fmt.Println("Source: NewChunkCipher()")
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		fmt.Println("Error while Creating GCM:", err)
+		fmt.Println("Source: NewChunkCipher()")
+		return nil, err
+	}
+
+	chunk_cipher := &ChunkCipher{aead: aead}
+	copy(chunk_cipher.nonce_prefix[:], iv[:AEAD_NONCE_PREFIX_SIZE])
+	return chunk_cipher, nil
+}
+
+func (c *ChunkCipher) nonce(index uint32, final bool) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, c.nonce_prefix[:])
+	binary.BigEndian.PutUint32(nonce[AEAD_NONCE_PREFIX_SIZE:], index)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func (c *ChunkCipher) Header() []byte {
+	header := make([]byte, AEAD_HEADER_SIZE)
+	header[0] = ENCRYPTION_VERSION_AEAD
+	copy(header[1:], c.nonce_prefix[:])
+	return header
+}
+
+// Checks Version & that Header belongs to this Cipher
+func (c *ChunkCipher) VerifyHeader(header []byte) error {
+	if len(header) != AEAD_HEADER_SIZE {
+		return ErrInvalidEncryptionHeader
+	}
+	if header[0] != ENCRYPTION_VERSION_AEAD {
+		fmt.Println("Encryption Version Received:", header[0])
+		return ErrUnsupportedEncryptionVersion
+	}
+	if string(header[1:]) != string(c.nonce_prefix[:]) {
+		return ErrInvalidEncryptionHeader
+	}
+	return nil
+}
+
+func (c *ChunkCipher) SealChunk(index uint32, plaintext []byte, final bool) []byte {
+	return c.aead.Seal(nil, c.nonce(index, final), plaintext, nil)
+}
+
+func (c *ChunkCipher) OpenChunk(index uint32, sealed []byte, final bool) ([]byte, error) {
+	return c.aead.Open(nil, c.nonce(index, final), sealed, nil)
+}
+
+// Num of Chunks for Plaintext of 'plain_size', Empty Plaintext still has One (Final) Chunk
+func NumChunks(plain_size int64) int64 {
+	return max(1, (plain_size+AEAD_CHUNK-1)/AEAD_CHUNK)
+}
+
+// Size of Encrypted Stream, Header included
+func SealedSize(plain_size int64) int64 {
+	return AEAD_HEADER_SIZE + plain_size + NumChunks(plain_size)*AEAD_TAG_SIZE
+}
+
+// Offset of Sealed Chunk in Encrypted Stream
+func SealedChunkOffset(index int64) int64 {
+	return AEAD_HEADER_SIZE + index*AEAD_SEALED_CHUNK
+}
+
+// Inverse of SealedSize, returns Num of Chunks & Sealed Size of the Final Chunk
+func SealedLayout(sealed_size int64) (int64, int64, error) {
+	body := sealed_size - AEAD_HEADER_SIZE
+	if body < AEAD_TAG_SIZE {
+		return 0, 0, ErrInvalidEncryptionHeader
+	}
+	num_chunks := (body + AEAD_SEALED_CHUNK - 1) / AEAD_SEALED_CHUNK
+	last_chunk_size := body - (num_chunks-1)*AEAD_SEALED_CHUNK
+	if last_chunk_size < AEAD_TAG_SIZE {
+		return 0, 0, ErrInvalidEncryptionHeader
+	}
+	return num_chunks, last_chunk_size, nil
+}
+
+// Seals Chunks of Plaintext from 'reader' into 'writer', from Chunk 'start_index' till 'end_index' (Excluded)
+// 'reader' should already be at Offset 'start_index * AEAD_CHUNK'
+func SealStream(writer io.Writer, reader io.Reader, chunk_cipher *ChunkCipher, plain_size, start_index, end_index int64) error {
+	num_chunks := NumChunks(plain_size)
+	buffer := make([]byte, AEAD_CHUNK)
+
+	for index := start_index; index < min(end_index, num_chunks); index++ {
+		chunk_size := min(AEAD_CHUNK, plain_size-index*AEAD_CHUNK)
+		if _, err := io.ReadFull(reader, buffer[:chunk_size]); err != nil {
+			fmt.Println("Error while Reading Plaintext Chunk:", err)
+			fmt.Println("Source: SealStream()")
+			return err
+		}
+
+		sealed := chunk_cipher.SealChunk(uint32(index), buffer[:chunk_size], index == num_chunks-1)
+		if _, err := writer.Write(sealed); err != nil {
+			fmt.Println("Error while Writing Sealed Chunk:", err)
+			fmt.Println("Source: SealStream()")
+			return err
+		}
+	}
+	return nil
+}
+
+func EncryptZipFileAndStore(zipped_filepath, zip_enc_path string, key, iv []byte) error {
+	zipped_filepath_obj, err := os.Open(zipped_filepath)
+	if err != nil {
+		fmt.Println("Failed to Open Zipped File:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+	defer zipped_filepath_obj.Close()
+
+	file_info, err := zipped_filepath_obj.Stat()
+	if err != nil {
+		fmt.Println("Failed to Get FileInfo of Zipped File:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+
+	chunk_cipher, err := NewChunkCipher(key, iv)
+	if err != nil {
+		fmt.Println("Failed to Create Chunk Cipher:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+
+	zip_enc_file_obj, err := os.Create(zip_enc_path)
+	if err != nil {
+		fmt.Println("Failed to Create & Open Enc Zipped File:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+	defer zip_enc_file_obj.Close()
+
+	reader := bufio.NewReader(zipped_filepath_obj)
+	writer := bufio.NewWriterSize(zip_enc_file_obj, FLUSH_AFTER_EVERY_X_MB)
+
+	if _, err = writer.Write(chunk_cipher.Header()); err != nil {
+		fmt.Println("Failed to Write Header to File:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+
+	// Reading from Zip File, Encrypting it & Writing it to Enc Zip File
+	if err = SealStream(writer, reader, chunk_cipher, file_info.Size(), 0, NumChunks(file_info.Size())); err != nil {
+		fmt.Println("Failed to Encrypt Zip File:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+
+	// Flush buffer to disk at end
+	err = writer.Flush()
+	if err != nil {
+		fmt.Println("Error flushing 'writer' buffer:", err)
+		fmt.Println("Soure: EncryptZipFileAndStore()")
+		return err
+	}
+	zipped_filepath_obj.Close() // Close Obj now, so we can delete zip file
+	zip_enc_file_obj.Close()
+
+	// Removing Zip File
+	err = os.Remove(zipped_filepath)
+	if err != nil {
+		fmt.Println("Error deleting zip file:", err)
+		fmt.Println("Source: EncryptZipFileAndStore()")
+		return err
+	}
+	return nil
+}
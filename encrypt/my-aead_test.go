@@ -0,0 +1,253 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newTestChunkCipher(t *testing.T) *ChunkCipher {
+	t.Helper()
+	key, iv := make([]byte, 32), make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	chunk_cipher, err := NewChunkCipher(key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunk_cipher
+}
+
+func randomPlaintext(t *testing.T, size int64) []byte {
+	t.Helper()
+	plaintext := make([]byte, size)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
+// Header & every Chunk of 'plaintext', as EncryptZipFileAndStore() Writes them
+func sealTestStream(t *testing.T, chunk_cipher *ChunkCipher, plaintext []byte) []byte {
+	t.Helper()
+	var stream bytes.Buffer
+	stream.Write(chunk_cipher.Header())
+	plain_size := int64(len(plaintext))
+	if err := SealStream(&stream, bytes.NewReader(plaintext), chunk_cipher, plain_size, 0, NumChunks(plain_size)); err != nil {
+		t.Fatal(err)
+	}
+	return stream.Bytes()
+}
+
+// Opens Sealed Chunks from 'start_index' on, as Listener does in ws.fetchRange()
+func openTestChunks(chunk_cipher *ChunkCipher, body []byte, start_index, num_chunks, last_chunk_size int64) ([]byte, error) {
+	plaintext := []byte{}
+	for index := start_index; index < num_chunks; index++ {
+		is_final := index == num_chunks-1
+		sealed_size := int64(AEAD_SEALED_CHUNK)
+		if is_final {
+			sealed_size = last_chunk_size
+		}
+		if int64(len(body)) < sealed_size {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		chunk, err := chunk_cipher.OpenChunk(uint32(index), body[:sealed_size], is_final)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = append(plaintext, chunk...)
+		body = body[sealed_size:]
+	}
+	if len(body) != 0 {
+		return nil, errors.New("trailing data after final chunk")
+	}
+	return plaintext, nil
+}
+
+// Layout is Derived from what's Received, so a Stream Cut at a Chunk Boundary has to Fail too
+func openTestStream(chunk_cipher *ChunkCipher, stream []byte) ([]byte, error) {
+	if len(stream) < AEAD_HEADER_SIZE {
+		return nil, ErrInvalidEncryptionHeader
+	}
+	if err := chunk_cipher.VerifyHeader(stream[:AEAD_HEADER_SIZE]); err != nil {
+		return nil, err
+	}
+	num_chunks, last_chunk_size, err := SealedLayout(int64(len(stream)))
+	if err != nil {
+		return nil, err
+	}
+	return openTestChunks(chunk_cipher, stream[AEAD_HEADER_SIZE:], 0, num_chunks, last_chunk_size)
+}
+
+func TestSealStreamRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		plain_size int64
+		num_chunks int64
+	}{
+		{"empty", 0, 1},
+		{"one byte", 1, 1},
+		{"one full chunk", AEAD_CHUNK, 1},
+		{"one chunk and a byte", AEAD_CHUNK + 1, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunk_cipher := newTestChunkCipher(t)
+			plaintext := randomPlaintext(t, test.plain_size)
+
+			stream := sealTestStream(t, chunk_cipher, plaintext)
+			if int64(len(stream)) != SealedSize(test.plain_size) {
+				t.Fatalf("Sealed Size is %d, want %d", len(stream), SealedSize(test.plain_size))
+			}
+			if NumChunks(test.plain_size) != test.num_chunks {
+				t.Fatalf("Num of Chunks is %d, want %d", NumChunks(test.plain_size), test.num_chunks)
+			}
+
+			opened, err := openTestStream(chunk_cipher, stream)
+			if err != nil {
+				t.Fatal("Error while Opening Stream:", err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Fatal("Opened Plaintext doesn't Match")
+			}
+		})
+	}
+}
+
+func TestOpenChunkRejectsTamperedStreams(t *testing.T) {
+	// Three Chunks, Last one Partial
+	plain_size := int64(2*AEAD_CHUNK + 100)
+
+	tests := []struct {
+		name   string
+		tamper func(stream []byte) []byte
+		want   error // Checked only if Set
+	}{
+		{
+			name:   "truncated final chunk",
+			tamper: func(stream []byte) []byte { return stream[:len(stream)-1] },
+		},
+		{
+			name:   "final chunk dropped",
+			tamper: func(stream []byte) []byte { return stream[:SealedChunkOffset(2)] },
+		},
+		{
+			name: "chunks reordered",
+			tamper: func(stream []byte) []byte {
+				chunk_0 := bytes.Clone(stream[SealedChunkOffset(0):SealedChunkOffset(1)])
+				chunk_1 := bytes.Clone(stream[SealedChunkOffset(1):SealedChunkOffset(2)])
+				copy(stream[SealedChunkOffset(0):], chunk_1)
+				copy(stream[SealedChunkOffset(1):], chunk_0)
+				return stream
+			},
+		},
+		{
+			name: "bit flipped in chunk",
+			tamper: func(stream []byte) []byte {
+				stream[SealedChunkOffset(1)+10] ^= 0x01
+				return stream
+			},
+		},
+		{
+			name: "bit flipped in tag",
+			tamper: func(stream []byte) []byte {
+				stream[len(stream)-1] ^= 0x80
+				return stream
+			},
+		},
+		{
+			name: "wrong version byte",
+			tamper: func(stream []byte) []byte {
+				stream[0] = ENCRYPTION_VERSION_CTR
+				return stream
+			},
+			want: ErrUnsupportedEncryptionVersion,
+		},
+		{
+			name: "nonce prefix of another stream",
+			tamper: func(stream []byte) []byte {
+				stream[1] ^= 0xFF
+				return stream
+			},
+			want: ErrInvalidEncryptionHeader,
+		},
+		{
+			name:   "header only",
+			tamper: func(stream []byte) []byte { return stream[:AEAD_HEADER_SIZE] },
+			want:   ErrInvalidEncryptionHeader,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunk_cipher := newTestChunkCipher(t)
+			stream := sealTestStream(t, chunk_cipher, randomPlaintext(t, plain_size))
+
+			_, err := openTestStream(chunk_cipher, test.tamper(stream))
+			if err == nil {
+				t.Fatal("Tampered Stream was Opened")
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Fatalf("Error is %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSealStreamResumesAtChunkOffset(t *testing.T) {
+	tests := []struct {
+		name        string
+		plain_size  int64
+		start_index int64
+	}{
+		{"second chunk", 2*AEAD_CHUNK + 100, 1},
+		{"final partial chunk", 2*AEAD_CHUNK + 100, 2},
+		{"final full chunk", 3 * AEAD_CHUNK, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunk_cipher := newTestChunkCipher(t)
+			plaintext := randomPlaintext(t, test.plain_size)
+			num_chunks := NumChunks(test.plain_size)
+
+			// Sender Seeks to the Resume Offset & Seals only the Remaining Chunks
+			var resumed bytes.Buffer
+			reader := bytes.NewReader(plaintext[test.start_index*AEAD_CHUNK:])
+			if err := SealStream(&resumed, reader, chunk_cipher, test.plain_size, test.start_index, num_chunks); err != nil {
+				t.Fatal(err)
+			}
+
+			// Resumed Chunks're the same Bytes as in the Full Stream, so both Halves Fit together
+			full_stream := sealTestStream(t, chunk_cipher, plaintext)
+			if !bytes.Equal(resumed.Bytes(), full_stream[SealedChunkOffset(test.start_index):]) {
+				t.Fatal("Resumed Chunks don't Match Chunks of Full Stream")
+			}
+
+			num, last_chunk_size, err := SealedLayout(SealedSize(test.plain_size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opened, err := openTestChunks(chunk_cipher, resumed.Bytes(), test.start_index, num, last_chunk_size)
+			if err != nil {
+				t.Fatal("Error while Opening Resumed Stream:", err)
+			}
+			if !bytes.Equal(opened, plaintext[test.start_index*AEAD_CHUNK:]) {
+				t.Fatal("Opened Plaintext of Resumed Stream doesn't Match")
+			}
+
+			// Chunks Opened at the Wrong Index must Fail
+			if _, err = openTestChunks(chunk_cipher, resumed.Bytes(), test.start_index-1, num-1, last_chunk_size); err == nil {
+				t.Fatal("Resumed Stream was Opened at the Wrong Chunk Offset")
+			}
+		})
+	}
+}
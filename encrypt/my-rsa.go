@@ -1,6 +1,7 @@
 package encrypt
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -126,6 +127,60 @@ func RSAEncryptData(data string, publicPemBock string) (string, error) {
 	return base64Encrypted, nil
 }
 
+// Signs SHA-256 of 'data' with My Private Key (RSA-PSS), Signature is base64 Encoded
+func RSASignData(data []byte) (string, error) {
+	block, _ := pem.Decode([]byte(loadPrivateKey()))
+	if block == nil {
+		fmt.Println("Error while Parsing, Pem Block is nil")
+		fmt.Println("Pls check if the provided Private Key is correct")
+		fmt.Println("Source: RSASignData()")
+		return "", errors.New("error in retrieving the Pem Block")
+	}
+
+	privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		fmt.Println("Error while parsing the Private Key:", err)
+		fmt.Println("Source: RSASignData()")
+		return "", err
+	}
+
+	hashed := sha256.Sum256(data)
+	signature, err := rsa.SignPSS(rand.Reader, privKey, crypto.SHA256, hashed[:], nil)
+	if err != nil {
+		fmt.Println("Error while Signing Data:", err)
+		fmt.Println("Source: RSASignData()")
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func RSAVerifySignature(data []byte, signature string, publicPemBock string) error {
+	block, _ := pem.Decode([]byte(publicPemBock))
+	if block == nil {
+		fmt.Println("Error while Parsing, Pem Block is nil")
+		fmt.Println("Pls check if the provided Public Key is correct")
+		fmt.Println("Source: RSAVerifySignature()")
+		return errors.New("error in retrieving the Pem Block")
+	}
+
+	publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		fmt.Println("Error while parsing the Public Key:", err)
+		fmt.Println("Source: RSAVerifySignature()")
+		return err
+	}
+
+	signature_bytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		fmt.Println("Error while Decoding Signature from base64:", err)
+		fmt.Println("Source: RSAVerifySignature()")
+		return err
+	}
+
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPSS(publicKey, crypto.SHA256, hashed[:], signature_bytes, nil)
+}
+
 func GetPublicKey(path string) string {
 	key, err := os.ReadFile(path)
 	if err != nil {
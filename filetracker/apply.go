@@ -0,0 +1,332 @@
+package filetracker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Pulled Updates're Applied in 3 Steps, so a Crash never leaves Workspace half Old & half New
+//  1. Updated Files're Moved into .PKr/Staging/New & Synced, then Journal is Written
+//  2. Old Versions're Moved into .PKr/Staging/Backup & New ones Renamed into place
+//  3. Local Versions of Conflicting Files're Moved into .PKr/Conflicts/<Push Num>,
+//     Manifest, Tree & Last Push Num're Stored, then Journal & Staging're Removed
+//
+// If Journal is Present on Startup, Apply is Finished, or Rolled Back if that Fails
+var (
+	APPLY_JOURNAL_REL_PATH = filepath.Join(".PKr", "apply-journal.json")
+	STAGING_REL_PATH       = filepath.Join(".PKr", "Staging")
+)
+
+var ErrApplyRolledBack = errors.New("applying updates failed, workspace was rolled back")
+
+type ApplyJournal struct {
+	WorkspaceName string                     `json:"workspace_name"`
+	BasePushNum   int                        `json:"base_push_num"` // Push Workspace is at, Local Modifications're Detected against it
+	PushNum       int                        `json:"push_num"`      // Stored as Last Push Num once Applied
+	Changes       map[string]string          `json:"changes"`       // {"fileA": "Updated", "fileB": "Removed"}
+	Conflicts     []string                   `json:"conflicts,omitempty"`
+	Manifest      *models.SignedPushManifest `json:"manifest,omitempty"`
+	Tree          *config.FileTree           `json:"tree,omitempty"` // Hashes of Files at Push Num, see buildPushTree()
+}
+
+func getJournalPath(workspace_path string) string {
+	return filepath.Join(workspace_path, APPLY_JOURNAL_REL_PATH)
+}
+
+func getStagingPaths(workspace_path string) (string, string) {
+	staging_path := filepath.Join(workspace_path, STAGING_REL_PATH)
+	return filepath.Join(staging_path, "New"), filepath.Join(staging_path, "Backup")
+}
+
+func toLocalPath(rel_path string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ReplaceAll(rel_path, "/", "\\")
+	}
+	return strings.ReplaceAll(rel_path, "\\", "/")
+}
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+func writeApplyJournal(workspace_path string, journal ApplyJournal) error {
+	data, err := json.MarshalIndent(journal, "", "	")
+	if err != nil {
+		return err
+	}
+
+	journal_path := getJournalPath(workspace_path)
+	tmp_path := journal_path + ".tmp"
+	if err = os.WriteFile(tmp_path, data, 0600); err != nil {
+		return err
+	}
+	if err = syncFile(tmp_path); err != nil {
+		return err
+	}
+	return os.Rename(tmp_path, journal_path)
+}
+
+func readApplyJournal(workspace_path string) (ApplyJournal, error) {
+	var journal ApplyJournal
+	data, err := os.ReadFile(getJournalPath(workspace_path))
+	if err != nil {
+		return journal, err
+	}
+	err = json.Unmarshal(data, &journal)
+	return journal, err
+}
+
+// Applies Updates in 'content_path' to Workspace, Files in 'content_path' are Moved, not Copied
+// Returns Files I had Modified Locally, their Local Versions're kept in GetConflictsPath()
+func ApplyUpdatesToWorkspace(workspace_path, content_path string, journal ApplyJournal) ([]string, error) {
+	if err := RecoverInterruptedApply(workspace_path); err != nil {
+		fmt.Println("Error while Recovering Interrupted Apply:", err)
+		fmt.Println("Source: ApplyUpdatesToWorkspace()")
+		return nil, err
+	}
+
+	for rel_path := range journal.Changes {
+		if err := ValidateRelPath(rel_path); err != nil {
+			fmt.Println("Unsafe Path in Updates:", rel_path)
+			fmt.Println("Source: ApplyUpdatesToWorkspace()")
+			return nil, err
+		}
+	}
+
+	base_hashes, err := getBaseFileHashes(workspace_path, journal.BasePushNum)
+	if err != nil {
+		fmt.Println("Hashes of Files at Last Push aren't Known, Local Versions of all Changed Files'll be kept:", err)
+		base_hashes = map[string]string{}
+	}
+
+	conflicts, err := findConflicts(workspace_path, content_path, base_hashes, journal.Changes)
+	if err != nil {
+		fmt.Println("Error while Finding Conflicts:", err)
+		fmt.Println("Source: ApplyUpdatesToWorkspace()")
+		return nil, err
+	}
+	journal.Conflicts = conflicts
+
+	push_tree, err := buildPushTree(base_hashes, content_path, journal.Changes)
+	if err != nil {
+		fmt.Println("Error while Building Tree of Push:", err)
+		fmt.Println("Source: ApplyUpdatesToWorkspace()")
+		return nil, err
+	}
+	journal.Tree = &push_tree
+
+	new_path, _ := getStagingPaths(workspace_path)
+	for rel_path, change_type := range journal.Changes {
+		if change_type != "Updated" {
+			continue
+		}
+		rel_path = toLocalPath(rel_path)
+
+		staged_file := filepath.Join(new_path, rel_path)
+		if err := moveFile(filepath.Join(content_path, rel_path), staged_file); err != nil {
+			fmt.Println("Error while Staging Updated File:", err)
+			fmt.Println("Source: ApplyUpdatesToWorkspace()")
+			os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH))
+			return nil, err
+		}
+		if err := syncFile(staged_file); err != nil {
+			fmt.Println("Error while Syncing Staged File:", err)
+			fmt.Println("Source: ApplyUpdatesToWorkspace()")
+			os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH))
+			return nil, err
+		}
+	}
+
+	// Everything needed to Finish Apply is on Disk from now on
+	if err := writeApplyJournal(workspace_path, journal); err != nil {
+		fmt.Println("Error while Writing Apply Journal:", err)
+		fmt.Println("Source: ApplyUpdatesToWorkspace()")
+		os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH))
+		return nil, err
+	}
+
+	if err := finishApply(workspace_path, journal); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// Finishes Apply described by Journal, if any
+// Every Step can be Repeated, so it's Safe to call after a Crash at any Point
+func RecoverInterruptedApply(workspace_path string) error {
+	journal, err := readApplyJournal(workspace_path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Staging without Journal never touched Workspace
+			return os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH))
+		}
+		fmt.Println("Error while Reading Apply Journal:", err)
+		fmt.Println("Source: RecoverInterruptedApply()")
+		return err
+	}
+
+	fmt.Println("Found Interrupted Apply of Push:", journal.PushNum)
+	return finishApply(workspace_path, journal)
+}
+
+func finishApply(workspace_path string, journal ApplyJournal) error {
+	if err := moveStagedFiles(workspace_path, journal.Changes); err != nil {
+		fmt.Println("Error while Moving Staged Files into Workspace:", err)
+		fmt.Println("Source: finishApply()")
+
+		if rollback_err := rollbackApply(workspace_path, journal.Changes); rollback_err != nil {
+			// Journal is kept, so it's Retried on next Startup
+			fmt.Println("Error while Rolling Back Apply:", rollback_err)
+			fmt.Println("Source: finishApply()")
+			return rollback_err
+		}
+		return ErrApplyRolledBack
+	}
+
+	if err := preserveConflicts(workspace_path, journal); err != nil {
+		fmt.Println("Error while Preserving Conflicting Files:", err)
+		fmt.Println("Source: finishApply()")
+		return err
+	}
+
+	if journal.Manifest != nil {
+		if err := config.WriteManifestFile(workspace_path, *journal.Manifest); err != nil {
+			fmt.Println("Error while Storing Push Manifest:", err)
+			fmt.Println("Source: finishApply()")
+		}
+	}
+
+	// Next Pull Detects Local Modifications against it
+	if journal.Tree != nil {
+		if err := config.WritePushTree(workspace_path, journal.PushNum, *journal.Tree); err != nil {
+			fmt.Println("Error while Storing Tree of Push:", err)
+			fmt.Println("Source: finishApply()")
+			return err
+		}
+	}
+
+	if err := config.UpdateLastPushNumInGetWorkspaceFolderToUserConfig(journal.WorkspaceName, journal.PushNum); err != nil {
+		fmt.Println("Error while Updating Last Push Num:", err)
+		fmt.Println("Source: finishApply()")
+		return err
+	}
+
+	if err := os.Remove(getJournalPath(workspace_path)); err != nil {
+		fmt.Println("Error while Removing Apply Journal:", err)
+		fmt.Println("Source: finishApply()")
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH)); err != nil {
+		fmt.Println("Error while Removing Staging Dir:", err)
+		fmt.Println("Source: finishApply()")
+	}
+
+	if journal.BasePushNum != journal.PushNum {
+		if err := config.RemovePushTree(workspace_path, journal.BasePushNum); err != nil {
+			fmt.Println("Error while Removing Tree of Last Push:", err)
+			fmt.Println("Source: finishApply()")
+		}
+	}
+
+	if err := ClearEmptyDir(workspace_path); err != nil {
+		fmt.Printf("failed to clear empty dirs in '%s' dir: %v\n", workspace_path, err)
+		fmt.Println("Ignorning this Error")
+	}
+	return nil
+}
+
+// A File still in Staging/New hasn't been Moved into Workspace yet
+func moveStagedFiles(workspace_path string, changes map[string]string) error {
+	new_path, backup_path := getStagingPaths(workspace_path)
+	for rel_path, change_type := range changes {
+		workspace_file, err := SafeJoin(workspace_path, rel_path)
+		if err != nil {
+			return fmt.Errorf("unsafe path %s: %v", rel_path, err)
+		}
+		rel_path = toLocalPath(rel_path)
+		staged_file := filepath.Join(new_path, rel_path)
+		backup_file := filepath.Join(backup_path, rel_path)
+
+		switch change_type {
+		case "Removed":
+			if pathExists(workspace_file) {
+				if err := moveFile(workspace_file, backup_file); err != nil {
+					return fmt.Errorf("failed to remove %s: %v", workspace_file, err)
+				}
+			}
+
+		case "Updated":
+			if !pathExists(staged_file) {
+				continue
+			}
+			if pathExists(workspace_file) && !pathExists(backup_file) {
+				if err := moveFile(workspace_file, backup_file); err != nil {
+					return fmt.Errorf("failed to back up %s: %v", workspace_file, err)
+				}
+			}
+			if err := moveFile(staged_file, workspace_file); err != nil {
+				return fmt.Errorf("failed to update %s: %v", rel_path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Puts Backed Up Files back & Removes New ones, then Discards Journal & Staging
+func rollbackApply(workspace_path string, changes map[string]string) error {
+	new_path, backup_path := getStagingPaths(workspace_path)
+	for rel_path, change_type := range changes {
+		// Unsafe Paths were never Touched
+		workspace_file, err := SafeJoin(workspace_path, rel_path)
+		if err != nil {
+			continue
+		}
+		rel_path = toLocalPath(rel_path)
+		backup_file := filepath.Join(backup_path, rel_path)
+
+		if pathExists(backup_file) {
+			if err := moveFile(backup_file, workspace_file); err != nil {
+				return fmt.Errorf("failed to restore %s: %v", workspace_file, err)
+			}
+			continue
+		}
+
+		// Created File which was already Moved into Workspace
+		if change_type == "Updated" && !pathExists(filepath.Join(new_path, rel_path)) {
+			if err := os.Remove(workspace_file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %v", workspace_file, err)
+			}
+		}
+	}
+
+	if err := os.Remove(getJournalPath(workspace_path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(workspace_path, STAGING_REL_PATH))
+}
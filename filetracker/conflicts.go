@@ -0,0 +1,149 @@
+package filetracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Local Versions of Conflicting Files're kept at .PKr/Conflicts/<Push Num>/<File Path>
+func GetConflictsPath(workspace_path string, push_num int) string {
+	return filepath.Join(workspace_path, ".PKr", "Conflicts", strconv.Itoa(push_num))
+}
+
+// Hashes of Files as they were at 'base_push_num', from its Recorded Tree, see config.ReadPushTree()
+// Workspaces Pulled before Trees were Recorded only have Manifest of that Push
+func getBaseFileHashes(workspace_path string, base_push_num int) (map[string]string, error) {
+	base_hashes := map[string]string{}
+	// Nothing is Pulled yet
+	if base_push_num < 0 {
+		return base_hashes, nil
+	}
+
+	file_tree, err := config.ReadPushTree(workspace_path, base_push_num)
+	if err == nil {
+		for _, node := range file_tree.Nodes {
+			base_hashes[node.FilePath] = node.Hash
+		}
+		return base_hashes, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	signed_manifest, err := config.ReadManifestFile(workspace_path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest models.PushManifest
+	if err = json.Unmarshal(signed_manifest.Manifest, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.PushNum != base_push_num {
+		return nil, fmt.Errorf("manifest is of push %d, not %d", manifest.PushNum, base_push_num)
+	}
+
+	for _, file := range manifest.Files {
+		base_hashes[file.FilePath] = file.Hash
+	}
+	return base_hashes, nil
+}
+
+// Tree of the Push being Applied, 'base_hashes' with 'changes' made to them
+// Updated Files're Hashed in 'content_path', so it's Built before they're Staged
+func buildPushTree(base_hashes map[string]string, content_path string, changes map[string]string) (config.FileTree, error) {
+	hashes := maps.Clone(base_hashes)
+	for rel_path, change_type := range changes {
+		switch change_type {
+		case "Removed":
+			delete(hashes, rel_path)
+		case "Updated":
+			hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(filepath.Join(content_path, toLocalPath(rel_path)))
+			if err != nil {
+				fmt.Println("Error while Generating Hash of Updated File:", err)
+				fmt.Println("Source: buildPushTree()")
+				return config.FileTree{}, err
+			}
+			hashes[rel_path] = hash
+		}
+	}
+
+	file_tree := config.FileTree{Nodes: []config.Node{}}
+	for _, rel_path := range slices.Sorted(maps.Keys(hashes)) {
+		file_tree.Nodes = append(file_tree.Nodes, config.Node{FilePath: rel_path, Hash: hashes[rel_path]})
+	}
+	return file_tree, nil
+}
+
+// A File is in Conflict if I've Modified, Created or Deleted it since 'base_hashes' were Recorded
+// and the Pull would Overwrite it, or Update it after I Deleted it
+// Without 'base_hashes', every Local File the Pull would Change is taken as Modified, & Deletes can't be Told apart from Files never Pulled
+func findConflicts(workspace_path, content_path string, base_hashes map[string]string, changes map[string]string) ([]string, error) {
+	conflicts := []string{}
+	for rel_path, change_type := range changes {
+		workspace_file, err := SafeJoin(workspace_path, rel_path)
+		if err != nil {
+			return nil, err
+		}
+		base_hash, in_base := base_hashes[rel_path]
+
+		if !pathExists(workspace_file) {
+			// Deleted Locally, while the Pull brings a newer Version back
+			if in_base && change_type == "Updated" {
+				conflicts = append(conflicts, rel_path)
+			}
+			continue
+		}
+
+		local_hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(workspace_file)
+		if err != nil {
+			fmt.Println("Error while Generating Hash of Local File:", err)
+			fmt.Println("Source: findConflicts()")
+			return nil, err
+		}
+		if in_base && local_hash == base_hash {
+			continue
+		}
+
+		// Same Edit as in the Pull, nothing would be Lost
+		if change_type == "Updated" {
+			new_hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(filepath.Join(content_path, toLocalPath(rel_path)))
+			if err == nil && new_hash == local_hash {
+				continue
+			}
+		}
+		conflicts = append(conflicts, rel_path)
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+// Backed Up Local Versions of Conflicting Files're Moved out of Staging, before it's Removed
+func preserveConflicts(workspace_path string, journal ApplyJournal) error {
+	_, backup_path := getStagingPaths(workspace_path)
+	conflicts_path := GetConflictsPath(workspace_path, journal.PushNum)
+
+	for _, rel_path := range journal.Conflicts {
+		rel_path = toLocalPath(rel_path)
+		backup_file := filepath.Join(backup_path, rel_path)
+		if !pathExists(backup_file) {
+			continue
+		}
+		if err := moveFile(backup_file, filepath.Join(conflicts_path, rel_path)); err != nil {
+			fmt.Println("Error while Moving Conflicting File:", err)
+			fmt.Println("Source: preserveConflicts()")
+			return err
+		}
+	}
+	return nil
+}
@@ -4,29 +4,64 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
 
+	"github.com/PKr-Parivar/PKr-Base/config"
 	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/ignore"
 )
 
-// Delete files and folders in the Workspace Except: /.PKr , PKr-base.exe, PKr-cli.exe
+// Delete files and folders in the Workspace Except: /.PKr & Ignored Paths (.pkrignore)
 func CleanFilesFromWorkspace(workspace_path string) error {
-	files, err := ioutil.ReadDir(workspace_path)
+	matcher, err := config.LoadIgnoreMatcher(workspace_path)
 	if err != nil {
+		fmt.Println("Error while Loading Ignore Patterns:", err)
+		fmt.Println("Source: CleanFilesFromWorkspace()")
+		return err
+	}
+
+	if err = cleanDir(matcher, workspace_path, ""); err != nil {
 		fmt.Println("Error while Cleaning Files from Workspace:", err)
 		fmt.Println("Source: CleanFilesFromWorkspace()")
 		return err
 	}
+	return nil
+}
+
+// Dirs having Ignored Files are Kept, only their other Contents are Removed
+func cleanDir(matcher *ignore.Matcher, workspace_path, rel_dir_path string) error {
+	files, err := os.ReadDir(filepath.Join(workspace_path, rel_dir_path))
+	if err != nil {
+		return err
+	}
 
 	for _, file := range files {
-		if file.Name() != ".PKr" && file.Name() != "PKr-Base.exe" && file.Name() != "PKr-Cli.exe" && file.Name() != "PKr-Base" && file.Name() != "PKr-Cli" {
-			if err = os.RemoveAll(path.Join([]string{workspace_path, file.Name()}...)); err != nil {
+		rel_path := filepath.Join(rel_dir_path, file.Name())
+		if matcher.Match(rel_path, file.IsDir()) {
+			continue
+		}
+
+		abs_path := filepath.Join(workspace_path, rel_path)
+		if !file.IsDir() {
+			if err = os.Remove(abs_path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = cleanDir(matcher, workspace_path, rel_path); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(abs_path)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err = os.Remove(abs_path); err != nil {
 				return err
 			}
 		}
@@ -50,13 +85,26 @@ func SaveDataToFile(data []byte, dest string) error {
 func FolderTree(folder_path string) (map[string]string, error) {
 	result := make(map[string]string)
 
-	err := filepath.Walk(folder_path, func(path string, info os.FileInfo, err error) error {
+	matcher, err := config.LoadIgnoreMatcher(folder_path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(folder_path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if info.Name() == ".PKr" || info.Name() == "PKr-Base.exe" || info.Name() == "PKr-Cli.exe" || info.Name() == "PKr-Base" || info.Name() == "PKr-Cli" {
-			return filepath.SkipDir
+		relPath, err := filepath.Rel(folder_path, path)
+		if err != nil {
+			return err
+		}
+
+		if matcher.Match(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 		if info.IsDir() {
 			return nil
@@ -72,11 +120,6 @@ func FolderTree(folder_path string) (map[string]string, error) {
 			return err
 		}
 
-		relPath, err := filepath.Rel(folder_path, path)
-		if err != nil {
-			return err
-		}
-
 		result[relPath] = hash
 		return nil
 	})
@@ -156,64 +199,3 @@ func isDirEmpty(name string) (bool, error) {
 	}
 	return false, err
 }
-
-func UpdateFilesFromWorkspace(workspace_path string, content_path string, changes map[string]string) error {
-	for rel_path, change_type := range changes {
-		if runtime.GOOS == "windows" {
-			rel_path = strings.ReplaceAll(rel_path, "/", "\\")
-		} else {
-			rel_path = strings.ReplaceAll(rel_path, "\\", "/")
-		}
-
-		workspace_file := filepath.Join(workspace_path, rel_path)
-
-		switch change_type {
-		case "Removed":
-			err := os.Remove(workspace_file)
-			if err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("failed to remove %s: %v", workspace_file, err)
-			}
-
-			err = ClearEmptyDir(workspace_path)
-			if err != nil && !os.IsNotExist(err) {
-				fmt.Printf("failed to clear empty dirs in '%s' dir: %v\n", workspace_path, err)
-				fmt.Println("Ignorning this Error")
-			}
-
-		case "Updated":
-			source_file := filepath.Join(content_path, rel_path)
-
-			// Make sure the parent directory exists
-			if err := os.MkdirAll(filepath.Dir(workspace_file), 0755); err != nil {
-				return fmt.Errorf("failed to create directory for %s: %v", workspace_file, err)
-			}
-
-			err := copyFile(source_file, workspace_file)
-			if err != nil {
-				return fmt.Errorf("failed to update %s: %v", rel_path, err)
-			}
-		}
-	}
-	return nil
-}
-
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-	if err != nil {
-		return err
-	}
-
-	return out.Sync() // ensure file is fully written
-}
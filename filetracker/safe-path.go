@@ -0,0 +1,110 @@
+package filetracker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/PKr-Parivar/PKr-Base/ignore"
+)
+
+var ErrUnsafePath = errors.New("path escapes workspace or isn't allowed")
+
+// Names Windows treats as Devices, with or without an Extension
+var RESERVED_NAMES = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Names Invalid on Windows're only Rejected there, Tests Enable it elsewhere
+var check_windows_names = runtime.GOOS == "windows"
+
+// Paths in Zips & Updates come from other Users, they must stay inside Workspace & out of .PKr
+// Both '/' & '\' are treated as Separators, as the Sender may be on another OS
+func ValidateRelPath(rel_path string) error {
+	if rel_path == "" || strings.ContainsRune(rel_path, 0) {
+		return ErrUnsafePath
+	}
+	if filepath.IsAbs(rel_path) || filepath.VolumeName(rel_path) != "" || rel_path[0] == '/' || rel_path[0] == '\\' {
+		return ErrUnsafePath
+	}
+	// Drive Letter Paths, i.e., "C:\file" or "C:file", are Absolute for a Windows Receiver
+	if len(rel_path) >= 2 && rel_path[1] == ':' && isDriveLetter(rel_path[0]) {
+		return ErrUnsafePath
+	}
+
+	segments := strings.FieldsFunc(rel_path, func(c rune) bool {
+		return c == '/' || c == '\\'
+	})
+	if len(segments) == 0 || strings.EqualFold(segments[0], ignore.PKR_DIR_NAME) {
+		return ErrUnsafePath
+	}
+
+	for _, segment := range segments {
+		if segment == "." || segment == ".." {
+			return ErrUnsafePath
+		}
+		if check_windows_names && !isValidWindowsName(segment) {
+			return ErrUnsafePath
+		}
+	}
+	return nil
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Such Names're Fine elsewhere, but on Windows they Open Devices or Alias other Files
+func isValidWindowsName(segment string) bool {
+	// Alternate Data Streams, i.e., "file:stream"
+	if strings.ContainsRune(segment, ':') {
+		return false
+	}
+	// Trailing Dots & Spaces're Dropped, so "a.." or "b " would be "a" or "b"
+	if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") {
+		return false
+	}
+
+	base_name := strings.ToUpper(strings.SplitN(segment, ".", 2)[0])
+	return !RESERVED_NAMES[strings.TrimRight(base_name, " ")]
+}
+
+// Joins 'rel_path' onto 'root' after Validating it
+// Existing Parent Dirs mustn't be Symlinks pointing outside 'root'
+func SafeJoin(root, rel_path string) (string, error) {
+	if err := ValidateRelPath(rel_path); err != nil {
+		return "", err
+	}
+	abs_path := filepath.Join(root, toLocalPath(rel_path))
+
+	real_root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	// Deepest Existing Parent decides where the File actually Lands
+	parent := filepath.Dir(abs_path)
+	for {
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+		if parent == root || filepath.Dir(parent) == parent {
+			return abs_path, nil
+		}
+		parent = filepath.Dir(parent)
+	}
+
+	real_parent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(real_root, real_parent)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrUnsafePath
+	}
+	return abs_path, nil
+}
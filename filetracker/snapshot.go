@@ -0,0 +1,312 @@
+package filetracker
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+)
+
+// Compressed Files Larger than this're kept in Temp Files till they're Written into Zip
+const SNAPSHOT_MEMORY_LIMIT = 4 * 1024 * 1024
+
+// Compressing these again only costs CPU, so they're Stored as they are
+var ALREADY_COMPRESSED_EXTS = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".avi": true, ".webm": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true, ".m4a": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".zst": true,
+	".jar": true, ".apk": true, ".docx": true, ".xlsx": true, ".pptx": true, ".woff2": true,
+}
+
+// Compressed Entry waiting to be Written into Zip, in Memory or in 'tmp_path'
+type snapshotEntry struct {
+	header   *zip.FileHeader
+	hash     string
+	data     []byte
+	tmp_path string
+	skipped  bool // Isn't a Regular File anymore
+	err      error
+}
+
+// Builds Zip of Workspace along with its File Tree, reading every File only once
+// Files're Compressed Concurrently (like GetNewTree() Hashes them) & Written in Order
+// Partial Zip is Removed on Error, so an Incomplete Push is never Published
+func BuildSnapshot(workspace_path, destination_path, zip_file_name string) (file_tree config.FileTree, err error) {
+	file_paths, err := config.FetchAllFilesPaths(workspace_path)
+	if err != nil {
+		fmt.Println("Error while Getting all File Paths from the Folder:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+
+	if err = os.MkdirAll(destination_path, 0700); err != nil {
+		fmt.Println("Error creating destination directory:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+
+	full_zip_path := filepath.Join(destination_path, zip_file_name+".zip")
+	zip_file, err := os.Create(full_zip_path)
+	if err != nil {
+		fmt.Println("Error while Creating Zip File:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+
+	tmp_dir, err := os.MkdirTemp(destination_path, zip_file_name+"-parts-")
+	if err != nil {
+		zip_file.Close()
+		os.Remove(full_zip_path)
+		fmt.Println("Error while Creating Temp Dir for Snapshot:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+
+	n_files := len(file_paths)
+	entries := make([]chan snapshotEntry, n_files)
+	for i := range entries {
+		entries[i] = make(chan snapshotEntry, 1)
+	}
+
+	// Workers Pick Files in Order & at most 'window' Compressed Files wait to be Written,
+	// so Memory stays Bounded however Large the Workspace is
+	num_workers := max(1, min(runtime.NumCPU()*2, n_files))
+	window := make(chan struct{}, num_workers*4)
+	jobs := make(chan int)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < num_workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				entries[idx] <- compressFile(file_paths[idx], tmp_dir)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for idx := range file_paths {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- idx:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		close(stop)
+		wg.Wait()
+		os.RemoveAll(tmp_dir)
+		zip_file.Close()
+		if err != nil {
+			os.Remove(full_zip_path)
+		}
+	}()
+
+	writer := zip.NewWriter(zip_file)
+	nodes := make([]config.Node, 0, n_files)
+	for idx := range file_paths {
+		entry := <-entries[idx]
+		<-window
+		if entry.err != nil {
+			fmt.Println("Error while Compressing File:", entry.err)
+			fmt.Println("Source: BuildSnapshot()")
+			return config.FileTree{}, entry.err
+		}
+		if entry.skipped {
+			fmt.Println("Skipping File which isn't a Regular File:", file_paths[idx].RelFilePath)
+			continue
+		}
+
+		if err = writeSnapshotEntry(writer, entry); err != nil {
+			fmt.Println("Error while Writing File into Zip:", err)
+			fmt.Println("Source: BuildSnapshot()")
+			return config.FileTree{}, err
+		}
+		nodes = append(nodes, config.Node{FilePath: file_paths[idx].RelFilePath, Hash: entry.hash})
+	}
+
+	if err = writer.Close(); err != nil {
+		fmt.Println("Error while Closing zip writer:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+
+	if err = zip_file.Sync(); err != nil {
+		fmt.Println("Error while Syncing Zip File:", err)
+		fmt.Println("Source: BuildSnapshot()")
+		return config.FileTree{}, err
+	}
+	return config.FileTree{Nodes: nodes}, nil
+}
+
+// Hashes & Compresses File in a single Read
+// File may have been Replaced since it was Listed, Opening a FIFO would Block, so it's Checked first
+func compressFile(file_path config.FilePath, tmp_dir string) snapshotEntry {
+	link_info, err := os.Lstat(file_path.FilePath)
+	if err != nil {
+		return snapshotEntry{err: err}
+	}
+	if !link_info.Mode().IsRegular() {
+		return snapshotEntry{skipped: true}
+	}
+
+	src_file, err := os.Open(file_path.FilePath)
+	if err != nil {
+		return snapshotEntry{err: err}
+	}
+	defer src_file.Close()
+
+	file_info, err := src_file.Stat()
+	if err != nil {
+		return snapshotEntry{err: err}
+	}
+	if !file_info.Mode().IsRegular() {
+		return snapshotEntry{skipped: true}
+	}
+
+	header, err := zip.FileInfoHeader(file_info)
+	if err != nil {
+		return snapshotEntry{err: err}
+	}
+	header.Name = file_path.RelFilePath
+	header.Method = zip.Deflate
+	if ALREADY_COMPRESSED_EXTS[strings.ToLower(filepath.Ext(file_path.FilePath))] {
+		header.Method = zip.Store
+	}
+
+	// Spills into a Temp File once it grows past SNAPSHOT_MEMORY_LIMIT
+	output := &spillBuffer{tmp_dir: tmp_dir}
+	defer output.closeFile()
+
+	sha_hash := sha256.New()
+	crc_hash := crc32.NewIEEE()
+	var dst io.Writer = output
+	var compressor *flate.Writer
+	if header.Method == zip.Deflate {
+		compressor, err = flate.NewWriter(output, flate.DefaultCompression)
+		if err != nil {
+			return snapshotEntry{err: err}
+		}
+		dst = compressor
+	}
+
+	n, err := io.Copy(io.MultiWriter(dst, sha_hash, crc_hash), src_file)
+	if err != nil {
+		output.remove()
+		return snapshotEntry{err: err}
+	}
+	if compressor != nil {
+		if err = compressor.Close(); err != nil {
+			output.remove()
+			return snapshotEntry{err: err}
+		}
+	}
+	if err = output.closeFile(); err != nil {
+		output.remove()
+		return snapshotEntry{err: err}
+	}
+
+	header.CRC32 = crc_hash.Sum32()
+	header.UncompressedSize64 = uint64(n)
+	header.CompressedSize64 = uint64(output.size)
+
+	return snapshotEntry{
+		header:   header,
+		hash:     hex.EncodeToString(sha_hash.Sum(nil)),
+		data:     output.buffer.Bytes(),
+		tmp_path: output.tmp_path,
+	}
+}
+
+func writeSnapshotEntry(writer *zip.Writer, entry snapshotEntry) error {
+	raw_writer, err := writer.CreateRaw(entry.header)
+	if err != nil {
+		return err
+	}
+
+	if entry.tmp_path == "" {
+		_, err = raw_writer.Write(entry.data)
+		return err
+	}
+
+	defer os.Remove(entry.tmp_path)
+	tmp_file, err := os.Open(entry.tmp_path)
+	if err != nil {
+		return err
+	}
+	defer tmp_file.Close()
+
+	_, err = io.Copy(raw_writer, tmp_file)
+	return err
+}
+
+type spillBuffer struct {
+	tmp_dir  string
+	buffer   bytes.Buffer
+	file     *os.File
+	tmp_path string
+	size     int64
+}
+
+func (s *spillBuffer) Write(p []byte) (int, error) {
+	if s.file == nil && s.buffer.Len()+len(p) > SNAPSHOT_MEMORY_LIMIT {
+		file, err := os.CreateTemp(s.tmp_dir, "part-")
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+		s.tmp_path = file.Name()
+		if _, err = s.file.Write(s.buffer.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buffer = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buffer.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *spillBuffer) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *spillBuffer) remove() {
+	s.closeFile()
+	if s.tmp_path != "" {
+		os.Remove(s.tmp_path)
+	}
+}
@@ -0,0 +1,264 @@
+package filetracker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Pushes're always Stored as Zip, Tar+Zstd Archives're Built from them only to be Sent
+
+// Writes Entries of Zip at 'src_path' accepted by 'include' into Tar+Zstd at 'dst_path'
+// Returns Num of Entries Written, Archive is Written to a Temp File & Renamed once Complete
+func zipToTarZstd(src_path, dst_path string, include func(name string) bool) (count int, err error) {
+	src_zip_file, err := zip.OpenReader(src_path)
+	if err != nil {
+		return 0, err
+	}
+	defer src_zip_file.Close()
+
+	// Concurrent Requests may Build the same Archive
+	dst_file, err := os.CreateTemp(filepath.Dir(dst_path), filepath.Base(dst_path)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	tmp_path := dst_file.Name()
+	defer func() {
+		dst_file.Close()
+		if err != nil {
+			os.Remove(tmp_path)
+		}
+	}()
+
+	encoder, err := zstd.NewWriter(dst_file, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		return 0, err
+	}
+	defer encoder.Close()
+
+	writer := tar.NewWriter(encoder)
+	for _, file := range src_zip_file.File {
+		if file.FileInfo().IsDir() || !include(file.Name) {
+			continue
+		}
+		if err = copyZipEntryToTar(writer, file); err != nil {
+			return 0, err
+		}
+		count += 1
+	}
+
+	if err = writer.Close(); err != nil {
+		return 0, err
+	}
+	if err = encoder.Close(); err != nil {
+		return 0, err
+	}
+	if err = dst_file.Sync(); err != nil {
+		return 0, err
+	}
+	if err = dst_file.Close(); err != nil {
+		return 0, err
+	}
+	return count, os.Rename(tmp_path, dst_path)
+}
+
+// Keeps Mode Bits & Modification Time of Zip Entry
+func copyZipEntryToTar(writer *tar.Writer, file *zip.File) error {
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     file.Name,
+		Size:     int64(file.UncompressedSize64),
+		Mode:     int64(file.Mode().Perm()),
+		ModTime:  file.Modified,
+		Format:   tar.FormatPAX,
+	}
+	if err = writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, content)
+	return err
+}
+
+// Tar+Zstd of entire Push, Built from its Zip
+func ConvertZipToTarZstd(src_path, dst_path string) error {
+	_, err := zipToTarZstd(src_path, dst_path, func(string) bool { return true })
+	if err != nil {
+		fmt.Println("Error while Converting Zip to Tar+Zstd:", err)
+		fmt.Println("Source: ConvertZipToTarZstd()")
+		return err
+	}
+	return nil
+}
+
+// Tar+Zstd of Push named 'push_name', Built from its Zip in 'current_path' & Stored next to it
+// Archives of Older Pushes're Removed, they'd never be Requested again
+func StoreCloneTarZstd(current_path, push_name string) (string, error) {
+	archive_path := filepath.Join(current_path, config.GetArchiveName(push_name, config.ARCHIVE_FORMAT_TAR_ZSTD))
+	if err := ConvertZipToTarZstd(filepath.Join(current_path, push_name+".zip"), archive_path); err != nil {
+		fmt.Println("Error while Building Tar+Zstd Archive of Push:", err)
+		fmt.Println("Source: StoreCloneTarZstd()")
+		return "", err
+	}
+
+	old_archives, err := filepath.Glob(filepath.Join(current_path, "*."+config.ARCHIVE_FORMAT_TAR_ZSTD))
+	if err != nil {
+		return archive_path, nil
+	}
+	for _, old_archive := range old_archives {
+		if old_archive == archive_path {
+			continue
+		}
+		if err = os.Remove(old_archive); err != nil {
+			fmt.Println("Error while Removing Old Tar+Zstd Archive:", err)
+			fmt.Println("Source: StoreCloneTarZstd()")
+		}
+	}
+	return archive_path, nil
+}
+
+// Same as ZipUpdates(), but Writes Tar+Zstd
+func TarZstdUpdates(changes []config.FileChange, src_path string, dst_path string) error {
+	dst_dir, _ := filepath.Split(dst_path)
+	if err := os.Mkdir(dst_dir, 0700); err != nil {
+		fmt.Println("Error Could not Create the Dir:", err)
+		fmt.Println("Source: TarZstdUpdates()")
+		return err
+	}
+
+	updated_files := map[string]bool{}
+	for _, change := range changes {
+		if change.Type == "Updated" {
+			updated_files[change.FilePath] = true
+		}
+	}
+
+	count, err := zipToTarZstd(src_path, dst_path, func(name string) bool {
+		return updated_files[name]
+	})
+	if err != nil {
+		fmt.Println("Error while Writing Updates into Tar+Zstd:", err)
+		fmt.Println("Source: TarZstdUpdates()")
+		return err
+	}
+
+	if count != len(updated_files) {
+		fmt.Printf("Error: Only %d of %d Updated Files're Present in %s\n", count, len(updated_files), src_path)
+		fmt.Println("Source: TarZstdUpdates()")
+		os.Remove(dst_path)
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// Same as UnzipData(), but for Tar+Zstd
+func UntarZstdData(src, dest string) error {
+	fmt.Printf("Extracting Files: %s\n\t to %s\n", src, dest)
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	src_file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer src_file.Close()
+
+	decoder, err := zstd.NewReader(src_file)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	reader := tar.NewReader(decoder)
+	total_files := 0
+	for count := 0; ; count++ {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		// Only Regular Files're ever Archived, anything else is Crafted
+		if header.Typeflag != tar.TypeReg {
+			fmt.Println("Archive has an Entry which isn't a Regular File:", header.Name)
+			fmt.Println("Source: UntarZstdData()")
+			return ErrUnsafePath
+		}
+
+		abs_path, err := SafeJoin(dest, header.Name)
+		if err != nil {
+			fmt.Println("Archive has an Unsafe Path:", header.Name)
+			fmt.Println("Source: UntarZstdData()")
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(abs_path), 0700); err != nil {
+			return err
+		}
+		if err = untarFile(reader, header, abs_path); err != nil {
+			fmt.Println("Error while Extracting File:", err)
+			fmt.Println("Source: UntarZstdData()")
+			return err
+		}
+
+		total_files += 1
+		fmt.Printf("%d] File: %s\n", count, toLocalPath(header.Name))
+	}
+	fmt.Printf("\nTotal Files Recieved: %d\n", total_files)
+	return nil
+}
+
+// Mode Bits & Modification Time're Restored from Tar Header
+func untarFile(reader *tar.Reader, header *tar.Header, dst_path string) error {
+	dst_file, err := os.Create(dst_path)
+	if err != nil {
+		return err
+	}
+	defer dst_file.Close()
+
+	if _, err = io.Copy(dst_file, reader); err != nil {
+		return err
+	}
+	if err = dst_file.Close(); err != nil {
+		return err
+	}
+
+	if perm := os.FileMode(header.Mode).Perm(); perm != 0 {
+		if err = os.Chmod(dst_path, perm|0600); err != nil {
+			return err
+		}
+	}
+	if !header.ModTime.IsZero() {
+		if err = os.Chtimes(dst_path, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extracts Archive of 'archive_format' (Zip if Empty) into 'dest'
+func ExtractArchive(archive_format, src, dest string) error {
+	switch archive_format {
+	case "", config.ARCHIVE_FORMAT_ZIP:
+		return UnzipData(src, dest)
+	case config.ARCHIVE_FORMAT_TAR_ZSTD:
+		return UntarZstdData(src, dest)
+	}
+	return fmt.Errorf("unsupported archive format: %s", archive_format)
+}
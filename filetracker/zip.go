@@ -4,83 +4,80 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"runtime"
-	"strings"
 
 	"github.com/PKr-Parivar/PKr-Base/config"
 )
 
-func addFilesToZip(writer *zip.Writer, dir_path string, relativepath string) error {
-	files, err := ioutil.ReadDir(dir_path)
+// Streams File into Zip, keeping its Mode Bits & Modification Time
+func addFileToZip(writer *zip.Writer, file_path string, zip_entry_name string) error {
+	src_file, err := os.Open(file_path)
 	if err != nil {
-		fmt.Println("Error while Reading Dir:", err)
-		fmt.Println("Source: addFilesToZip()")
+		fmt.Println("Error while Opening File:", err)
+		fmt.Println("Source: addFileToZip()")
 		return err
 	}
+	defer src_file.Close()
 
-	for _, file := range files {
-		if file.Name() == ".PKr" || file.Name() == "PKr-Base.exe" || file.Name() == "PKr-Cli.exe" || file.Name() == "PKr-Base" || file.Name() == "PKr-Cli" {
-			continue
-		} else if !file.IsDir() {
-			content, err := os.ReadFile(filepath.Join(dir_path, file.Name()))
-			if err != nil {
-				fmt.Println("Error while Reading File:", err)
-				fmt.Println("Source: addFilesToZip()")
-				return err
-			}
-
-			file, err := writer.Create(filepath.Join(relativepath, file.Name()))
-			if err != nil {
-				fmt.Println("Error while Creating Entry in Zip File:", err)
-				fmt.Println("Source: addFilesToZip()")
-				return err
-			}
-			file.Write(content)
-		} else if file.IsDir() {
-			new_dir_path := filepath.Join(dir_path, file.Name()) + string(os.PathSeparator)
-			new_rel_path := filepath.Join(relativepath, file.Name()) + string(os.PathSeparator)
-
-			addFilesToZip(writer, new_dir_path, new_rel_path)
-		}
+	file_info, err := src_file.Stat()
+	if err != nil {
+		fmt.Println("Error while Getting FileInfo:", err)
+		fmt.Println("Source: addFileToZip()")
+		return err
 	}
-	return nil
-}
-
-func ZipData(workspace_path string, destination_path string, zip_file_name string) error {
-	zip_file_name = zip_file_name + ".zip"
-	full_zip_path := filepath.Join(destination_path, zip_file_name)
 
-	// Ensure the destination directory exists
-	err := os.MkdirAll(destination_path, 0700)
+	header, err := zip.FileInfoHeader(file_info)
 	if err != nil {
-		fmt.Println("Error creating destination directory:", err)
-		fmt.Println("Source: ZipData()")
+		fmt.Println("Error while Creating Zip Header:", err)
+		fmt.Println("Source: addFileToZip()")
 		return err
 	}
-	zip_file, err := os.Create(full_zip_path)
+	header.Name = zip_entry_name
+	header.Method = zip.Deflate
+
+	entry, err := writer.CreateHeader(header)
 	if err != nil {
-		fmt.Println("Error while Creating Zip File:", err)
-		fmt.Println("Source: ZipData()")
+		fmt.Println("Error while Creating Entry in Zip File:", err)
+		fmt.Println("Source: addFileToZip()")
 		return err
 	}
 
-	writer := zip.NewWriter(zip_file)
-	addFilesToZip(writer, workspace_path, "")
-
-	if err = writer.Close(); err != nil {
-		fmt.Println("Error while Closing zip writer:", err)
-		fmt.Println("Source: ZipData()")
+	if _, err = io.Copy(entry, src_file); err != nil {
+		fmt.Println("Error while Copying File into Zip:", err)
+		fmt.Println("Source: addFileToZip()")
 		return err
 	}
-	zip_file.Close()
 	return nil
 }
 
+// Zip of Workspace along with File Tree of exactly what's in it, see BuildSnapshot()
+// Tree is to be Stored as File Tree of the Push, so Files aren't Read again to Hash them
+// Workspaces Configured for Tar+Zstd get that Archive too, Building it during a Clone would Outlast the RPC
+func ZipData(workspace_path string, destination_path string, zip_file_name string) (config.FileTree, error) {
+	file_tree, err := BuildSnapshot(workspace_path, destination_path, zip_file_name)
+	if err != nil {
+		fmt.Println("Error while Building Snapshot of Workspace:", err)
+		fmt.Println("Source: ZipData()")
+		return config.FileTree{}, err
+	}
+
+	// Clones still get Zip without it, so it isn't a Failed Push
+	workspace_conf, err := config.ReadFromWorkspaceConfigFile(filepath.Join(workspace_path, config.WORKSPACE_CONFIG_FILE_PATH))
+	if err == nil && workspace_conf.ArchiveFormat == config.ARCHIVE_FORMAT_TAR_ZSTD {
+		if _, err = StoreCloneTarZstd(destination_path, zip_file_name); err != nil {
+			fmt.Println("Error while Building Tar+Zstd Archive, Clones'll get Zip till it's Built:", err)
+			fmt.Println("Source: ZipData()")
+		}
+	}
+	return file_tree, nil
+}
+
 func UnzipData(src, dest string) error {
 	fmt.Printf("Unzipping Files: %s\n\t to %s\n", src, dest)
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
 	zipper, err := zip.OpenReader(src)
 	if err != nil {
 		return err
@@ -91,15 +88,20 @@ func UnzipData(src, dest string) error {
 		if file.FileInfo().IsDir() {
 			continue
 		}
-
-		var temp_file_name string
-		if runtime.GOOS == "windows" {
-			temp_file_name = strings.ReplaceAll(file.Name, "/", "\\")
-		} else {
-			temp_file_name = strings.ReplaceAll(file.Name, "\\", "/")
+		// Only Regular Files're ever Zipped, anything else is Crafted
+		if !file.Mode().IsRegular() {
+			fmt.Println("Zip File has an Entry which isn't a Regular File:", file.Name)
+			fmt.Println("Source: UnzipData()")
+			return ErrUnsafePath
 		}
 
-		abs_path := filepath.Join(dest, temp_file_name)
+		abs_path, err := SafeJoin(dest, file.Name)
+		if err != nil {
+			fmt.Println("Zip File has an Unsafe Path:", file.Name)
+			fmt.Println("Source: UnzipData()")
+			return err
+		}
+		temp_file_name := toLocalPath(file.Name)
 		dir, _ := filepath.Split(abs_path)
 
 		if dir != "" {
@@ -107,29 +109,50 @@ func UnzipData(src, dest string) error {
 				return err
 			}
 		}
-		unzip_file, err := os.Create(abs_path)
-		if err != nil {
+		if err = unzipFile(file, abs_path); err != nil {
+			fmt.Println("Error while Unzipping File:", err)
+			fmt.Println("Source: UnzipData()")
 			return err
 		}
 
-		content, err := file.Open()
-		if err != nil {
+		total_files += 1
+		fmt.Printf("%d] File: %s\n", count, temp_file_name)
+	}
+	fmt.Printf("\nTotal Files Recieved: %d\n", total_files)
+	return nil
+}
+
+// Mode Bits & Modification Time're Restored from Zip Header
+func unzipFile(file *zip.File, dst_path string) error {
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	unzip_file, err := os.Create(dst_path)
+	if err != nil {
+		return err
+	}
+	defer unzip_file.Close()
+
+	if _, err = io.Copy(unzip_file, content); err != nil {
+		return err
+	}
+	if err = unzip_file.Close(); err != nil {
+		return err
+	}
+
+	if perm := file.Mode().Perm(); perm != 0 {
+		if err = os.Chmod(dst_path, perm|0600); err != nil {
 			return err
 		}
-
-		_, err = io.Copy(unzip_file, content)
-		if err != nil {
+	}
+	if !file.Modified.IsZero() {
+		if err = os.Chtimes(dst_path, file.Modified, file.Modified); err != nil {
 			return err
 		}
-
-		// Close both after copy
-		unzip_file.Close()
-		content.Close()
-
-		total_files += 1
-		fmt.Printf("%d] File: %s\n", count, temp_file_name)
 	}
-	fmt.Printf("\nTotal Files Recieved: %d\n", total_files)
 	return nil
 }
 
@@ -181,25 +204,55 @@ func ZipUpdates(changes []config.FileChange, src_path string, dst_path string) (
 		if zip_file_obj == nil {
 			fmt.Println("Error while Getting Zip File Obj:", filepath.Join(src_path, change.FilePath), "is nil")
 			fmt.Println("Source: ZipUpdates()")
-			return
+			return os.ErrNotExist
 		}
 
-		zip_file_obj_reader, err := zip_file_obj.Open()
-		if err != nil {
+		// Copies Compressed Data as it is, along with Header
+		if err = writer.Copy(zip_file_obj); err != nil {
+			fmt.Println("Error while Copying File into Zip:", err)
+			fmt.Println("Source: ZipUpdates()")
 			return err
 		}
-		defer zip_file_obj_reader.Close()
+	}
+
+	if err = writer.Close(); err != nil {
+		fmt.Println("Error while Closing zip writer:", err)
+		fmt.Println("Source: ZipUpdates()")
+		return err
+	}
+	return dst_zip_file.Close()
+}
+
+// Zips only 'file_paths' (Relative to Workspace) from Workspace into 'dst_path'
+func ZipFilesFromWorkspace(workspace_path string, file_paths []string, dst_path string) error {
+	dst_zip_file, err := os.Create(dst_path)
+	if err != nil {
+		fmt.Printf("Error Could Not Create File %v: %v\n", dst_path, err)
+		fmt.Println("Source: ZipFilesFromWorkspace()")
+		return err
+	}
+	defer dst_zip_file.Close()
 
-		new_file, err := writer.Create(zip_file_obj.Name)
+	writer := zip.NewWriter(dst_zip_file)
+	for _, file_path := range file_paths {
+		src_path, err := SafeJoin(workspace_path, file_path)
 		if err != nil {
+			fmt.Println("Unsafe File Path:", file_path)
+			fmt.Println("Source: ZipFilesFromWorkspace()")
 			return err
 		}
 
-		// Copy the contents
-		_, err = io.Copy(new_file, zip_file_obj_reader)
-		if err != nil {
+		if err = addFileToZip(writer, src_path, file_path); err != nil {
+			fmt.Println("Error while Adding File to Zip:", err)
+			fmt.Println("Source: ZipFilesFromWorkspace()")
 			return err
 		}
 	}
+
+	if err = writer.Close(); err != nil {
+		fmt.Println("Error while Closing zip writer:", err)
+		fmt.Println("Source: ZipFilesFromWorkspace()")
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,219 @@
+package filetracker
+
+import (
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type zipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+func writeTestZip(t *testing.T, zip_path string, entries []zipEntry) {
+	t.Helper()
+	zip_file, err := os.Create(zip_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zip_file.Close()
+
+	writer := zip.NewWriter(zip_file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		entry_writer, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = entry_writer.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Regular Files under 'root', Zip itself is kept outside it
+func listRegularFiles(t *testing.T, root string) []string {
+	t.Helper()
+	files := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestUnzipDataRejectsCraftedZips(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      func(outside string) []zipEntry
+		setup        func(t *testing.T, dest, outside string)
+		windows_only bool
+	}{
+		{
+			name:    "parent dir",
+			entries: func(string) []zipEntry { return []zipEntry{{"../outside/evil.txt", 0644, "evil"}} },
+		},
+		{
+			name:    "parent dir in middle",
+			entries: func(string) []zipEntry { return []zipEntry{{"a/../../outside/evil.txt", 0644, "evil"}} },
+		},
+		{
+			name:    "parent dir with backslashes",
+			entries: func(string) []zipEntry { return []zipEntry{{`..\outside\evil.txt`, 0644, "evil"}} },
+		},
+		{
+			name: "absolute path",
+			entries: func(outside string) []zipEntry {
+				return []zipEntry{{filepath.ToSlash(filepath.Join(outside, "evil.txt")), 0644, "evil"}}
+			},
+		},
+		{
+			name:    "drive letter with backslash",
+			entries: func(string) []zipEntry { return []zipEntry{{`C:\evil.txt`, 0644, "evil"}} },
+		},
+		{
+			name:    "drive letter with slash",
+			entries: func(string) []zipEntry { return []zipEntry{{"c:/evil.txt", 0644, "evil"}} },
+		},
+		{
+			name:    "drive relative",
+			entries: func(string) []zipEntry { return []zipEntry{{"C:evil.txt", 0644, "evil"}} },
+		},
+		{
+			name:    "symlink entry",
+			entries: func(string) []zipEntry { return []zipEntry{{"link", os.ModeSymlink | 0777, "../outside"}} },
+		},
+		{
+			name:    "existing symlink escaping workspace",
+			entries: func(string) []zipEntry { return []zipEntry{{"link/evil.txt", 0644, "evil"}} },
+			setup: func(t *testing.T, dest, outside string) {
+				if err := os.Symlink(outside, filepath.Join(dest, "link")); err != nil {
+					t.Skip("Symlinks aren't Supported:", err)
+				}
+			},
+		},
+		{
+			name:         "reserved name",
+			entries:      func(string) []zipEntry { return []zipEntry{{"CON", 0644, "evil"}} },
+			windows_only: true,
+		},
+		{
+			name:         "reserved name with extension",
+			entries:      func(string) []zipEntry { return []zipEntry{{"dir/aux.txt", 0644, "evil"}} },
+			windows_only: true,
+		},
+		{
+			name:         "reserved name in lower case",
+			entries:      func(string) []zipEntry { return []zipEntry{{"nul", 0644, "evil"}} },
+			windows_only: true,
+		},
+		{
+			name:         "alternate data stream",
+			entries:      func(string) []zipEntry { return []zipEntry{{"file.txt:stream", 0644, "evil"}} },
+			windows_only: true,
+		},
+		{
+			name:         "trailing dot",
+			entries:      func(string) []zipEntry { return []zipEntry{{"file.", 0644, "evil"}} },
+			windows_only: true,
+		},
+		{
+			name:    ".PKr prefix",
+			entries: func(string) []zipEntry { return []zipEntry{{".PKr/workspace-config.json", 0644, "evil"}} },
+		},
+		{
+			name:    ".PKr prefix in other case",
+			entries: func(string) []zipEntry { return []zipEntry{{`.pkr\workspace-config.json`, 0644, "evil"}} },
+		},
+		{
+			name:    "named pipe",
+			entries: func(string) []zipEntry { return []zipEntry{{"pipe", os.ModeNamedPipe | 0644, ""}} },
+		},
+		{
+			name:    "device",
+			entries: func(string) []zipEntry { return []zipEntry{{"device", os.ModeDevice | 0644, ""}} },
+		},
+		{
+			name:    "socket",
+			entries: func(string) []zipEntry { return []zipEntry{{"socket", os.ModeSocket | 0644, ""}} },
+		},
+		{
+			name:    "empty name",
+			entries: func(string) []zipEntry { return []zipEntry{{"", 0644, "evil"}} },
+		},
+		{
+			name:    "nul byte",
+			entries: func(string) []zipEntry { return []zipEntry{{"evil\x00.txt", 0644, "evil"}} },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.windows_only {
+				defer func(prev bool) { check_windows_names = prev }(check_windows_names)
+				check_windows_names = true
+			}
+
+			root := t.TempDir()
+			dest := filepath.Join(root, "workspace")
+			outside := filepath.Join(root, "outside")
+			for _, dir := range []string{dest, outside} {
+				if err := os.Mkdir(dir, 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.setup != nil {
+				test.setup(t, dest, outside)
+			}
+
+			zip_path := filepath.Join(t.TempDir(), "crafted.zip")
+			writeTestZip(t, zip_path, test.entries(outside))
+
+			if err := UnzipData(zip_path, dest); err == nil {
+				t.Fatal("Crafted Zip was Extracted")
+			}
+			if files := listRegularFiles(t, root); len(files) != 0 {
+				t.Fatalf("Files were Written by Crafted Zip: %q", files)
+			}
+		})
+	}
+}
+
+func TestUnzipDataExtractsSafeZip(t *testing.T) {
+	dest := t.TempDir()
+	zip_path := filepath.Join(t.TempDir(), "safe.zip")
+	writeTestZip(t, zip_path, []zipEntry{
+		{"a.txt", 0644, "a"},
+		{"dir/sub/b.txt", 0600, "b"},
+		{"..dots/c.txt", 0644, "c"},
+	})
+
+	if err := UnzipData(zip_path, dest); err != nil {
+		t.Fatal(err)
+	}
+	for rel_path, want := range map[string]string{"a.txt": "a", "dir/sub/b.txt": "b", "..dots/c.txt": "c"} {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel_path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", rel_path, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package framing
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// KCP Stream Mode doesn't keep Boundaries of Writes, so KCP-Plain Sessions Send Frames instead
+// Every Frame is 1 Byte Type, 4 Byte Big Endian Length of Payload & then the Payload
+// Listener Sends SESSION_TAG & a HEADER (models.DataRequest), then PROGRESS (models.DataProgress) while
+// Receiving & an ACK once it has all Data. Sender Sends DATA of the Sealed Stream, or ERROR in place of it
+// AUTH Frames're only Sent while a Session is Authenticated, see dialer.AuthenticateToUser()
+
+type FrameType byte
+
+const (
+	FRAME_HEADER   FrameType = 1
+	FRAME_DATA     FrameType = 2
+	FRAME_ERROR    FrameType = 3
+	FRAME_ACK      FrameType = 4
+	FRAME_PROGRESS FrameType = 5
+	FRAME_AUTH     FrameType = 6
+)
+
+const (
+	SESSION_TAG       = "KFR" // Type of Session Listener Sends, once Authenticated, for a KCP-Plain Session
+	FRAME_HEADER_SIZE = 5
+	MAX_FRAME_SIZE    = 1024 * 1024 // Frames Larger than this're Rejected, so a Bad Length can't Exhaust Memory
+)
+
+var (
+	ErrFrameTooLarge    = errors.New("frame is larger than max frame size")
+	ErrUnexpectedFrame  = errors.New("unexpected frame received")
+	ErrUnknownFrameType = errors.New("unknown frame type received")
+)
+
+type Frame struct {
+	Type    FrameType
+	Payload []byte
+}
+
+func (t FrameType) String() string {
+	switch t {
+	case FRAME_HEADER:
+		return "Header"
+	case FRAME_DATA:
+		return "Data"
+	case FRAME_ERROR:
+		return "Error"
+	case FRAME_ACK:
+		return "Ack"
+	case FRAME_PROGRESS:
+		return "Progress"
+	case FRAME_AUTH:
+		return "Auth"
+	}
+	return fmt.Sprintf("Unknown(%d)", byte(t))
+}
+
+// Whole Frame goes in one Write, so Frames from different go routines aren't Interleaved
+func WriteFrame(writer io.Writer, frame_type FrameType, payload []byte) error {
+	if len(payload) > MAX_FRAME_SIZE {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, FRAME_HEADER_SIZE+len(payload))
+	frame[0] = byte(frame_type)
+	binary.BigEndian.PutUint32(frame[1:FRAME_HEADER_SIZE], uint32(len(payload)))
+	copy(frame[FRAME_HEADER_SIZE:], payload)
+
+	_, err := writer.Write(frame)
+	return err
+}
+
+func WriteJSONFrame(writer io.Writer, frame_type FrameType, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return WriteFrame(writer, frame_type, payload)
+}
+
+func ReadFrame(reader io.Reader) (Frame, error) {
+	var header [FRAME_HEADER_SIZE]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	frame_type := FrameType(header[0])
+	if frame_type < FRAME_HEADER || frame_type > FRAME_AUTH {
+		return Frame{}, ErrUnknownFrameType
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MAX_FRAME_SIZE {
+		return Frame{}, ErrFrameTooLarge
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	return Frame{Type: frame_type, Payload: payload}, nil
+}
+
+// Reads next Frame, which must be of 'frame_type', into 'v'
+// Error Frames're Returned as the Error they carry
+func ReadJSONFrame(reader io.Reader, frame_type FrameType, v any) error {
+	frame, err := ReadFrame(reader)
+	if err != nil {
+		return err
+	}
+	if frame.Type == FRAME_ERROR && frame_type != FRAME_ERROR {
+		return frame.Err()
+	}
+	if frame.Type != frame_type {
+		return fmt.Errorf("%w: %s instead of %s", ErrUnexpectedFrame, frame.Type, frame_type)
+	}
+	return json.Unmarshal(frame.Payload, v)
+}
+
+type errorPayload struct {
+	Code    models.ErrorCode `json:"code,omitempty"`
+	Message string           `json:"message"`
+}
+
+func WriteErrorFrame(writer io.Writer, err error) error {
+	return WriteJSONFrame(writer, FRAME_ERROR, errorPayload{Code: models.GetErrorCode(err), Message: err.Error()})
+}
+
+// Error carried by an Error Frame, see models.ErrorFromCode()
+func (f Frame) Err() error {
+	var payload errorPayload
+	if err := json.Unmarshal(f.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid error frame: %w", err)
+	}
+	return models.ErrorFromCode(payload.Code, payload.Message)
+}
@@ -0,0 +1,132 @@
+package framing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		frame_type FrameType
+		payload    []byte
+	}{
+		{"empty ack", FRAME_ACK, []byte{}},
+		{"small data", FRAME_DATA, []byte("sealed chunk")},
+		{"max size data", FRAME_DATA, bytes.Repeat([]byte{0xAB}, MAX_FRAME_SIZE)},
+		{"header", FRAME_HEADER, []byte(`{"WorkspaceName":"workspace"}`)},
+		{"auth", FRAME_AUTH, []byte{0x00, 0x01, 0x02}},
+	}
+
+	// Frames're Read back from one Stream, so Boundaries between them must be kept
+	var stream bytes.Buffer
+	for _, test := range tests {
+		if err := WriteFrame(&stream, test.frame_type, test.payload); err != nil {
+			t.Fatalf("%s: Error while Writing Frame: %v", test.name, err)
+		}
+	}
+
+	for _, test := range tests {
+		frame, err := ReadFrame(&stream)
+		if err != nil {
+			t.Fatalf("%s: Error while Reading Frame: %v", test.name, err)
+		}
+		if frame.Type != test.frame_type || !bytes.Equal(frame.Payload, test.payload) {
+			t.Fatalf("%s: Read %s Frame of %d Bytes, want %s Frame of %d Bytes", test.name, frame.Type, len(frame.Payload), test.frame_type, len(test.payload))
+		}
+	}
+	if _, err := ReadFrame(&stream); err != io.EOF {
+		t.Fatalf("Error after Last Frame is %v, want %v", err, io.EOF)
+	}
+}
+
+func TestJSONFrameRoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	want := models.DataProgress{NextChunk: 7, EndChunk: 42}
+	if err := WriteJSONFrame(&stream, FRAME_PROGRESS, want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got models.DataProgress
+	if err := ReadJSONFrame(&stream, FRAME_PROGRESS, &got); err != nil {
+		t.Fatal("Error while Reading JSON Frame:", err)
+	}
+	if got != want {
+		t.Fatalf("Read %+v, want %+v", got, want)
+	}
+}
+
+// Error Frames come in place of the Frame Expected, & carry Coded Errors across
+func TestReadJSONFrameReturnsErrorFrame(t *testing.T) {
+	var stream bytes.Buffer
+	if err := WriteErrorFrame(&stream, models.ErrListenerRevoked); err != nil {
+		t.Fatal(err)
+	}
+
+	var req models.DataRequest
+	err := ReadJSONFrame(&stream, FRAME_HEADER, &req)
+	if !errors.Is(err, models.ErrListenerRevoked) {
+		t.Fatalf("Error is %v, want %v", err, models.ErrListenerRevoked)
+	}
+}
+
+func TestReadJSONFrameRejectsUnexpectedType(t *testing.T) {
+	var stream bytes.Buffer
+	if err := WriteFrame(&stream, FRAME_DATA, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var req models.DataRequest
+	if err := ReadJSONFrame(&stream, FRAME_HEADER, &req); !errors.Is(err, ErrUnexpectedFrame) {
+		t.Fatalf("Error is %v, want %v", err, ErrUnexpectedFrame)
+	}
+}
+
+func TestWriteFrameRejectsOversizedPayload(t *testing.T) {
+	var stream bytes.Buffer
+	err := WriteFrame(&stream, FRAME_DATA, make([]byte, MAX_FRAME_SIZE+1))
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("Error is %v, want %v", err, ErrFrameTooLarge)
+	}
+	if stream.Len() != 0 {
+		t.Fatalf("%d Bytes of Oversized Frame were Written", stream.Len())
+	}
+}
+
+func rawFrameHeader(frame_type byte, length uint32) []byte {
+	header := make([]byte, FRAME_HEADER_SIZE)
+	header[0] = frame_type
+	binary.BigEndian.PutUint32(header[1:], length)
+	return header
+}
+
+func TestReadFrameRejectsMalformedFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"length over max", rawFrameHeader(byte(FRAME_DATA), MAX_FRAME_SIZE+1), ErrFrameTooLarge},
+		{"max uint32 length", rawFrameHeader(byte(FRAME_DATA), 0xFFFFFFFF), ErrFrameTooLarge},
+		{"zero type", rawFrameHeader(0, 0), ErrUnknownFrameType},
+		{"type after auth", rawFrameHeader(byte(FRAME_AUTH)+1, 0), ErrUnknownFrameType},
+		{"legacy session tag", []byte("KCP\x00\x00"), ErrUnknownFrameType},
+		{"truncated header", []byte{byte(FRAME_DATA), 0x00}, io.ErrUnexpectedEOF},
+		{"payload cut short", append(rawFrameHeader(byte(FRAME_DATA), 10), "short"...), io.ErrUnexpectedEOF},
+		{"payload missing", rawFrameHeader(byte(FRAME_DATA), 10), io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadFrame(bytes.NewReader(test.input))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Error is %v, want %v", err, test.want)
+			}
+		})
+	}
+}
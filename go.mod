@@ -7,6 +7,7 @@ require (
 	github.com/ccding/go-stun v0.1.5
 	github.com/gen2brain/beeep v0.11.1
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
 	google.golang.org/grpc v1.74.2
 	google.golang.org/protobuf v1.36.6
 )
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PKr-Parivar/PKr-Base/chunker"
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/PKr-Base/utils"
+)
+
+var ErrInvalidChunkRequest = models.ErrInvalidChunkRequest
+
+// Chunk Lists of Push Ranges ending at older Pushes're Removed along with their Chunks
+// A few're kept, so Listeners Pulling while I Push can still Get their Chunks
+const CHUNK_LISTS_KEPT_PUSHES = 5
+
+// Chunks of a List being Built or a Pack being Written mustn't be Pruned
+var chunk_store_mutex sync.Mutex
+
+func getChunkListsDir(workspace_path string) string {
+	return filepath.Join(chunker.GetStorePath(workspace_path), "Lists")
+}
+
+func getChunkListsPath(workspace_path, request_push_range string) string {
+	return filepath.Join(getChunkListsDir(workspace_path), request_push_range+".json")
+}
+
+func getChunkPacksPath(workspace_path string) string {
+	return filepath.Join(chunker.GetStorePath(workspace_path), "Packs")
+}
+
+func readChunkLists(workspace_path, request_push_range string) (map[string][]models.FileChunk, error) {
+	data, err := os.ReadFile(getChunkListsPath(workspace_path, request_push_range))
+	if err != nil {
+		return nil, err
+	}
+
+	var file_chunks map[string][]models.FileChunk
+	if err = json.Unmarshal(data, &file_chunks); err != nil {
+		return nil, err
+	}
+	return file_chunks, nil
+}
+
+// Chunk Lists of Updated Files in Push Range, Cached as long as every Chunk is still in Store
+func getChunkLists(workspace_path, last_push_zip_path, request_push_range string, last_push_num int, merged_changes []config.FileChange) (map[string][]models.FileChunk, error) {
+	chunk_store_mutex.Lock()
+	defer chunk_store_mutex.Unlock()
+	store := chunker.NewStore(workspace_path)
+
+	file_chunks, err := readChunkLists(workspace_path, request_push_range)
+	if err == nil {
+		is_cache_valid := true
+		for _, chunks := range file_chunks {
+			for _, chunk := range chunks {
+				if !store.Has(chunk.Hash) {
+					is_cache_valid = false
+				}
+			}
+		}
+		if is_cache_valid {
+			logger.LOGGER.Println("Using Cached Chunk Lists")
+			return file_chunks, nil
+		}
+	}
+
+	logger.LOGGER.Println("Chunking Updated Files ...")
+	zip_reader, err := zip.OpenReader(last_push_zip_path)
+	if err != nil {
+		logger.LOGGER.Println("Error while Opening Zip of Last Push:", err)
+		logger.LOGGER.Println("Source: getChunkLists()")
+		return nil, err
+	}
+	defer zip_reader.Close()
+
+	zip_files := map[string]*zip.File{}
+	for _, file := range zip_reader.File {
+		zip_files[file.Name] = file
+	}
+
+	file_chunks = map[string][]models.FileChunk{}
+	for _, change := range merged_changes {
+		if change.Type != "Updated" {
+			continue
+		}
+
+		zip_file, ok := zip_files[change.FilePath]
+		if !ok {
+			logger.LOGGER.Println("Updated File isn't Present in Zip of Last Push:", change.FilePath)
+			logger.LOGGER.Println("Source: getChunkLists()")
+			return nil, os.ErrNotExist
+		}
+
+		file_reader, err := zip_file.Open()
+		if err != nil {
+			logger.LOGGER.Println("Error while Opening File in Zip:", err)
+			logger.LOGGER.Println("Source: getChunkLists()")
+			return nil, err
+		}
+
+		chunks, err := chunker.ChunkAndStore(store, file_reader)
+		file_reader.Close()
+		if err != nil {
+			logger.LOGGER.Println("Error while Chunking File:", err)
+			logger.LOGGER.Println("Source: getChunkLists()")
+			return nil, err
+		}
+		file_chunks[change.FilePath] = chunks
+	}
+
+	data, err := json.Marshal(file_chunks)
+	if err != nil {
+		logger.LOGGER.Println("Error while Encoding Chunk Lists:", err)
+		logger.LOGGER.Println("Source: getChunkLists()")
+		return nil, err
+	}
+
+	chunk_lists_path := getChunkListsPath(workspace_path, request_push_range)
+	if err = os.MkdirAll(filepath.Dir(chunk_lists_path), 0700); err != nil {
+		logger.LOGGER.Println("Error while Creating Chunk Lists Dir:", err)
+		logger.LOGGER.Println("Source: getChunkLists()")
+		return nil, err
+	}
+
+	// Not Caching only costs Re-Chunking next time
+	if err = os.WriteFile(chunk_lists_path, data, 0600); err != nil {
+		logger.LOGGER.Println("Error while Caching Chunk Lists:", err)
+		logger.LOGGER.Println("Source: getChunkLists()")
+	}
+
+	if err = pruneChunkStore(workspace_path, last_push_num); err != nil {
+		logger.LOGGER.Println("Error while Pruning Chunk Store:", err)
+		logger.LOGGER.Println("Source: getChunkLists()")
+	}
+	return file_chunks, nil
+}
+
+// Removes Chunk Lists of Push Ranges ending before the last CHUNK_LISTS_KEPT_PUSHES Pushes & every Chunk only they had
+// Caller must hold chunk_store_mutex
+func pruneChunkStore(workspace_path string, last_push_num int) error {
+	lists_dir := getChunkListsDir(workspace_path)
+	entries, err := os.ReadDir(lists_dir)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	for _, entry := range entries {
+		request_push_range, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		// Push Range is "<Listener's Last Push Num>-<My Last Push Num then>"
+		_, end, _ := strings.Cut(request_push_range, "-")
+		end_push_num, err := strconv.Atoi(end)
+		if err != nil || end_push_num <= last_push_num-CHUNK_LISTS_KEPT_PUSHES {
+			logger.LOGGER.Println("Removing Chunk Lists of Older Push Range:", request_push_range)
+			if err = os.Remove(filepath.Join(lists_dir, entry.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file_chunks, err := readChunkLists(workspace_path, request_push_range)
+		if err != nil {
+			return err
+		}
+		for _, chunks := range file_chunks {
+			for _, chunk := range chunks {
+				keep[chunk.Hash] = true
+			}
+		}
+	}
+	return chunker.NewStore(workspace_path).Prune(keep)
+}
+
+// Sends Chunks Listener doesn't have as a single Encrypted Pack, Fetched via GetData with Type "Chunks"
+func (h *ClientHandler) GetChunks(req models.GetChunksRequest, res *models.GetChunksResponse) error {
+	logger.LOGGER.Println("Get Chunks Called ...")
+	if err := h.checkPeer(req.Username, true); err != nil {
+		logger.LOGGER.Println("Get Chunks Called by Unauthenticated User:", req.Username)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return err
+	}
+	if err := h.checkHello(); err != nil {
+		logger.LOGGER.Println("Listener didn't Agree on Protocol before Get Chunks:", req.Username)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return err
+	}
+
+	password, err := encrypt.RSADecryptData(req.WorkspacePassword)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Decrypt the Workspace Pass Received from Listener:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	if err = h.authenticateListener(req.WorkspaceName, req.Username, req.AccessToken, password); err != nil {
+		logger.LOGGER.Println("Failed to Authenticate Listener:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return err
+	}
+
+	workspace_path, err := config.GetSendWorkspaceFilePath(req.WorkspaceName)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Get Workspace Path from Config:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	if req.RequestPushRange == "" || filepath.Base(req.RequestPushRange) != req.RequestPushRange {
+		logger.LOGGER.Println("Invalid Request Push Range:", req.RequestPushRange)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInvalidChunkRequest
+	}
+
+	// Only Chunks Advertised in GetMetaData can be Requested
+	file_chunks, err := readChunkLists(workspace_path, req.RequestPushRange)
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading Chunk Lists:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInvalidChunkRequest
+	}
+
+	advertised_chunks := map[string]bool{}
+	for _, chunks := range file_chunks {
+		for _, chunk := range chunks {
+			advertised_chunks[chunk.Hash] = true
+		}
+	}
+	for _, hash := range req.ChunkHashes {
+		if !advertised_chunks[hash] {
+			logger.LOGGER.Println("Requested Chunk isn't in Push Range:", hash)
+			logger.LOGGER.Println("Source: GetChunks()")
+			return ErrInvalidChunkRequest
+		}
+	}
+	logger.LOGGER.Println("Chunks Requested:", len(req.ChunkHashes))
+
+	packs_path := getChunkPacksPath(workspace_path)
+	removeStaleCaches(packs_path)
+
+	res.PackID = req.RequestPushRange + "-" + utils.RandomString(6)
+	pack_dir_path := filepath.Join(packs_path, res.PackID)
+	if err = os.MkdirAll(pack_dir_path, 0700); err != nil {
+		logger.LOGGER.Println("Error while Creating Pack Dir:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	pack_path := filepath.Join(pack_dir_path, res.PackID+".pack")
+	chunk_store_mutex.Lock()
+	err = writeChunkPack(chunker.NewStore(workspace_path), req.ChunkHashes, pack_path)
+	chunk_store_mutex.Unlock()
+	if err != nil {
+		logger.LOGGER.Println("Error while Writing Chunk Pack:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	res.PackHash, err = encrypt.GenerateHashFromFileNames_BufferedAndPooled(pack_path)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate Hash of Chunk Pack:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	key, err := encrypt.AESGenerakeKey(16)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate AES Keys:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	iv, err := encrypt.AESGenerateIV()
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate IV Keys:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	enc_path := filepath.Join(pack_dir_path, res.PackID+".enc")
+	if err = encrypt.EncryptZipFileAndStore(pack_path, enc_path, key, iv); err != nil {
+		logger.LOGGER.Println("Error while Encrypting Chunk Pack:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	file_info, err := os.Stat(enc_path)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Get FileInfo of Encrypted Chunk Pack:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	res.KeyBytes, res.IVBytes, err = encryptKeysForListener(req.Username, key, iv)
+	if err != nil {
+		logger.LOGGER.Println("Error while Encrypting Keys for Listener:", err)
+		logger.LOGGER.Println("Source: GetChunks()")
+		return ErrInternalSeverError
+	}
+
+	res.LenData = int(file_info.Size())
+	res.EncryptionVersion = encrypt.ENCRYPTION_VERSION_AEAD
+
+	logger.LOGGER.Println("Len Data:", res.LenData)
+	logger.LOGGER.Println("Pack ID:", res.PackID)
+	logger.LOGGER.Println("Get Chunks Successful ...")
+	return nil
+}
+
+// Pack is just the Chunks one after another, Listener Splits it using Sizes from Chunk Lists
+func writeChunkPack(store *chunker.Store, chunk_hashes []string, pack_path string) error {
+	pack_file, err := os.Create(pack_path)
+	if err != nil {
+		return err
+	}
+	defer pack_file.Close()
+
+	writer := bufio.NewWriter(pack_file)
+	for _, hash := range chunk_hashes {
+		chunk, err := store.Get(hash)
+		if err != nil {
+			return err
+		}
+		if _, err = writer.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return pack_file.Close()
+}
@@ -1,31 +1,213 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
+	"io"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"os"
 
 	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/dialer"
 	"github.com/PKr-Parivar/PKr-Base/encrypt"
 	"github.com/PKr-Parivar/PKr-Base/filetracker"
 	"github.com/PKr-Parivar/PKr-Base/logger"
 	"github.com/PKr-Parivar/PKr-Base/models"
 )
 
+// Errors Returned to Listeners carry Codes, see models.CodedError
 var (
-	ErrIncorrectPassword             = errors.New("incorrect password")
+	ErrIncorrectPassword             = models.ErrIncorrectPassword
 	ErrServerNotFound                = errors.New("server not found in config")
-	ErrInternalSeverError            = errors.New("internal server error")
-	ErrUserAlreadyHasLatestWorkspace = errors.New("you already've latest version of workspace")
-	ErrInvalidLastPushNum            = errors.New("invalid last push number")
-	ErrNoSuchWorkspaceFound          = errors.New("no such workspace found")
+	ErrInternalSeverError            = models.ErrInternalServerError
+	ErrUserAlreadyHasLatestWorkspace = models.ErrUserAlreadyHasLatestWorkspace
+	ErrInvalidLastPushNum            = models.ErrInvalidLastPushNum
+	ErrNoSuchWorkspaceFound          = models.ErrNoSuchWorkspaceFound
+	ErrUnsupportedEncryptionVersion  = models.ErrUnsupportedEncryptionVersion
+	ErrNotAPeerOfWorkspace           = models.ErrNotAPeerOfWorkspace
+	ErrPeerHasNoNewerPush            = models.ErrPeerHasNoNewerPush
+	ErrPeerCannotServeWorkspace      = models.ErrPeerCannotServeWorkspace
+	ErrListenerRevoked               = models.ErrListenerRevoked
+	ErrInvalidAccessToken            = models.ErrInvalidAccessToken
 )
 
-type ClientHandler struct{}
+// One per Punched Server, see StartNewNewServer()
+type ClientHandler struct {
+	mutex sync.Mutex
+
+	// Profile of Sessions Accepted from Listener, Windows're Agreed during GetMetaData()
+	kcp_profile dialer.KCPProfile
+	// Listener this Server was Punched for, every Session must be Authenticated as it, see setAuthenticatedPeer()
+	peer_username   string
+	peer_public_key []byte
+	is_peer_known   bool // Key of Listener is Stored, till then only Key Exchange is Served
+	// Agreed in Hello(), which must be Called before GetMetaData() or GetChunks(), see checkHello()
+	protocol_version int
+	capabilities     models.Capability
+}
+
+func (h *ClientHandler) getKCPProfile() dialer.KCPProfile {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.kcp_profile
+}
+
+func (h *ClientHandler) getPeerUsername() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.peer_username
+}
+
+// Every Session to this Server must be of the same Listener, as whoever Authenticated first
+func (h *ClientHandler) setAuthenticatedPeer(peer dialer.AuthenticatedPeer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.peer_username != "" && h.peer_username != peer.Username {
+		return models.ErrPeerAuthFailed
+	}
+	if h.peer_public_key != nil && !bytes.Equal(bytes.TrimSpace(h.peer_public_key), bytes.TrimSpace(peer.PublicKey)) {
+		return models.ErrPeerAuthFailed
+	}
+	h.peer_username = peer.Username
+	h.peer_public_key = peer.PublicKey
+	h.is_peer_known = h.is_peer_known || peer.IsKnown
+	return nil
+}
+
+// Username Sent in a Request must be of Authenticated Listener, whose Key must be Known if 'must_be_known'
+func (h *ClientHandler) checkPeer(username string, must_be_known bool) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.peer_public_key == nil || username != h.peer_username {
+		return models.ErrPeerAuthFailed
+	}
+	if must_be_known && !h.is_peer_known {
+		return models.ErrUnknownPeer
+	}
+	return nil
+}
+
+func (h *ClientHandler) isPeerKnown() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.is_peer_known
+}
+
+func (h *ClientHandler) getCapabilities() models.Capability {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.capabilities
+}
+
+// Listeners that didn't Agree on a Protocol in Hello() are Older than models.MIN_PROTOCOL_VERSION
+func (h *ClientHandler) checkHello() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.protocol_version == 0 {
+		return models.ErrIncompatibleProtocol
+	}
+	return nil
+}
+
+// Listeners who were Issued an Access Token must Send it, with the Key it was Issued for
+// Only Listeners from before Tokens, who've no Record, can still use Workspace Password
+// Revoked Listeners're Refused either way
+func (h *ClientHandler) authenticateListener(workspace_name, username, encrypted_access_token, password string) error {
+	if encrypted_access_token == "" {
+		has_token, err := config.HasListenerToken(workspace_name, username)
+		if errors.Is(err, ErrListenerRevoked) || errors.Is(err, ErrNoSuchWorkspaceFound) {
+			return err
+		}
+		if err != nil {
+			logger.LOGGER.Println("Error while Checking Access Token of Listener:", err)
+			return ErrInternalSeverError
+		}
+		if has_token {
+			logger.LOGGER.Println("Listener was Issued an Access Token, but didn't Send it")
+			return ErrInvalidAccessToken
+		}
+
+		if _, err := config.AuthenticateWorkspaceInfo(workspace_name, password); err != nil {
+			logger.LOGGER.Println("Error: Incorrect Credentials for Workspace:", err)
+			return ErrIncorrectPassword
+		}
+		return nil
+	}
+
+	access_token, err := encrypt.RSADecryptData(encrypted_access_token)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Decrypt the Access Token Received from Listener:", err)
+		return ErrInvalidAccessToken
+	}
+
+	h.mutex.Lock()
+	public_key := h.peer_public_key
+	h.mutex.Unlock()
+
+	_, err = config.AuthenticateListenerToken(workspace_name, username, access_token, public_key)
+	if errors.Is(err, ErrListenerRevoked) || errors.Is(err, ErrInvalidAccessToken) || errors.Is(err, ErrNoSuchWorkspaceFound) {
+		return err
+	}
+	if err != nil {
+		logger.LOGGER.Println("Error while Authenticating Access Token:", err)
+		return ErrInternalSeverError
+	}
+	return nil
+}
+
+// Windows Agreed with Listener are Set in 'res', from my side
+func (h *ClientHandler) agreeKCPWindows(req models.GetMetaDataRequest, res *models.GetMetaDataResponse) {
+	h.mutex.Lock()
+	h.kcp_profile = dialer.KCP_PROFILE.AgreeWindows(req.KCPSendWindow, req.KCPRecvWindow)
+	profile := h.kcp_profile
+	h.mutex.Unlock()
+
+	if req.KCPSendWindow > 0 && req.KCPRecvWindow > 0 {
+		res.KCPSendWindow, res.KCPRecvWindow = profile.SendWindow, profile.RecvWindow
+		logger.LOGGER.Printf("KCP Windows Agreed with Listener, Send: %d, Recv: %d\n", profile.SendWindow, profile.RecvWindow)
+	}
+}
+
+// Called by Listener before any other Method, Features it doesn't Support aren't Used with it
+func (h *ClientHandler) Hello(req models.HelloRequest, res *models.HelloResponse) error {
+	logger.LOGGER.Println("Hello Called ...")
+	if err := h.checkPeer(req.Username, false); err != nil {
+		logger.LOGGER.Println("Hello Called by another User:", req.Username)
+		logger.LOGGER.Println("Source: Hello()")
+		return err
+	}
+
+	version, capabilities, err := models.NegotiateProtocol(req.ProtocolVersion, req.MinProtocolVersion, req.Capabilities)
+	if err != nil {
+		logger.LOGGER.Println("Error while Negotiating Protocol with Listener:", err)
+		logger.LOGGER.Println("Source: Hello()")
+		return err
+	}
+
+	h.mutex.Lock()
+	h.protocol_version = version
+	h.capabilities = capabilities
+	h.mutex.Unlock()
+
+	res.ProtocolVersion = version
+	res.Capabilities = capabilities
+	logger.LOGGER.Printf("Protocol Version: %d, Capabilities: %s Agreed with Listener: %s\n", version, capabilities, req.Username)
+	return nil
+}
+
+// Tells Listener how to Fetch Data during GetData, as per 'capabilities' Agreed with it
+func setDataCapabilities(res *models.GetMetaDataResponse, capabilities models.Capability) {
+	res.EncryptionVersion = encrypt.ENCRYPTION_VERSION_AEAD
+	if capabilities.Has(models.CAP_MULTI_STREAM) {
+		res.MaxStreams = MAX_DATA_STREAMS
+	}
+}
 
 func (h *ClientHandler) GetPublicKey(req models.PublicKeyRequest, res *models.PublicKeyResponse) error {
 	logger.LOGGER.Println("Get Public Key Called ...")
@@ -46,7 +228,13 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 	// 2. Authenticate Request [X]
 	// 3. Add the New Connection to the .PKr Config File [X]
 	// 4. Store the Public Key [X]
+	// 5. Issue Access Token bound to the Public Key [X]
 	logger.LOGGER.Println("Init New Work Space Connection Called ...")
+	if err := h.checkPeer(req.MyUsername, false); err != nil {
+		logger.LOGGER.Println("Init New Work Space Connection Called by another User:", req.MyUsername)
+		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
+		return err
+	}
 
 	password, err := encrypt.RSADecryptData(req.WorkspacePassword)
 	if err != nil {
@@ -57,12 +245,12 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 
 	_, err = config.AuthenticateWorkspaceInfo(req.WorkspaceName, password)
 	if err != nil {
-		if err.Error() == ErrIncorrectPassword.Error() {
+		if errors.Is(err, ErrIncorrectPassword) {
 			logger.LOGGER.Println("Error: Incorrect Credentials for Workspace")
 			logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
 			return ErrIncorrectPassword
 		}
-		if err.Error() == ErrNoSuchWorkspaceFound.Error() {
+		if errors.Is(err, ErrNoSuchWorkspaceFound) {
 			logger.LOGGER.Println("Error: No Such Workspace Found")
 			logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
 			return ErrNoSuchWorkspaceFound
@@ -72,6 +260,16 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 		return ErrInternalSeverError
 	}
 
+	// Revoked Listeners can't Connect again, even though they know the Password
+	if err = config.CheckListenerAccess(req.WorkspaceName, req.MyUsername); err != nil {
+		logger.LOGGER.Println("Listener can't Connect to Workspace:", err)
+		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
+		if errors.Is(err, ErrListenerRevoked) {
+			return ErrListenerRevoked
+		}
+		return ErrInternalSeverError
+	}
+
 	listener_public_key, err := base64.StdEncoding.DecodeString(string(req.MyPublicKey))
 	if err != nil {
 		logger.LOGGER.Println("Failed to Decode Public Key from base64:", err)
@@ -79,6 +277,25 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 		return ErrInternalSeverError
 	}
 
+	// Only the Key Listener Authenticated with is Registered & Stored, see dialer.AuthenticateListener()
+	authenticated_peer := dialer.AuthenticatedPeer{Username: req.MyUsername, PublicKey: listener_public_key}
+	if err = h.setAuthenticatedPeer(authenticated_peer); err != nil {
+		logger.LOGGER.Println("Public Key Sent isn't the one Listener Authenticated with")
+		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
+		return err
+	}
+
+	// Other Listeners're told about this Listener, so they can Fetch from each other
+	access_token, err := config.RegisterListenerOfSendWorkspace(req.WorkspaceName, req.MyUsername, listener_public_key)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Register Listener of Workspace:", err)
+		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
+		if errors.Is(err, models.ErrPeerAuthFailed) || errors.Is(err, ErrListenerRevoked) {
+			return err
+		}
+		return ErrInternalSeverError
+	}
+
 	// Save Public Key
 	err = config.StorePublicKeyOfOtherUser(req.MyUsername, listener_public_key)
 	if err != nil {
@@ -86,6 +303,18 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
 		return ErrInternalSeverError
 	}
+	authenticated_peer.IsKnown = true
+	if err = h.setAuthenticatedPeer(authenticated_peer); err != nil {
+		return err
+	}
+
+	// Session isn't Encrypted, so only Listener must be able to Read the Token
+	res.AccessToken, err = encrypt.RSAEncryptData(access_token, string(listener_public_key))
+	if err != nil {
+		logger.LOGGER.Println("Failed to Encrypt Access Token using Listener's Public Key:", err)
+		logger.LOGGER.Println("Source: InitNewWorkSpaceConnection()")
+		return ErrInternalSeverError
+	}
 
 	logger.LOGGER.Println("Init New Workspace Successful ...")
 	return nil
@@ -93,6 +322,16 @@ func (h *ClientHandler) InitNewWorkSpaceConnection(req models.InitWorkspaceConne
 
 func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.GetMetaDataResponse) error {
 	logger.LOGGER.Println("Get Meta Data Called ...")
+	if err := h.checkPeer(req.Username, true); err != nil {
+		logger.LOGGER.Println("Get Meta Data Called by Unauthenticated User:", req.Username)
+		logger.LOGGER.Println("Source: GetMetaData()")
+		return err
+	}
+	if err := h.checkHello(); err != nil {
+		logger.LOGGER.Println("Listener didn't Agree on Protocol before Get Meta Data:", req.Username)
+		logger.LOGGER.Println("Source: GetMetaData()")
+		return err
+	}
 
 	password, err := encrypt.RSADecryptData(req.WorkspacePassword)
 	if err != nil {
@@ -101,19 +340,36 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 		return ErrInternalSeverError
 	}
 
-	// Authenticates Workspace Name and Password and Get the Workspace File Path
-	_, err = config.AuthenticateWorkspaceInfo(req.WorkspaceName, password)
-	if err != nil {
-		if errors.Is(err, ErrIncorrectPassword) {
-			logger.LOGGER.Println("Error: Incorrect Credentials for Workspace")
-			logger.LOGGER.Println("Source: GetMetaData()")
-			return ErrIncorrectPassword
-		}
-		logger.LOGGER.Println("Failed to Authenticate Password of Listener:", err)
+	if req.EncryptionVersion != encrypt.ENCRYPTION_VERSION_AEAD {
+		logger.LOGGER.Println("Listener's Encryption Version isn't Supported:", req.EncryptionVersion)
 		logger.LOGGER.Println("Source: GetMetaData()")
-		return ErrIncorrectPassword
+		return ErrUnsupportedEncryptionVersion
+	}
+	// Later Sessions from Listener're Tuned & Rate Limited by what's Set here
+	h.agreeKCPWindows(req, res)
+
+	// Features not Agreed in Hello() aren't Offered, even if Listener Asks for them
+	capabilities := h.getCapabilities()
+	if !capabilities.Has(models.CAP_CHUNKS) {
+		req.SupportsChunks = false
+	}
+	if !capabilities.Has(models.CAP_COMPRESSION) {
+		req.ArchiveFormats = nil
+	}
+
+	// Another Listener of a Workspace I'm Listening to
+	if req.WorkspaceOwner != "" {
+		logger.LOGGER.Printf("Data Requested For Workspace: %s of User: %s by Peer\n", req.WorkspaceName, req.WorkspaceOwner)
+		return getMetaDataForPeer(req, res, password, capabilities)
+	}
+
+	if err = h.authenticateListener(req.WorkspaceName, req.Username, req.AccessToken, password); err != nil {
+		logger.LOGGER.Println("Failed to Authenticate Listener:", err)
+		logger.LOGGER.Println("Source: GetMetaData()")
+		return err
 	}
 	logger.LOGGER.Printf("Data Requested For Workspace: %s\n", req.WorkspaceName)
+	setDataCapabilities(res, capabilities)
 
 	workspace_path, err := config.GetSendWorkspaceFilePath(req.WorkspaceName)
 	if err != nil {
@@ -147,17 +403,43 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 
 	res.RequestPushRange = strconv.Itoa(workspace_conf.LastPushNum)
 	res.Updates = nil
+	res.ArchiveFormat = negotiateArchiveFormat(workspace_conf.ArchiveFormat, req.ArchiveFormats)
+	logger.LOGGER.Println("Archive Format:", res.ArchiveFormat)
+
+	// Keys of Archive Sent, each Archive is Sealed with its own
+	var key_path, iv_path string
 
 	// LastPushNum = -1 => Requesting for first time,i.e, Clone
 	if req.LastPushNum == -1 {
 		logger.LOGGER.Println("Clone")
-		file_info, err := os.Stat(zip_destination_path + strconv.Itoa(workspace_conf.LastPushNum) + ".zip")
+		archive_path := zip_destination_path + strconv.Itoa(workspace_conf.LastPushNum) + ".zip"
+		if res.ArchiveFormat == config.ARCHIVE_FORMAT_TAR_ZSTD {
+			tar_zstd_path, is_ready := getCloneTarZstd(workspace_path, workspace_conf.LastPushNum)
+			if is_ready {
+				archive_path = tar_zstd_path
+			} else {
+				logger.LOGGER.Println("Tar+Zstd Archive isn't Ready yet, Sending Zip")
+				res.ArchiveFormat = ""
+			}
+		}
+
+		key_path, iv_path = getArchiveKeyPaths(archive_path)
+
+		file_info, err := os.Stat(archive_path)
 		if err != nil {
-			logger.LOGGER.Println("Failed to Get FileInfo of Zip File:", err)
+			logger.LOGGER.Println("Failed to Get FileInfo of Archive:", err)
+			logger.LOGGER.Println("Source: GetMetaData()")
+			return ErrInternalSeverError
+		}
+		// Archive is Encrypted on the fly during Clone
+		res.LenData = int(encrypt.SealedSize(file_info.Size()))
+
+		res.ZipHash, err = encrypt.GenerateHashFromFileNames_BufferedAndPooled(archive_path)
+		if err != nil {
+			logger.LOGGER.Println("Failed to Generate Hash of Zip File:", err)
 			logger.LOGGER.Println("Source: GetMetaData()")
 			return ErrInternalSeverError
 		}
-		res.LenData = int(file_info.Size())
 	} else {
 		var zip_enc_filepath string
 		res.Updates = map[string]string{}
@@ -178,7 +460,24 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 		res.RequestPushRange = strconv.Itoa(req.LastPushNum) + "-" + strconv.Itoa(workspace_conf.LastPushNum)
 		logger.LOGGER.Println("Request Push Range:", res.RequestPushRange)
 
-		is_updates_cache_present, err := filetracker.AreUpdatesCached(workspace_path, res.RequestPushRange)
+		// Listener Fetches only the Chunks it doesn't have via GetChunks, so no Zip is needed
+		if req.SupportsChunks {
+			res.ArchiveFormat = ""
+			last_push_zip_path := filepath.Join(workspace_path, ".PKr", "Files", "Current", strconv.Itoa(workspace_conf.LastPushNum)+".zip")
+			res.FileChunks, err = getChunkLists(workspace_path, last_push_zip_path, res.RequestPushRange, workspace_conf.LastPushNum, merged_changes)
+			if err != nil {
+				logger.LOGGER.Println("Error while Getting Chunk Lists of Updated Files:", err)
+				logger.LOGGER.Println("Source: GetMetaData()")
+				return ErrInternalSeverError
+			}
+			res.UsesChunks = true
+			logger.LOGGER.Println("Updated Files'll be Sent as Chunks")
+			return fillPushInfo(req, res, workspace_path, workspace_conf, capabilities)
+		}
+
+		// Each Format is Cached Separately, under the Name Listener Requests it by
+		archive_name := config.GetArchiveName(res.RequestPushRange, res.ArchiveFormat)
+		is_updates_cache_present, err := filetracker.AreUpdatesCached(workspace_path, archive_name)
 		if err != nil {
 			logger.LOGGER.Println("Error while Checking Whether Updates're Already Cached or Not")
 			logger.LOGGER.Println("Source: GetMetaData()")
@@ -186,22 +485,42 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 		}
 		logger.LOGGER.Println("Is Update Cache Present:", is_updates_cache_present)
 
+		// Caches without Zip Hash can't be Verified by Listener & ones Encrypted before AEAD can't be Decrypted, so Regenerate them
+		changes_path := filepath.Join(workspace_path, ".PKr", "Files", "Changes", archive_name)
 		if is_updates_cache_present {
-			zip_destination_path = filepath.Join(workspace_path, ".PKr", "Files", "Changes", res.RequestPushRange) + string(filepath.Separator)
-			zip_enc_filepath = zip_destination_path + res.RequestPushRange + ".enc"
-		} else {
-			logger.LOGGER.Println("Generating Changes Zip")
+			_, err := os.Stat(filepath.Join(changes_path, "ZIP_HASH"))
+			if err != nil || !isSealedFile(filepath.Join(changes_path, archive_name+".enc")) {
+				logger.LOGGER.Println("Update Cache is Outdated, Regenerating it ...")
+				if err = os.RemoveAll(changes_path); err != nil {
+					logger.LOGGER.Println("Failed to Remove Outdated Update Cache:", err)
+					logger.LOGGER.Println("Source: GetMetaData()")
+					return ErrInternalSeverError
+				}
+				is_updates_cache_present = false
+			}
+		}
+
+		zip_destination_path = changes_path + string(filepath.Separator)
+		zip_enc_filepath = filepath.Join(changes_path, archive_name+".enc")
+		key_path, iv_path = filepath.Join(changes_path, "AES_KEY"), filepath.Join(changes_path, "AES_IV")
+		if !is_updates_cache_present {
+			logger.LOGGER.Println("Generating Changes Archive")
 			last_push_num_str := strconv.Itoa(workspace_conf.LastPushNum)
 			src_path := filepath.Join(workspace_path, ".PKr", "Files", "Current", last_push_num_str+".zip")
-			dst_path := filepath.Join(workspace_path, ".PKr", "Files", "Changes", res.RequestPushRange, res.RequestPushRange+".zip")
 
-			err = filetracker.ZipUpdates(merged_changes, src_path, dst_path)
+			var changes_archive_filepath string
+			if res.ArchiveFormat == config.ARCHIVE_FORMAT_TAR_ZSTD {
+				changes_archive_filepath = filepath.Join(changes_path, archive_name)
+				err = filetracker.TarZstdUpdates(merged_changes, src_path, changes_archive_filepath)
+			} else {
+				changes_archive_filepath = filepath.Join(changes_path, archive_name+".zip")
+				err = filetracker.ZipUpdates(merged_changes, src_path, changes_archive_filepath)
+			}
 			if err != nil {
-				logger.LOGGER.Println("Error while Creating Zip for Changes:", err)
+				logger.LOGGER.Println("Error while Creating Archive for Changes:", err)
 				logger.LOGGER.Println("Source: GetMetaData()")
 				return ErrInternalSeverError
 			}
-			changes_path := filepath.Join(workspace_path, ".PKr", "Files", "Changes", res.RequestPushRange)
 			logger.LOGGER.Println("Generating Keys for Changes File ...")
 
 			changes_key, err := encrypt.AESGenerakeKey(16)
@@ -232,17 +551,27 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 				return ErrInternalSeverError
 			}
 
-			changes_zipped_filepath := filepath.Join(changes_path, res.RequestPushRange+".zip")
-			changes_enc_zip_filepath := strings.Replace(changes_zipped_filepath, ".zip", ".enc", 1)
+			// Hash Plaintext Archive now, it's deleted after Encryption
+			changes_zip_hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(changes_archive_filepath)
+			if err != nil {
+				logger.LOGGER.Println("Failed to Generate Hash of Changes Archive:", err)
+				logger.LOGGER.Println("Source: GetMetaData()")
+				return ErrInternalSeverError
+			}
 
-			err = encrypt.EncryptZipFileAndStore(changes_zipped_filepath, changes_enc_zip_filepath, changes_key, changes_iv)
+			err = os.WriteFile(filepath.Join(changes_path, "ZIP_HASH"), []byte(changes_zip_hash), 0644)
 			if err != nil {
-				logger.LOGGER.Println("Error while Encrypting Zip File of Entire Workspace, Storing it & Deleting Zip File:", err)
+				logger.LOGGER.Println("Failed to Write Zip Hash to File:", err)
+				logger.LOGGER.Println("Source: GetMetaData()")
+				return ErrInternalSeverError
+			}
+
+			err = encrypt.EncryptZipFileAndStore(changes_archive_filepath, zip_enc_filepath, changes_key, changes_iv)
+			if err != nil {
+				logger.LOGGER.Println("Error while Encrypting Archive of Changes, Storing it & Deleting Archive:", err)
 				logger.LOGGER.Println("Source: GetMetaData()")
 				return ErrInternalSeverError
 			}
-			zip_destination_path = changes_path + string(filepath.Separator)
-			zip_enc_filepath = zip_destination_path + res.RequestPushRange + ".enc"
 		}
 		file_info, err := os.Stat(zip_enc_filepath)
 		if err != nil {
@@ -251,54 +580,200 @@ func (h *ClientHandler) GetMetaData(req models.GetMetaDataRequest, res *models.G
 			return ErrInternalSeverError
 		}
 		res.LenData = int(file_info.Size())
+
+		zip_hash, err := os.ReadFile(zip_destination_path + "ZIP_HASH")
+		if err != nil {
+			logger.LOGGER.Println("Failed to Read Zip Hash:", err)
+			logger.LOGGER.Println("Source: GetMetaData()")
+			return ErrInternalSeverError
+		}
+		res.ZipHash = string(zip_hash)
 	}
 
-	key, err := os.ReadFile(zip_destination_path + "AES_KEY")
+	key, err := os.ReadFile(key_path)
 	if err != nil {
 		logger.LOGGER.Println("Failed to Fetch AES Keys:", err)
 		logger.LOGGER.Println("Source: GetMetaData()")
 		return ErrInternalSeverError
 	}
 
-	iv, err := os.ReadFile(zip_destination_path + "AES_IV")
+	iv, err := os.ReadFile(iv_path)
 	if err != nil {
 		logger.LOGGER.Println("Failed to Fetch IV Keys:", err)
 		logger.LOGGER.Println("Source: GetMetaData()")
 		return ErrInternalSeverError
 	}
 
-	logger.LOGGER.Println("Fetching Public Key of Listener from Config")
-	public_key, err := config.GetPublicKeyUsingUsername(req.Username)
+	res.KeyBytes, res.IVBytes, err = encryptKeysForListener(req.Username, key, iv)
 	if err != nil {
-		logger.LOGGER.Println("Failed to Get Public Key of Listener Using Username:", err)
+		logger.LOGGER.Println("Failed to Encrypt AES Keys for Listener:", err)
 		logger.LOGGER.Println("Source: GetMetaData()")
 		return ErrInternalSeverError
 	}
+	return fillPushInfo(req, res, workspace_path, workspace_conf, capabilities)
+}
 
-	encrypt_key, err := encrypt.RSAEncryptData(string(key), string(public_key))
+// Files Encrypted before the Switch to AEAD have another Header & Layout
+func isSealedFile(file_path string) bool {
+	file, err := os.Open(file_path)
 	if err != nil {
-		logger.LOGGER.Println("Failed to Encrypt AES Keys using Listener's Public Key:", err)
-		logger.LOGGER.Println("Source: GetMetaData()")
-		return ErrInternalSeverError
+		return false
 	}
+	defer file.Close()
 
-	encrypt_iv, err := encrypt.RSAEncryptData(string(iv), string(public_key))
+	file_info, err := file.Stat()
 	if err != nil {
-		logger.LOGGER.Println("Failed to Encrypt IV Keys using Listener's Public Key:", err)
-		logger.LOGGER.Println("Source: GetMetaData()")
-		return ErrInternalSeverError
+		return false
+	}
+	if _, _, err = encrypt.SealedLayout(file_info.Size()); err != nil {
+		return false
+	}
+
+	header := make([]byte, encrypt.AEAD_HEADER_SIZE)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return header[0] == encrypt.ENCRYPTION_VERSION_AEAD
+}
+
+// Tar+Zstd is Sent only if Workspace is Configured for it & Listener can Extract it
+// Empty Format means Zip, which is all Older Listeners understand
+func negotiateArchiveFormat(workspace_archive_format string, listener_archive_formats []string) string {
+	if workspace_archive_format != config.ARCHIVE_FORMAT_TAR_ZSTD {
+		return ""
+	}
+	if !slices.Contains(listener_archive_formats, config.ARCHIVE_FORMAT_TAR_ZSTD) {
+		return ""
+	}
+	return config.ARCHIVE_FORMAT_TAR_ZSTD
+}
+
+// Tar+Zstd Archives being Built, by Path
+var clone_archive_builds sync.Map
+
+// Tar+Zstd of Push 'push_num' is Built at Push, see filetracker.ZipData()
+// Pushes made before the Workspace was Configured for it don't have it, it's Built in Background then,
+// as it can take longer than the RPC, false is Returned till it's Ready
+func getCloneTarZstd(workspace_path string, push_num int) (string, bool) {
+	current_path := filepath.Join(workspace_path, ".PKr", "Files", "Current")
+	push_name := strconv.Itoa(push_num)
+	archive_path := filepath.Join(current_path, config.GetArchiveName(push_name, config.ARCHIVE_FORMAT_TAR_ZSTD))
+	key_path, iv_path := getArchiveKeyPaths(archive_path)
+	if areFilesPresent(archive_path, key_path, iv_path) {
+		return archive_path, true
+	}
+
+	if _, is_building := clone_archive_builds.LoadOrStore(archive_path, struct{}{}); !is_building {
+		logger.LOGGER.Println("Building Tar+Zstd Archive of Push in Background:", push_num)
+		go func() {
+			defer clone_archive_builds.Delete(archive_path)
+			// Keys're Stored first, so an Archive is never Served without its own Keys
+			if err := storeArchiveKeys(archive_path); err != nil {
+				logger.LOGGER.Println("Error while Storing Keys of Tar+Zstd Archive:", err)
+				logger.LOGGER.Println("Source: getCloneTarZstd()")
+				return
+			}
+			if _, err := filetracker.StoreCloneTarZstd(current_path, push_name); err != nil {
+				logger.LOGGER.Println("Error while Building Tar+Zstd Archive of Push:", err)
+				logger.LOGGER.Println("Source: getCloneTarZstd()")
+				return
+			}
+			removeOldArchiveKeys(current_path, archive_path)
+		}()
+	}
+	return "", false
+}
+
+func areFilesPresent(file_paths ...string) bool {
+	for _, file_path := range file_paths {
+		if _, err := os.Stat(file_path); err != nil {
+			return false
+		}
 	}
+	return true
+}
 
-	res.KeyBytes = []byte(encrypt_key)
-	res.IVBytes = []byte(encrypt_iv)
+// Zip of Push is Sealed with Key & IV in Current, Tar+Zstd of it with its own Key & IV Stored next to it
+// Each Sealed Stream needs its own Key, as Nonces of Chunks're the same for every Stream Sealed with an IV
+func getArchiveKeyPaths(archive_path string) (string, string) {
+	if strings.HasSuffix(archive_path, "."+config.ARCHIVE_FORMAT_TAR_ZSTD) {
+		return archive_path + ".AES_KEY", archive_path + ".AES_IV"
+	}
+	current_path := filepath.Dir(archive_path)
+	return filepath.Join(current_path, "AES_KEY"), filepath.Join(current_path, "AES_IV")
+}
 
+func readArchiveKeys(archive_path string) ([]byte, []byte, error) {
+	key_path, iv_path := getArchiveKeyPaths(archive_path)
+	key, err := os.ReadFile(key_path)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := os.ReadFile(iv_path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, iv, nil
+}
+
+// Fresh Key & IV for an Archive which isn't Sealed with the ones in Current
+func storeArchiveKeys(archive_path string) error {
+	key_path, iv_path := getArchiveKeyPaths(archive_path)
+	key, err := encrypt.AESGenerakeKey(16)
+	if err != nil {
+		return err
+	}
+	iv, err := encrypt.AESGenerateIV()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(key_path, key, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(iv_path, iv, 0600)
+}
+
+// Keys of Tar+Zstd Archives of Older Pushes, their Archives're Removed by filetracker.StoreCloneTarZstd()
+func removeOldArchiveKeys(current_path, archive_path string) {
+	key_paths, err := filepath.Glob(filepath.Join(current_path, "*."+config.ARCHIVE_FORMAT_TAR_ZSTD+".AES_*"))
+	if err != nil {
+		return
+	}
+	for _, key_path := range key_paths {
+		if strings.HasPrefix(key_path, archive_path+".") {
+			continue
+		}
+		if err = os.Remove(key_path); err != nil {
+			logger.LOGGER.Println("Error while Removing Keys of Old Tar+Zstd Archive:", err)
+			logger.LOGGER.Println("Source: removeOldArchiveKeys()")
+		}
+	}
+}
+
+// Info about Latest Push, Common to every kind of Transfer
+func fillPushInfo(req models.GetMetaDataRequest, res *models.GetMetaDataResponse, workspace_path string, workspace_conf config.PKRConfig, capabilities models.Capability) error {
 	res.LastPushNum = workspace_conf.LastPushNum
 	res.LastPushDesc = workspace_conf.AllUpdates[workspace_conf.LastPushNum].PushDesc
 
+	// Listeners Reject the Push without Signed Manifest
+	user_conf, err := config.ReadFromUserConfigFile()
+	if err == nil {
+		res.Manifest, err = config.GetPushManifest(workspace_path, user_conf.Username, workspace_conf)
+	}
+	if err != nil {
+		logger.LOGGER.Println("Error while Getting Signed Push Manifest:", err)
+		logger.LOGGER.Println("Source: fillPushInfo()")
+		return ErrInternalSeverError
+	}
+	res.Peers = getPeersOfListener(req.WorkspaceName, req.Username)
+
 	logger.LOGGER.Println("Len Data:", res.LenData)
 	logger.LOGGER.Println("Request Push Range:", res.RequestPushRange)
 	logger.LOGGER.Println("Last Push Num:", res.LastPushNum)
 	logger.LOGGER.Println("Last Push Desc:", res.LastPushDesc)
+	logger.LOGGER.Println("Zip Hash:", res.ZipHash)
+	logger.LOGGER.Println("Uses Chunks:", res.UsesChunks)
+	logger.LOGGER.Println("Archive Format:", res.ArchiveFormat)
 
 	logger.LOGGER.Println("Get Meta Data Successful ...")
 	return nil
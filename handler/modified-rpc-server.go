@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"go/token"
 	"io"
 	"net"
@@ -12,6 +13,7 @@ import (
 	"sync"
 
 	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
 )
 
 // Precompute the reflect type for error.
@@ -45,10 +47,11 @@ type Request struct {
 // but documented here as an aid to debugging, such as when analyzing
 // network traffic.
 type Response struct {
-	ServiceMethod string    // echoes that of the Request
-	Seq           uint64    // echoes that of the request
-	Error         string    // error, if any.
-	next          *Response // for free list in Server
+	ServiceMethod string           // echoes that of the Request
+	Seq           uint64           // echoes that of the request
+	Error         string           // error, if any.
+	ErrorCode     models.ErrorCode // code of error, if it has one, see dialer.NewRPCClient()
+	next          *Response        // for free list in Server
 }
 
 // Server represents an RPC Server.
@@ -213,12 +216,13 @@ func suitableMethods(typ reflect.Type, logErr bool) map[string]*methodType {
 // contains an error when it is used.
 var invalidRequest = struct{}{}
 
-func (server *Server) sendResponse(sending *sync.Mutex, req *Request, reply any, codec ServerCodec, errmsg string) {
+func (server *Server) sendResponse(sending *sync.Mutex, req *Request, reply any, codec ServerCodec, errmsg string, errcode models.ErrorCode) {
 	resp := server.getResponse()
 	// Encode the response header
 	resp.ServiceMethod = req.ServiceMethod
 	if errmsg != "" {
 		resp.Error = errmsg
+		resp.ErrorCode = errcode
 		reply = invalidRequest
 	}
 	resp.Seq = req.Seq
@@ -251,10 +255,12 @@ func (s *service) call(server *Server, sending *sync.Mutex, wg *sync.WaitGroup,
 	// The return value for the method is an error.
 	errInter := returnValues[0].Interface()
 	errmsg := ""
+	var errcode models.ErrorCode
 	if errInter != nil {
 		errmsg = errInter.(error).Error()
+		errcode = models.GetErrorCode(errInter.(error))
 	}
-	server.sendResponse(sending, req, replyv.Interface(), codec, errmsg)
+	server.sendResponse(sending, req, replyv.Interface(), codec, errmsg, errcode)
 	server.freeRequest(req)
 }
 
@@ -322,6 +328,38 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	server.ServeCodec(srv)
 }
 
+// MY CHANGE START
+// RefuseConn Answers the first Request on 'conn' with 'err', without Calling its Method
+// Older Clients which don't Authenticate Sessions get an Error they can Read, instead of a Dropped Session
+func RefuseConn(conn io.ReadWriteCloser, err error) error {
+	buf := bufio.NewWriter(conn)
+	codec := &gobServerCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	}
+
+	var req Request
+	if read_err := codec.ReadRequestHeader(&req); read_err != nil {
+		return read_err
+	}
+	// Body isn't needed, Decoding into nil Discards it
+	if read_err := codec.ReadRequestBody(nil); read_err != nil {
+		return read_err
+	}
+
+	resp := &Response{
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+		Error:         err.Error(),
+		ErrorCode:     models.GetErrorCode(err),
+	}
+	return codec.WriteResponse(resp, invalidRequest)
+}
+
+// MY CHANGE END
+
 // ServeCodec is like [ServeConn] but uses the specified codec to
 // decode requests and encode responses.
 func (server *Server) ServeCodec(codec ServerCodec) {
@@ -338,7 +376,7 @@ func (server *Server) ServeCodec(codec ServerCodec) {
 			}
 			// send a response if we actually managed to read a header.
 			if req != nil {
-				server.sendResponse(sending, req, invalidRequest, codec, err.Error())
+				server.sendResponse(sending, req, invalidRequest, codec, err.Error(), models.GetErrorCode(err))
 				server.freeRequest(req)
 			}
 			continue
@@ -346,8 +384,8 @@ func (server *Server) ServeCodec(codec ServerCodec) {
 		wg.Add(1)
 		go service.call(server, sending, wg, mtype, req, argv, replyv, codec)
 		// MY CHANGE START
-		// Close RPC after responding to "GetMetaData"
-		if mtype.method.Name == "GetMetaData" {
+		// Close RPC after responding to "GetMetaData" or "GetChunks"
+		if mtype.method.Name == "GetMetaData" || mtype.method.Name == "GetChunks" {
 			wg.Wait()
 			codec.Close()
 			return
@@ -371,7 +409,7 @@ func (server *Server) ServeRequest(codec ServerCodec) error {
 		}
 		// send a response if we actually managed to read a header.
 		if req != nil {
-			server.sendResponse(sending, req, invalidRequest, codec, err.Error())
+			server.sendResponse(sending, req, invalidRequest, codec, err.Error(), models.GetErrorCode(err))
 			server.freeRequest(req)
 		}
 		return err
@@ -484,16 +522,19 @@ func (server *Server) readRequestHeader(codec ServerCodec) (svc *service, mtype
 	methodName := req.ServiceMethod[dot+1:]
 
 	// Look up the request.
+	// MY CHANGE START
+	// Coded, so Listeners can tell an Older Peer without some Method, see dialer.CallHello()
 	svci, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc: can't find service " + req.ServiceMethod)
+		err = fmt.Errorf("%w: can't find service %s", models.ErrUnknownMethod, req.ServiceMethod)
 		return
 	}
 	svc = svci.(*service)
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc: can't find method " + req.ServiceMethod)
+		err = fmt.Errorf("%w: can't find method %s", models.ErrUnknownMethod, req.ServiceMethod)
 	}
+	// MY CHANGE END
 	return
 }
 
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"io"
 	"math/rand"
 	"net"
 	"slices"
@@ -9,8 +10,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/PKr-Parivar/PKr-Base/config"
 	"github.com/PKr-Parivar/PKr-Base/dialer"
+	"github.com/PKr-Parivar/PKr-Base/framing"
 	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
 	"github.com/PKr-Parivar/PKr-Base/utils"
 
 	"github.com/PKr-Parivar/kcp-go"
@@ -25,7 +29,8 @@ var clientHandlerNameManager = ClientHandlerNameManager{
 	RandomStringList: []string{},
 }
 
-func HandleNotifyToPunchRequest(peer_public_ip, peer_public_port string, peer_private_ip string, peer_private_port string) (string, string, string, string, error) {
+// 'listener_username' is who Server says Requested the Punch, Empty if Server is Older
+func HandleNotifyToPunchRequest(listener_username, peer_public_ip, peer_public_port string, peer_private_ip string, peer_private_port string) (string, string, string, string, error) {
 	local_port := rand.Intn(16384) + 16384
 	logger.LOGGER.Println("My Local Port:", local_port)
 
@@ -92,28 +97,42 @@ func HandleNotifyToPunchRequest(peer_public_ip, peer_public_port string, peer_pr
 		}
 
 		logger.LOGGER.Println("Starting New New Server `Connection` server on local port:", local_port)
-		StartNewNewServer(udp_conn, client_handler_name)
+		StartNewNewServer(udp_conn, client_handler_name, listener_username)
 	}()
 
 	// Sending Response to Server
 	return my_public_IP_only, my_public_port_only, my_private_ip, strconv.Itoa(local_port), nil
 }
 
-func StartNewNewServer(udp_conn *net.UDPConn, clientHandlerName string) {
+func StartNewNewServer(udp_conn *net.UDPConn, clientHandlerName, listener_username string) {
 	logger.LOGGER.Println("ClientHandler"+clientHandlerName, "Started")
-	err := RegisterName("ClientHandler"+clientHandlerName, &ClientHandler{})
+	user_conf, err := config.ReadFromUserConfigFile()
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading User Config File:", err)
+		logger.LOGGER.Println("Source: StartNewNewServer()")
+		return
+	}
+
+	client_handler := &ClientHandler{kcp_profile: dialer.KCP_PROFILE, peer_username: listener_username}
+	err = RegisterName("ClientHandler"+clientHandlerName, client_handler)
 	if err != nil {
 		logger.LOGGER.Println("Error while Register ClientHandler:", err)
 		logger.LOGGER.Println("Source: StartNewNewServer()")
 		return
 	}
 
-	kcp_lis, err := kcp.ListenWithOptionsAndConn(udp_conn, nil, 0, 0)
+	// Sessions're told apart by Conv ID too, so a Listener can Fetch over Parallel Sessions
+	// FEC Shards're of the Listener, so they can't be Changed per Session
+	kcp_lis, err := kcp.ServeConn(nil, dialer.KCP_PROFILE.DataShards, dialer.KCP_PROFILE.ParityShards, dialer.NewConvPacketConn(udp_conn))
 	if err != nil {
 		logger.LOGGER.Println("Error while Listening KCP With Options & Conn:", err)
 		logger.LOGGER.Println("Source: StartNewNewServer()")
 		return
 	}
+	if err = kcp_lis.SetDSCP(dialer.KCP_PROFILE.DSCP); err != nil {
+		logger.LOGGER.Println("Error while Setting DSCP of KCP Listener:", err)
+		logger.LOGGER.Println("Source: StartNewNewServer()")
+	}
 	logger.LOGGER.Println("Started New KCP Server Started ...")
 
 	err = kcp_lis.SetReadDeadline(time.Now().Add(5 * time.Minute))
@@ -135,32 +154,57 @@ func StartNewNewServer(udp_conn *net.UDPConn, clientHandlerName string) {
 		}
 		logger.LOGGER.Println("New Incoming Connection in NewNewServer from:", kcp_session.RemoteAddr())
 
-		// KCP Params for Congestion Control
-		kcp_session.SetWindowSize(128, 1024)
-		kcp_session.SetNoDelay(1, 10, 2, 1)
-		kcp_session.SetACKNoDelay(true)
-		kcp_session.SetDSCP(46)
+		// KCP Params for Congestion Control, Windows're Agreed with Listener once it Calls GetMetaData
+		dialer.ApplyKCPProfile(kcp_session, client_handler.getKCPProfile())
 
 		go func() {
 			defer kcp_session.Close()
 			logger.LOGGER.Println("Deciding the Type of Session ...")
 
+			// Listener Authenticates first, Unauthenticated Sessions of Older Listeners're Refused
 			var buff [3]byte
-			_, err = kcp_session.Read(buff[:])
+			if _, err := io.ReadFull(kcp_session, buff[:]); err != nil {
+				logger.LOGGER.Println("Error while Reading the type of Session:", err)
+				logger.LOGGER.Println("Source: StartNewNewServer()")
+				return
+			}
+			if string(buff[:]) != dialer.AUTH_SESSION_TAG {
+				logger.LOGGER.Println("Listener didn't Authenticate the Session, Refusing it:", string(buff[:]))
+				refuseUnauthenticatedSession(kcp_session, buff)
+				return
+			}
+
+			peer, err := dialer.AuthenticateListener(kcp_session, user_conf.Username, client_handler.getPeerUsername())
+			if err == nil {
+				err = client_handler.setAuthenticatedPeer(peer)
+			}
 			if err != nil {
+				logger.LOGGER.Println("Error while Authenticating Listener:", err)
+				logger.LOGGER.Println("Source: StartNewNewServer()")
+				return
+			}
+			logger.LOGGER.Println("Session Authenticated, Listener:", peer.Username, "Known:", peer.IsKnown)
+
+			if _, err = io.ReadFull(kcp_session, buff[:]); err != nil {
 				logger.LOGGER.Println("Error while Reading the type of Session(KCP-RPC or KCP-Plain):", err)
 				logger.LOGGER.Println("Source: StartNewNewServer()")
 				return
 			}
 			logger.LOGGER.Println("Type of Session Received from Listener ...")
 
-			kcp_buff := [3]byte{'K', 'C', 'P'}
 			rpc_buff := [3]byte{'R', 'P', 'C'}
+			framed_buff := [3]byte([]byte(framing.SESSION_TAG))
 
 			switch buff {
-			case kcp_buff:
+			case framed_buff:
 				logger.LOGGER.Println("KCP-Plain:", kcp_session.RemoteAddr().String())
-				GetDataHandler(kcp_session)
+				// Data is only Served once Listener's Key is Stored
+				if !client_handler.isPeerKnown() {
+					logger.LOGGER.Println("Listener's Public Key isn't Known, Refusing Data Session")
+					framing.WriteErrorFrame(kcp_session, models.ErrUnknownPeer)
+					return
+				}
+				GetDataHandler(kcp_session, peer.Username)
 			case rpc_buff:
 				logger.LOGGER.Println("KCP-RPC:", kcp_session.RemoteAddr().String())
 				ServeConn(kcp_session)
@@ -170,3 +214,28 @@ func StartNewNewServer(udp_conn *net.UDPConn, clientHandlerName string) {
 		}()
 	}
 }
+
+// Older Listeners Send Type of Session right away, each Type gets models.ErrIncompatibleProtocol in a Form it can Read
+func refuseUnauthenticatedSession(kcp_session *kcp.UDPSession, session_type [3]byte) {
+	if err := kcp_session.SetDeadline(time.Now().Add(dialer.AUTH_TIMEOUT)); err != nil {
+		logger.LOGGER.Println("Error while Setting Deadline for Refused Session:", err)
+		logger.LOGGER.Println("Source: refuseUnauthenticatedSession()")
+		return
+	}
+
+	var err error
+	switch string(session_type[:]) {
+	case "KCP":
+		_, err = kcp_session.Write(models.NewErrorFrame(models.ErrIncompatibleProtocol))
+	case framing.SESSION_TAG:
+		err = framing.WriteErrorFrame(kcp_session, models.ErrIncompatibleProtocol)
+	case "RPC":
+		err = RefuseConn(kcp_session, models.ErrIncompatibleProtocol)
+	default:
+		return
+	}
+	if err != nil {
+		logger.LOGGER.Println("Error while Refusing Unauthenticated Session:", err)
+		logger.LOGGER.Println("Source: refuseUnauthenticatedSession()")
+	}
+}
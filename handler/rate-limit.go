@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+)
+
+// Data Served to Listeners is Limited by one Token Bucket for all Sessions, & one per Listener
+// Limits're from config.BandwidthConfig, Re-Read every BANDWIDTH_REFRESH_INTERVAL
+
+const (
+	BANDWIDTH_REFRESH_INTERVAL = 30 * time.Second
+	BANDWIDTH_UNIT             = 1024 // Limits in Config're in KB/s
+)
+
+var BANDWIDTH_LIMITER = newBandwidthLimiter()
+
+// Holds upto a Second worth of Tokens
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64 // Bytes per Second, Unlimited if 0
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setRate(bytes_per_sec int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if float64(bytes_per_sec) == b.rate {
+		return
+	}
+	b.rate = float64(bytes_per_sec)
+	b.tokens = b.rate
+	b.last = time.Now()
+}
+
+// Takes 'n' Tokens, & Returns how long to Wait till they'd have been Available
+// Tokens go Negative, so Sessions Waiting on the same Bucket're Served one after another
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type peerBucket struct {
+	bucket   tokenBucket
+	sessions int
+}
+
+type bandwidthLimiter struct {
+	mutex  sync.Mutex
+	conf   config.BandwidthConfig
+	global tokenBucket
+	peers  map[string]*peerBucket
+}
+
+func newBandwidthLimiter() *bandwidthLimiter {
+	return &bandwidthLimiter{peers: map[string]*peerBucket{}}
+}
+
+// Minutes since Midnight of "HH:MM"
+func parseTimeOfDay(time_of_day string) (int, error) {
+	t, err := time.Parse("15:04", time_of_day)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func isInBandwidthWindow(window config.BandwidthWindow, now time.Time) (bool, error) {
+	start, err := parseTimeOfDay(window.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseTimeOfDay(window.End)
+	if err != nil {
+		return false, err
+	}
+
+	minutes := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return start <= minutes && minutes < end, nil
+	}
+	// Window Wraps past Midnight
+	return minutes >= start || minutes < end, nil
+}
+
+// Upload & Default Peer Limits at 'now', First Matching Window wins
+func getActiveLimits(conf config.BandwidthConfig, now time.Time) (int, int) {
+	for _, window := range conf.Windows {
+		ok, err := isInBandwidthWindow(window, now)
+		if err != nil {
+			logger.LOGGER.Printf("Invalid Bandwidth Window %s-%s: %v\n", window.Start, window.End, err)
+			logger.LOGGER.Println("Source: getActiveLimits()")
+			continue
+		}
+		if ok {
+			return window.UploadLimit, window.PeerLimit
+		}
+	}
+	return conf.UploadLimit, conf.PeerLimit
+}
+
+func (l *bandwidthLimiter) getPeerRate(peer string, default_limit int) int {
+	if limit, ok := l.conf.PeerLimits[peer]; ok {
+		return limit * BANDWIDTH_UNIT
+	}
+	return default_limit * BANDWIDTH_UNIT
+}
+
+// Sets Limits of 'conf' which're Active at 'now', Sessions already Running're Limited too
+func (l *bandwidthLimiter) apply(conf config.BandwidthConfig, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.conf = conf
+	upload_limit, peer_limit := getActiveLimits(conf, now)
+	l.global.setRate(upload_limit * BANDWIDTH_UNIT)
+	for peer, peer_bucket := range l.peers {
+		peer_bucket.bucket.setRate(l.getPeerRate(peer, peer_limit))
+	}
+}
+
+// Bucket of 'peer', Shared by all its Sessions, must be Released once Session Ends
+func (l *bandwidthLimiter) acquirePeer(peer string) *tokenBucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	peer_bucket, ok := l.peers[peer]
+	if !ok {
+		peer_bucket = &peerBucket{}
+		_, peer_limit := getActiveLimits(l.conf, time.Now())
+		peer_bucket.bucket.setRate(l.getPeerRate(peer, peer_limit))
+		l.peers[peer] = peer_bucket
+	}
+	peer_bucket.sessions += 1
+	return &peer_bucket.bucket
+}
+
+func (l *bandwidthLimiter) releasePeer(peer string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	peer_bucket, ok := l.peers[peer]
+	if !ok {
+		return
+	}
+	peer_bucket.sessions -= 1
+	if peer_bucket.sessions <= 0 {
+		delete(l.peers, peer)
+	}
+}
+
+// Blocks till 'n' Bytes can be Sent to Peer of 'peer_bucket'
+func (l *bandwidthLimiter) wait(peer_bucket *tokenBucket, n int) {
+	delay := l.global.take(n)
+	if peer_bucket != nil {
+		delay = max(delay, peer_bucket.take(n))
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Applies 'conf', then Re-Reads it from User Config every BANDWIDTH_REFRESH_INTERVAL
+// So Edits to Config & Time of Day Windows take Effect without a Restart
+func StartBandwidthScheduler(conf config.BandwidthConfig) {
+	BANDWIDTH_LIMITER.apply(conf, time.Now())
+	logBandwidthLimits(conf)
+
+	go func() {
+		ticker := time.NewTicker(BANDWIDTH_REFRESH_INTERVAL)
+		defer ticker.Stop()
+		for range ticker.C {
+			user_conf, err := config.ReadFromUserConfigFile()
+			if err != nil {
+				// Config might be in the middle of being Written, Previous one is Used till next Refresh
+				logger.LOGGER.Println("Error while Reloading Bandwidth Limits:", err)
+				logger.LOGGER.Println("Source: StartBandwidthScheduler()")
+				BANDWIDTH_LIMITER.apply(conf, time.Now())
+				continue
+			}
+			conf = user_conf.Bandwidth
+			BANDWIDTH_LIMITER.apply(conf, time.Now())
+		}
+	}()
+}
+
+func logBandwidthLimits(conf config.BandwidthConfig) {
+	format_limit := func(limit int) string {
+		if limit <= 0 {
+			return "Unlimited"
+		}
+		return fmt.Sprintf("%d KB/s", limit)
+	}
+	logger.LOGGER.Printf("Upload Limit: %s, Per Listener: %s, Time Windows: %d\n", format_limit(conf.UploadLimit), format_limit(conf.PeerLimit), len(conf.Windows))
+}
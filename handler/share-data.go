@@ -2,173 +2,331 @@ package handler
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/PKr-Parivar/PKr-Base/config"
 	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/framing"
 	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
 	"github.com/PKr-Parivar/kcp-go"
 )
 
 const DATA_CHUNK = encrypt.DATA_CHUNK
 const FLUSH_AFTER_EVERY_X_MB = encrypt.FLUSH_AFTER_EVERY_X_MB
 
-func sendErrorMessage(kcp_session *kcp.UDPSession, error_msg string) {
-	_, err := kcp_session.Write([]byte(error_msg))
-	if err != nil {
+// Max Num of Parallel Sessions a Listener may Open to Fetch Ranges of the same File
+const MAX_DATA_STREAMS = 8
+
+var ErrInvalidDataRange = errors.New("invalid data range")
+
+// Data Sessions each Listener has Open, Listeners're told MAX_DATA_STREAMS but mustn't be Trusted to keep to it
+var (
+	data_streams_mutex sync.Mutex
+	data_streams       = map[string]int{}
+)
+
+func acquireDataStream(peer string) bool {
+	data_streams_mutex.Lock()
+	defer data_streams_mutex.Unlock()
+	if data_streams[peer] >= MAX_DATA_STREAMS {
+		return false
+	}
+	data_streams[peer] += 1
+	return true
+}
+
+func releaseDataStream(peer string) {
+	data_streams_mutex.Lock()
+	defer data_streams_mutex.Unlock()
+	data_streams[peer] -= 1
+	if data_streams[peer] <= 0 {
+		delete(data_streams, peer)
+	}
+}
+
+// KCP-Plain Session, always Framed, see framing package
+type dataSession struct {
+	kcp_session *kcp.UDPSession
+	peer_bucket *tokenBucket
+	// Result of Reading Listener's Frames, nil once it Acks, see watchListener()
+	listener_done chan error
+}
+
+// Splits Writes into DATA_CHUNK sized Data Frames, each Waits for BANDWIDTH_LIMITER
+func (s *dataSession) Write(data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		end := min(written+DATA_CHUNK, len(data))
+		BANDWIDTH_LIMITER.wait(s.peer_bucket, end-written)
+		if err := framing.WriteFrame(s.kcp_session, framing.FRAME_DATA, data[written:end]); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// Sent in place of Data
+func (s *dataSession) sendError(error_to_send error) {
+	if err := framing.WriteErrorFrame(s.kcp_session, error_to_send); err != nil {
 		logger.LOGGER.Println("Error while Sending Error Message:", err)
-		logger.LOGGER.Println("Source: sendMessage()")
+		logger.LOGGER.Println("Source: sendError()")
+	}
+}
+
+// Header is the only Frame Read before Sending, Listener's Frames after it're Read in a go routine while Data is Sent
+// It Ends once Listener Acks, or Session is Closed
+func (s *dataSession) watchListener() {
+	s.listener_done = make(chan error, 1)
+	go func() {
+		for {
+			frame, err := framing.ReadFrame(s.kcp_session)
+			if err != nil {
+				s.listener_done <- err
+				return
+			}
+
+			switch frame.Type {
+			case framing.FRAME_PROGRESS:
+				var progress models.DataProgress
+				if err = json.Unmarshal(frame.Payload, &progress); err != nil {
+					s.listener_done <- err
+					return
+				}
+				logger.LOGGER.Printf("Listener has Received Chunks till %d of %d\n", progress.NextChunk, progress.EndChunk)
+			case framing.FRAME_ACK:
+				s.listener_done <- nil
+				return
+			case framing.FRAME_ERROR:
+				s.listener_done <- frame.Err()
+				return
+			default:
+				s.listener_done <- fmt.Errorf("%w: %s", framing.ErrUnexpectedFrame, frame.Type)
+				return
+			}
+		}
+	}()
+}
+
+func (s *dataSession) waitForDataReceived() {
+	logger.LOGGER.Println("Done Sent, now waiting for ack from listener ...")
+	if err := <-s.listener_done; err != nil {
+		logger.LOGGER.Println("Error while Waiting for Ack from Listener:", err)
+		logger.LOGGER.Println("Source: waitForDataReceived()")
+		return
+	}
+	logger.LOGGER.Println("Data Transfer Completed")
+}
+
+// Parses "<Start Offset>" or "<Start Offset>-<End Offset>" into Chunk Indices
+// Offsets're in Plaintext Bytes & must be at Chunk Boundaries, End is Excluded
+func parseDataRange(data_range string) (int64, int64, error) {
+	start_str, end_str, has_end := strings.Cut(data_range, "-")
+	start_offset, err := strconv.ParseInt(start_str, 10, 64)
+	if err != nil || start_offset < 0 || start_offset%encrypt.AEAD_CHUNK != 0 {
+		return 0, 0, ErrInvalidDataRange
+	}
+
+	end_index := int64(math.MaxInt64)
+	if has_end {
+		end_offset, err := strconv.ParseInt(end_str, 10, 64)
+		if err != nil || end_offset < start_offset || end_offset%encrypt.AEAD_CHUNK != 0 {
+			return 0, 0, ErrInvalidDataRange
+		}
+		end_index = end_offset / encrypt.AEAD_CHUNK
 	}
+	return start_offset / encrypt.AEAD_CHUNK, end_index, nil
 }
 
-func handleClone(kcp_session *kcp.UDPSession, zip_path string, len_data_bytes int, workspace_path string) {
-	curr_dir := filepath.Join(workspace_path, ".PKr", "Files", "Current") + string(filepath.Separator)
-	key, err := os.ReadFile(curr_dir + "AES_KEY")
+// 'archive_name' is Push Num for Zip, or Name given by config.GetArchiveName() for other Formats
+func getCloneArchivePath(workspace_path, archive_name string) string {
+	current_path := filepath.Join(workspace_path, ".PKr", "Files", "Current")
+	if strings.HasSuffix(archive_name, "."+config.ARCHIVE_FORMAT_TAR_ZSTD) {
+		return filepath.Join(current_path, archive_name)
+	}
+	return filepath.Join(current_path, archive_name+".zip")
+}
+
+// Current Archive isn't Stored Encrypted, so it's Sealed on the fly, with Keys of its Format, see getArchiveKeyPaths()
+func handleClone(session *dataSession, zip_path string, len_data_bytes int, start_index, end_index int64) {
+	key, iv, err := readArchiveKeys(zip_path)
 	if err != nil {
-		logger.LOGGER.Println("Error while Reading AES Key:", err)
+		logger.LOGGER.Println("Error while Reading AES Key & IV of Archive:", err)
 		logger.LOGGER.Println("Source: handleClone()")
+		session.sendError(ErrInternalSeverError)
 		return
 	}
 
-	iv, err := os.ReadFile(curr_dir + "AES_IV")
+	chunk_cipher, err := encrypt.NewChunkCipher(key, iv)
 	if err != nil {
-		logger.LOGGER.Println("Error while Reading AES IV:", err)
+		logger.LOGGER.Println("Error while Creating Chunk Cipher:", err)
 		logger.LOGGER.Println("Source: handleClone()")
+		session.sendError(ErrInternalSeverError)
 		return
 	}
 
 	zip_file_obj, err := os.Open(zip_path)
 	if err != nil {
 		logger.LOGGER.Println("Error while Opening Destination File:", err)
-		logger.LOGGER.Println("Source: GetDataHandler()")
-		sendErrorMessage(kcp_session, "Internal Server Error")
+		logger.LOGGER.Println("Source: handleClone()")
+		session.sendError(ErrInternalSeverError)
 		return
 	}
 	defer zip_file_obj.Close()
 
-	var buff [512]byte
-	buffer := make([]byte, DATA_CHUNK)
-	reader := bufio.NewReader(zip_file_obj)
+	_, err = zip_file_obj.Seek(start_index*encrypt.AEAD_CHUNK, io.SeekStart)
+	if err != nil {
+		logger.LOGGER.Println("Error while Seeking to Resume Offset:", err)
+		logger.LOGGER.Println("Source: handleClone()")
+		session.sendError(ErrInternalSeverError)
+		return
+	}
 	logger.LOGGER.Println("Length of File:", len_data_bytes)
 
 	logger.LOGGER.Println("Preparing to Transfer Data for Clone")
-	for {
-		n, err := reader.Read(buffer)
-		if err != nil {
-			if err == io.EOF {
-				logger.LOGGER.Println("Done Sent, now waiting for ack from listener ...")
-				n, err := kcp_session.Read(buff[:])
-				if err != nil {
-					logger.LOGGER.Println("Error while Reading 'Data Received' Message from Listener:", err)
-					logger.LOGGER.Println("Source: GetDataHandler()")
-					return
-				}
-				// Data Received
-				msg := string(buff[:n])
-				if msg == "Data Received" {
-					logger.LOGGER.Println("Data Transfer Completed")
-					return
-				}
-				logger.LOGGER.Println("Received Unexpected Message:", msg)
-				return
-			}
-			logger.LOGGER.Println("Error while Sending Workspace Chunk:", err)
-			logger.LOGGER.Println("Source: GetDataHandler()")
-			sendErrorMessage(kcp_session, "Internal Server Error")
-			return
-		}
-
-		if n > 0 {
-			buffer, err = encrypt.EncryptDecryptChunk(buffer[:n], key, iv)
-			if err != nil {
-				logger.LOGGER.Println("Error while Encrypting Data Chunk ...:", err)
-				logger.LOGGER.Println("Source: handleClone()")
-				return
-			}
+	if _, err = session.Write(chunk_cipher.Header()); err != nil {
+		logger.LOGGER.Println("Error while Sending Encryption Header:", err)
+		logger.LOGGER.Println("Source: handleClone()")
+		return
+	}
 
-			_, err := kcp_session.Write([]byte(buffer[:n]))
-			if err != nil {
-				logger.LOGGER.Println("Error while Sending Data:", err)
-				logger.LOGGER.Println("Source: GetDataHandler()")
-				sendErrorMessage(kcp_session, "Internal Server Error")
-				return
-			}
-		}
+	err = encrypt.SealStream(session, bufio.NewReader(zip_file_obj), chunk_cipher, int64(len_data_bytes), start_index, end_index)
+	if err != nil {
+		logger.LOGGER.Println("Error while Sending Workspace Chunk:", err)
+		logger.LOGGER.Println("Source: handleClone()")
+		session.sendError(ErrInternalSeverError)
+		return
 	}
+	session.waitForDataReceived()
 }
 
-func GetDataHandler(kcp_session *kcp.UDPSession) {
+// 'peer' is Listener the Data is Sent to, Sessions of the same Peer Share its Bandwidth Limit
+func GetDataHandler(kcp_session *kcp.UDPSession, peer string) {
 	logger.LOGGER.Println("Get Data Handler Called ...")
-	logger.LOGGER.Println("Reading Workspace Name ...")
+	peer_bucket := BANDWIDTH_LIMITER.acquirePeer(peer)
+	defer BANDWIDTH_LIMITER.releasePeer(peer)
+	session := &dataSession{kcp_session: kcp_session, peer_bucket: peer_bucket}
 
-	var buff [512]byte
-	n, err := kcp_session.Read(buff[:])
-	if err != nil {
-		logger.LOGGER.Println("Error while Reading Workspace Name:", err)
+	var req models.DataRequest
+	if err := framing.ReadJSONFrame(kcp_session, framing.FRAME_HEADER, &req); err != nil {
+		logger.LOGGER.Println("Error while Reading Data Request:", err)
 		logger.LOGGER.Println("Source: GetDataHandler()")
 		return
 	}
-	workspace_name := string(buff[:n])
-	logger.LOGGER.Println("Workspace Name:", workspace_name)
-	logger.LOGGER.Println("Reading Workspace Push Num ...")
+	session.watchListener()
 
-	n, err = kcp_session.Read(buff[:])
-	if err != nil {
-		logger.LOGGER.Println("Error while Reading Workspace Push Num:", err)
+	// Request is Read first, so Listener gets the Error where it Expects Data
+	if !acquireDataStream(peer) {
+		logger.LOGGER.Println("Listener has too many Data Sessions Open:", peer)
 		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(models.ErrTooManyDataStreams)
 		return
 	}
-	workspace_push_num := string(buff[:n])
+	defer releaseDataStream(peer)
+
+	workspace_name, workspace_push_num, data_req_type, workspace_owner := req.WorkspaceName, req.PushRange, req.Type, req.WorkspaceOwner
+	logger.LOGGER.Println("Workspace Name:", workspace_name)
 	logger.LOGGER.Println("Workspace Push Num:", workspace_push_num)
-	logger.LOGGER.Println("Reading Type of Data Request(Pull/Clone) ...")
+	logger.LOGGER.Println("Data Request Type(Clone/Pull/Swarm/Chunks):", data_req_type)
+	if data_req_type == "Swarm" {
+		logger.LOGGER.Println("Workspace Owner:", workspace_owner)
+	}
 
-	// Read Data Request Type (Pull/Clone)
-	n, err = kcp_session.Read(buff[:])
+	start_index, end_index, err := parseDataRange(req.DataRange)
 	if err != nil {
-		logger.LOGGER.Println("Error while Reading Type of Data Request Type:", err)
+		logger.LOGGER.Println("Invalid Resume Offset Sent from User:", req.DataRange)
 		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(models.ErrInvalidResumeOffset)
 		return
 	}
-	data_req_type := string(buff[:n])
-	logger.LOGGER.Println("Data Request Type(Clone/Pull):", data_req_type)
+	logger.LOGGER.Println("Resume Offset:", req.DataRange)
 
-	workspace_path, err := config.GetSendWorkspaceFilePath(workspace_name)
+	var workspace_path string
+	if data_req_type == "Swarm" {
+		var get_workspace config.GetWorkspaceFolder
+		get_workspace, err = config.GetGetWorkspace(workspace_name, workspace_owner)
+		workspace_path = get_workspace.WorkspacePath
+	} else {
+		workspace_path, err = config.GetSendWorkspaceFilePath(workspace_name)
+	}
 	if err != nil {
 		logger.LOGGER.Println("Failed to Get Workspace Path from Config:", err)
 		logger.LOGGER.Println("Source: GetDataHandler()")
-		sendErrorMessage(kcp_session, "Internal Server Error")
+		session.sendError(ErrInternalSeverError)
 		return
 	}
 	logger.LOGGER.Println("Workspace Path:", workspace_path)
 
+	// Peers Serve Workspaces of others, whose Owners Revoke their Listeners themselves
+	if data_req_type != "Swarm" {
+		if err = config.CheckListenerAccess(workspace_name, peer); err != nil {
+			logger.LOGGER.Println("Listener can't Fetch from Workspace:", err)
+			logger.LOGGER.Println("Source: GetDataHandler()")
+			if errors.Is(err, models.ErrListenerRevoked) {
+				session.sendError(models.ErrListenerRevoked)
+			} else {
+				session.sendError(ErrInternalSeverError)
+			}
+			return
+		}
+	}
+
+	if filepath.Base(workspace_push_num) != workspace_push_num || workspace_push_num == ".." {
+		logger.LOGGER.Println("Invalid Workspace Push Num Range Sent from User")
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(models.ErrIncorrectPushRange)
+		return
+	}
+
 	if data_req_type == "Clone" {
-		zip_path := filepath.Join(workspace_path, ".PKr", "Files", "Current", workspace_push_num+".zip")
+		zip_path := getCloneArchivePath(workspace_path, workspace_push_num)
 		fileInfo, err := os.Stat(zip_path)
 		if err == nil {
 			logger.LOGGER.Println("Destination File Exists")
 		} else if os.IsNotExist(err) {
 			logger.LOGGER.Println("Destination File does not Exists")
-			sendErrorMessage(kcp_session, "Incorrect Workspace Name/Push Num")
+			session.sendError(models.ErrIncorrectPushRange)
 			return
 		} else {
 			logger.LOGGER.Println("Error while checking Existence of Destination file:", err)
 			logger.LOGGER.Println("Source: GetDataHandler()")
-			sendErrorMessage(kcp_session, "Internal Server Error")
+			session.sendError(ErrInternalSeverError)
 			return
 		}
 
-		handleClone(kcp_session, zip_path, int(fileInfo.Size()), workspace_path)
+		num_chunks := encrypt.NumChunks(fileInfo.Size())
+		end_index = min(end_index, num_chunks)
+		if start_index > end_index {
+			logger.LOGGER.Println("Resume Offset is Beyond the Length of File")
+			session.sendError(models.ErrInvalidResumeOffset)
+			return
+		}
+
+		handleClone(session, zip_path, int(fileInfo.Size()), start_index, end_index)
 		return
-	} else if data_req_type != "Pull" {
+	} else if data_req_type != "Pull" && data_req_type != "Swarm" && data_req_type != "Chunks" {
 		logger.LOGGER.Println("Invalid Data Request Type Sent from User")
 		logger.LOGGER.Println("Source: GetDataHandler()")
-		sendErrorMessage(kcp_session, "Invalid Data Request Type Sent")
+		session.sendError(models.ErrInvalidDataRequestType)
 		return
 	}
 
 	zip_enc_path := filepath.Join(workspace_path, ".PKr", "Files", "Changes", workspace_push_num, workspace_push_num+".enc")
+	if data_req_type == "Swarm" {
+		zip_enc_path = filepath.Join(getSwarmPath(workspace_path), workspace_push_num, workspace_push_num+".enc")
+	} else if data_req_type == "Chunks" {
+		zip_enc_path = filepath.Join(getChunkPacksPath(workspace_path), workspace_push_num, workspace_push_num+".enc")
+	}
 	logger.LOGGER.Println("Zip Enc FilePath to share:", zip_enc_path)
 
 	fileInfo, err := os.Stat(zip_enc_path)
@@ -176,12 +334,27 @@ func GetDataHandler(kcp_session *kcp.UDPSession) {
 		logger.LOGGER.Println("Destination File Exists")
 	} else if os.IsNotExist(err) {
 		logger.LOGGER.Println("Destination File does not Exists")
-		sendErrorMessage(kcp_session, "Incorrect Workspace Name/Push Num Range")
+		session.sendError(models.ErrIncorrectPushRange)
 		return
 	} else {
 		logger.LOGGER.Println("Error while checking Existence of Destination file:", err)
 		logger.LOGGER.Println("Source: GetDataHandler()")
-		sendErrorMessage(kcp_session, "Internal Server Error")
+		session.sendError(ErrInternalSeverError)
+		return
+	}
+
+	num_chunks, _, err := encrypt.SealedLayout(fileInfo.Size())
+	if err != nil {
+		logger.LOGGER.Println("Encrypted File has Invalid Layout:", err)
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(ErrInternalSeverError)
+		return
+	}
+
+	end_index = min(end_index, num_chunks)
+	if start_index > end_index {
+		logger.LOGGER.Println("Resume Offset is Beyond the Length of File")
+		session.sendError(models.ErrInvalidResumeOffset)
 		return
 	}
 
@@ -189,52 +362,60 @@ func GetDataHandler(kcp_session *kcp.UDPSession) {
 	if err != nil {
 		logger.LOGGER.Println("Error while Opening Destination File:", err)
 		logger.LOGGER.Println("Source: GetDataHandler()")
-		sendErrorMessage(kcp_session, "Internal Server Error")
+		session.sendError(ErrInternalSeverError)
 		return
 	}
 	defer zip_file_obj.Close()
 
-	buffer := make([]byte, DATA_CHUNK)
-	reader := bufio.NewReader(zip_file_obj)
+	header := make([]byte, encrypt.AEAD_HEADER_SIZE)
+	_, err = io.ReadFull(zip_file_obj, header)
+	if err != nil || header[0] != encrypt.ENCRYPTION_VERSION_AEAD {
+		logger.LOGGER.Println("Encrypted File has Invalid Header:", err)
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		// Update Cache from before AEAD, Removing it lets next GetMetaData Regenerate it
+		if data_req_type == "Pull" {
+			zip_file_obj.Close()
+			if err = os.RemoveAll(filepath.Dir(zip_enc_path)); err != nil {
+				logger.LOGGER.Println("Error while Removing Outdated Update Cache:", err)
+				logger.LOGGER.Println("Source: GetDataHandler()")
+			}
+		}
+		session.sendError(ErrInternalSeverError)
+		return
+	}
+
+	// Every Sealed Chunk can be Decrypted on its own, so Skip the ones Listener already has
+	_, err = zip_file_obj.Seek(encrypt.SealedChunkOffset(start_index), io.SeekStart)
+	if err != nil {
+		logger.LOGGER.Println("Error while Seeking to Resume Offset:", err)
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(ErrInternalSeverError)
+		return
+	}
 
 	len_data_bytes := int(fileInfo.Size())
 	logger.LOGGER.Println("Length of File:", len_data_bytes)
 
-	logger.LOGGER.Println("Preparing to Transfer Data for Pull")
-	for {
-		n, err := reader.Read(buffer)
-		if err != nil {
-			if err == io.EOF {
-				logger.LOGGER.Println("Done Sent, now waiting for ack from listener ...")
-				n, err := kcp_session.Read(buff[:])
-				if err != nil {
-					logger.LOGGER.Println("Error while Reading 'Data Received' Message from Listener:", err)
-					logger.LOGGER.Println("Source: GetDataHandler()")
-					return
-				}
-				// Data Received
-				msg := string(buff[:n])
-				if msg == "Data Received" {
-					logger.LOGGER.Println("Data Transfer Completed")
-					return
-				}
-				logger.LOGGER.Println("Received Unexpected Message:", msg)
-				return
-			}
-			logger.LOGGER.Println("Error while Sending Workspace Chunk:", err)
-			logger.LOGGER.Println("Source: GetDataHandler()")
-			sendErrorMessage(kcp_session, "Internal Server Error")
-			return
-		}
+	logger.LOGGER.Println("Preparing to Transfer Data for", data_req_type)
+	if _, err = session.Write(header); err != nil {
+		logger.LOGGER.Println("Error while Sending Encryption Header:", err)
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		return
+	}
 
-		if n > 0 {
-			_, err := kcp_session.Write([]byte(buffer[:n]))
-			if err != nil {
-				logger.LOGGER.Println("Error while Sending Data:", err)
-				logger.LOGGER.Println("Source: GetDataHandler()")
-				sendErrorMessage(kcp_session, "Internal Server Error")
-				return
-			}
-		}
+	// Last Sealed Chunk may be Shorter, so the Range ending at it runs till EOF
+	range_len := fileInfo.Size() - encrypt.SealedChunkOffset(start_index)
+	if end_index < num_chunks {
+		range_len = encrypt.SealedChunkOffset(end_index) - encrypt.SealedChunkOffset(start_index)
+	}
+
+	buffer := make([]byte, DATA_CHUNK)
+	_, err = io.CopyBuffer(session, io.LimitReader(bufio.NewReader(zip_file_obj), range_len), buffer)
+	if err != nil {
+		logger.LOGGER.Println("Error while Sending Workspace Chunk:", err)
+		logger.LOGGER.Println("Source: GetDataHandler()")
+		session.sendError(ErrInternalSeverError)
+		return
 	}
+	session.waitForDataReceived()
 }
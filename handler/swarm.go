@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/filetracker"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/PKr-Base/utils"
+)
+
+// Data prepared for a Listener (Swarm & Chunk Packs) is kept only till they've Fetched it
+const TRANSFER_CACHE_TTL = 24 * time.Hour
+
+func getSwarmPath(workspace_path string) string {
+	return filepath.Join(workspace_path, ".PKr", "Swarm")
+}
+
+func removeStaleCaches(caches_path string) {
+	entries, err := os.ReadDir(caches_path)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < TRANSFER_CACHE_TTL {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(caches_path, entry.Name())); err != nil {
+			logger.LOGGER.Println("Error while Removing Stale Cache:", err)
+			logger.LOGGER.Println("Source: removeStaleCaches()")
+		}
+	}
+}
+
+// Returns AES Key & IV Encrypted with Listener's Public Key
+func encryptKeysForListener(listener_username string, key, iv []byte) ([]byte, []byte, error) {
+	logger.LOGGER.Println("Fetching Public Key of Listener from Config")
+	public_key, err := config.GetPublicKeyUsingUsername(listener_username)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Get Public Key of Listener Using Username:", err)
+		logger.LOGGER.Println("Source: encryptKeysForListener()")
+		return nil, nil, err
+	}
+
+	encrypt_key, err := encrypt.RSAEncryptData(string(key), string(public_key))
+	if err != nil {
+		logger.LOGGER.Println("Failed to Encrypt AES Keys using Listener's Public Key:", err)
+		logger.LOGGER.Println("Source: encryptKeysForListener()")
+		return nil, nil, err
+	}
+
+	encrypt_iv, err := encrypt.RSAEncryptData(string(iv), string(public_key))
+	if err != nil {
+		logger.LOGGER.Println("Failed to Encrypt IV Keys using Listener's Public Key:", err)
+		logger.LOGGER.Println("Source: encryptKeysForListener()")
+		return nil, nil, err
+	}
+
+	return []byte(encrypt_key), []byte(encrypt_iv), nil
+}
+
+// Other Listeners of Workspace along with their Public Keys, so they can Fetch from each other
+func getPeersOfListener(workspace_name, listener_username string) []models.PeerInfo {
+	listeners, err := config.GetListenersOfSendWorkspace(workspace_name)
+	if err != nil {
+		logger.LOGGER.Println("Error while Getting Listeners of Workspace:", err)
+		logger.LOGGER.Println("Source: getPeersOfListener()")
+		return nil
+	}
+
+	peers := []models.PeerInfo{}
+	for _, listener := range listeners {
+		if listener.Username == listener_username || listener.Revoked {
+			continue
+		}
+
+		public_key, err := config.GetPublicKeyUsingUsername(listener.Username)
+		if err != nil {
+			logger.LOGGER.Println("Error while Getting Public Key of Listener:", err)
+			logger.LOGGER.Println("Source: getPeersOfListener()")
+			continue
+		}
+		peers = append(peers, models.PeerInfo{Username: listener.Username, PublicKey: public_key})
+	}
+	return peers
+}
+
+// Serves Push I've Pulled to another Listener of the Workspace
+// Only Files which differ from Listener's are sent, along with Manifest Signed by Workspace Owner
+func getMetaDataForPeer(req models.GetMetaDataRequest, res *models.GetMetaDataResponse, password string, capabilities models.Capability) error {
+	get_workspace, err := config.AuthenticateGetWorkspaceInfo(req.WorkspaceName, req.WorkspaceOwner, password)
+	if err != nil {
+		if errors.Is(err, ErrIncorrectPassword) {
+			logger.LOGGER.Println("Error: Incorrect Credentials for Workspace")
+			logger.LOGGER.Println("Source: getMetaDataForPeer()")
+			return ErrIncorrectPassword
+		}
+		logger.LOGGER.Println("Error: No Such Workspace Found:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrNoSuchWorkspaceFound
+	}
+
+	if !slices.Contains(get_workspace.Peers, req.Username) {
+		logger.LOGGER.Println("Error: User isn't a Listener of Workspace:", req.Username)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrNotAPeerOfWorkspace
+	}
+
+	if req.LastPushNum >= get_workspace.LastPushNum {
+		logger.LOGGER.Println("Peer doesn't need any Push I've")
+		return ErrPeerHasNoNewerPush
+	}
+
+	signed_manifest, err := config.ReadManifestFile(get_workspace.WorkspacePath)
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading Manifest File:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrPeerCannotServeWorkspace
+	}
+
+	manifest, err := config.VerifySignedPushManifest(signed_manifest, req.WorkspaceName, req.WorkspaceOwner)
+	if err != nil || manifest.PushNum != get_workspace.LastPushNum {
+		logger.LOGGER.Println("Manifest File is Invalid or Outdated:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrPeerCannotServeWorkspace
+	}
+
+	// Workspace Owner Signs who may Fetch the Push, Revoked Listeners aren't in it
+	// Manifests of Older Owners don't say, they can't Revoke anyone either
+	if manifest.Listeners != nil && !slices.Contains(manifest.Listeners, req.Username) {
+		logger.LOGGER.Println("Error: User isn't a Listener of Workspace, according to Manifest:", req.Username)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrNotAPeerOfWorkspace
+	}
+
+	// Only Files still Matching Manifest can be Served, i.e., not Modified Locally
+	res.Updates = map[string]string{}
+	file_paths := []string{}
+	for _, file := range manifest.Files {
+		if req.FileHashes[file.FilePath] == file.Hash {
+			continue
+		}
+
+		hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(filepath.Join(get_workspace.WorkspacePath, file.FilePath))
+		if err != nil || hash != file.Hash {
+			logger.LOGGER.Println("File was Modified after Pull, Can't Serve it:", file.FilePath)
+			logger.LOGGER.Println("Source: getMetaDataForPeer()")
+			return ErrPeerCannotServeWorkspace
+		}
+		file_paths = append(file_paths, file.FilePath)
+		res.Updates[file.FilePath] = "Updated"
+	}
+	logger.LOGGER.Println("Files to be Sent to Peer:", len(file_paths))
+
+	swarm_path := getSwarmPath(get_workspace.WorkspacePath)
+	removeStaleCaches(swarm_path)
+
+	// Unique per Request, as Files to be Sent depend on the Peer
+	res.RequestPushRange = strconv.Itoa(req.LastPushNum) + "-" + strconv.Itoa(manifest.PushNum) + "-" + utils.RandomString(6)
+	cache_path := filepath.Join(swarm_path, res.RequestPushRange)
+	if err = os.MkdirAll(cache_path, 0700); err != nil {
+		logger.LOGGER.Println("Error while Creating Swarm Cache Dir:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	zip_path := filepath.Join(cache_path, res.RequestPushRange+".zip")
+	if err = filetracker.ZipFilesFromWorkspace(get_workspace.WorkspacePath, file_paths, zip_path); err != nil {
+		logger.LOGGER.Println("Error while Zipping Files for Peer:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	res.ZipHash, err = encrypt.GenerateHashFromFileNames_BufferedAndPooled(zip_path)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate Hash of Zip File:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	key, err := encrypt.AESGenerakeKey(16)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate AES Keys:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	iv, err := encrypt.AESGenerateIV()
+	if err != nil {
+		logger.LOGGER.Println("Failed to Generate IV Keys:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	enc_path := filepath.Join(cache_path, res.RequestPushRange+".enc")
+	if err = encrypt.EncryptZipFileAndStore(zip_path, enc_path, key, iv); err != nil {
+		logger.LOGGER.Println("Error while Encrypting Zip File for Peer:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	file_info, err := os.Stat(enc_path)
+	if err != nil {
+		logger.LOGGER.Println("Failed to Get FileInfo of Encrypted Zip File:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	res.KeyBytes, res.IVBytes, err = encryptKeysForListener(req.Username, key, iv)
+	if err != nil {
+		logger.LOGGER.Println("Error while Encrypting Keys for Peer:", err)
+		logger.LOGGER.Println("Source: getMetaDataForPeer()")
+		return ErrInternalSeverError
+	}
+
+	res.LenData = int(file_info.Size())
+	setDataCapabilities(res, capabilities)
+	res.LastPushNum = manifest.PushNum
+	res.LastPushDesc = manifest.PushDesc
+	res.Manifest = signed_manifest
+
+	logger.LOGGER.Println("Len Data:", res.LenData)
+	logger.LOGGER.Println("Request Push Range:", res.RequestPushRange)
+	logger.LOGGER.Println("Get Meta Data for Peer Successful ...")
+	return nil
+}
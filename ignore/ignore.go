@@ -0,0 +1,185 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PKr-Parivar/PKr-Base/logger"
+)
+
+const IGNORE_FILE_NAME = ".pkrignore"
+
+// Never Shared, can't be Negated
+const PKR_DIR_NAME = ".PKr"
+
+// Same Exclusions which were Hardcoded before .pkrignore, these can be Negated
+var DEFAULT_PATTERNS = []string{
+	"tmp/",
+	"PKr-Base",
+	"PKr-Base.exe",
+	"PKr-Cli",
+	"PKr-Cli.exe",
+}
+
+type pattern struct {
+	regex    *regexp.Regexp
+	negate   bool
+	dir_only bool
+}
+
+// Gitignore Style Matcher, Last Matching Pattern Wins
+// Supports Comments(#), Negation(!), Directory Only(trailing /), Anchoring(/ at start or middle) & **
+type Matcher struct {
+	patterns []pattern
+}
+
+func NewMatcher(lines []string) *Matcher {
+	matcher := &Matcher{}
+	matcher.AddPatterns(DEFAULT_PATTERNS)
+	matcher.AddPatterns(lines)
+	return matcher
+}
+
+// Reads Patterns from 'file_path', Missing File is not an Error
+func ReadPatternsFromFile(file_path string) ([]string, error) {
+	file, err := os.Open(file_path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func (m *Matcher) AddPatterns(lines []string) {
+	for _, line := range lines {
+		if p, ok := parsePattern(line); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+}
+
+// 'rel_path' is Relative to Workspace Root, either Separator is Accepted
+// A Path is Ignored if it or any of its Parent Dirs is Ignored
+func (m *Matcher) Match(rel_path string, is_dir bool) bool {
+	rel_path = strings.Trim(filepath.ToSlash(rel_path), "/")
+	if rel_path == "" || rel_path == "." {
+		return false
+	}
+
+	parts := strings.Split(rel_path, "/")
+	for i := range parts {
+		if parts[i] == PKR_DIR_NAME {
+			return true
+		}
+
+		is_last := i == len(parts)-1
+		if m.matchOne(strings.Join(parts[:i+1], "/"), !is_last || is_dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchOne(rel_path string, is_dir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dir_only && !is_dir {
+			continue
+		}
+		if p.regex.MatchString(rel_path) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func parsePattern(line string) (pattern, bool) {
+	original_line := line
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dir_only = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// Slash at Start or Middle Anchors Pattern to Root, else it Matches at any Depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '*' && strings.HasPrefix(line[i:], "**/"):
+			// Zero or More Dirs
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(line[i:], "**"):
+			expr.WriteString(".*")
+			i += 1
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i += 1
+			expr.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	// Pattern is Skipped, so the Paths it was meant to Ignore will be Shared
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		logger.LOGGER.Printf("Error while Compiling Ignore Pattern %q: %v\n", original_line, err)
+		logger.LOGGER.Println("Source: parsePattern()")
+		return pattern{}, false
+	}
+	p.regex = regex
+	return p, true
+}
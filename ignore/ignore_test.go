@@ -0,0 +1,72 @@
+package ignore
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/PKr-Parivar/PKr-Base/logger"
+)
+
+func init() {
+	logger.LOGGER = log.New(io.Discard, "", 0)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		is_dir   bool
+		ignored  bool
+	}{
+		{"plain name matches at any depth", []string{"*.log"}, "a/b/debug.log", false, true},
+		{"plain name doesn't match other ext", []string{"*.log"}, "a/b/debug.txt", false, false},
+		{"star doesn't cross dirs", []string{"a/*.log"}, "a/b/debug.log", false, false},
+		{"question mark is one char", []string{"file?.txt"}, "file1.txt", false, true},
+		{"question mark isn't zero chars", []string{"file?.txt"}, "file.txt", false, false},
+		{"char class", []string{"file[0-9].txt"}, "file7.txt", false, true},
+		{"negated char class", []string{"file[!0-9].txt"}, "file7.txt", false, false},
+
+		{"leading slash anchors", []string{"/build"}, "build", true, true},
+		{"leading slash doesn't match deeper", []string{"/build"}, "src/build", true, false},
+		{"middle slash anchors", []string{"docs/build"}, "docs/build", true, true},
+		{"middle slash doesn't match deeper", []string{"docs/build"}, "x/docs/build", true, false},
+		{"unanchored matches deeper", []string{"build"}, "src/build", true, true},
+
+		{"dir only matches dir", []string{"out/"}, "out", true, true},
+		{"dir only skips file", []string{"out/"}, "out", false, false},
+		{"dir only ignores contents", []string{"out/"}, "out/a/b.txt", false, true},
+
+		{"leading ** matches at root", []string{"**/cache"}, "cache", true, true},
+		{"leading ** matches deeper", []string{"**/cache"}, "a/b/cache", true, true},
+		{"middle ** matches zero dirs", []string{"a/**/b"}, "a/b", false, true},
+		{"middle ** matches many dirs", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"trailing ** matches contents", []string{"a/**"}, "a/x/y", false, true},
+		{"trailing ** is anchored", []string{"a/**"}, "z/a/x", false, false},
+
+		{"negation re-includes", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"last matching pattern wins", []string{"!keep.log", "*.log"}, "keep.log", false, true},
+		{"negation can't re-include inside ignored dir", []string{"logs/", "!logs/keep.log"}, "logs/keep.log", false, true},
+		{"negation of default pattern", []string{"!tmp/"}, "tmp/a.txt", false, false},
+
+		{"escaped bang is literal", []string{`\!important`}, "!important", false, true},
+		{"escaped hash is literal", []string{`\#notes`}, "#notes", false, true},
+		{"comment is skipped", []string{"# *.txt"}, "a.txt", false, false},
+		{"trailing spaces are trimmed", []string{"*.txt   "}, "a.txt", false, true},
+		{"invalid pattern is skipped", []string{"[z-a]"}, "z", false, false},
+
+		{"default pattern", nil, "tmp/a.txt", false, true},
+		{".PKr is always ignored", []string{"!.PKr/"}, ".PKr/config.json", false, true},
+		{"root isn't ignored", []string{"*"}, ".", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher := NewMatcher(test.patterns)
+			if got := matcher.Match(test.path, test.is_dir); got != test.ignored {
+				t.Errorf("Match(%q, %v) with %q = %v, want %v", test.path, test.is_dir, test.patterns, got, test.ignored)
+			}
+		})
+	}
+}
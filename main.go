@@ -5,16 +5,14 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"strings"
-	"time"
 
 	"github.com/PKr-Parivar/PKr-Base/config"
 	"github.com/PKr-Parivar/PKr-Base/dialer"
+	"github.com/PKr-Parivar/PKr-Base/filetracker"
+	"github.com/PKr-Parivar/PKr-Base/handler"
 	"github.com/PKr-Parivar/PKr-Base/logger"
 	"github.com/PKr-Parivar/PKr-Base/utils"
 	"github.com/PKr-Parivar/PKr-Base/ws"
@@ -26,9 +24,50 @@ var WEBSOCKET_SERVER_ADDR_WITH_QUERY url.URL
 var USER_CONF config.UserConfig
 
 var (
-	cpath = flag.String("cpath", "", "set custom config directory (default: uses your APPDATA or ~/.local/share)")
+	cpath            = flag.String("cpath", "", "set custom config directory (default: uses your APPDATA or ~/.local/share)")
+	revoke_listener  = flag.String("revoke-listener", "", "revoke access of this listener to the workspace given by -workspace, then exit")
+	list_listeners   = flag.Bool("list-listeners", false, "list listeners of the workspace given by -workspace, then exit")
+	shared_workspace = flag.String("workspace", "", "name of the workspace you've shared, used with -revoke-listener & -list-listeners")
 )
 
+func listListeners(workspace_name string) error {
+	if workspace_name == "" {
+		return errors.New("workspace name is required, use -workspace")
+	}
+	listeners, err := config.GetListenersOfSendWorkspace(workspace_name)
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		fmt.Println("No Listeners are Recorded for Workspace:", workspace_name)
+		return nil
+	}
+
+	fmt.Println("Listeners of Workspace:", workspace_name)
+	for _, listener := range listeners {
+		state := "Active"
+		if listener.Revoked {
+			state = "Revoked"
+		} else if listener.TokenHash == "" {
+			state = "Active (Password, no Access Token)"
+		}
+		fmt.Printf("  %s: %s\n", listener.Username, state)
+	}
+	return nil
+}
+
+// Revoked Listener's Token is Removed, it can't Fetch from me or Connect to the Workspace again
+func revokeListener(workspace_name, listener_username string) error {
+	if workspace_name == "" {
+		return errors.New("workspace name is required, use -workspace")
+	}
+	if err := config.RevokeListenerOfSendWorkspace(workspace_name, listener_username); err != nil {
+		return err
+	}
+	logger.LOGGER.Printf("Listener: %s Revoked from Workspace: %s\n", listener_username, workspace_name)
+	return nil
+}
+
 func init() {
 	flag.Parse()
 	if *cpath != "" {
@@ -53,6 +92,17 @@ func init() {
 	escaped_password := url.QueryEscape(USER_CONF.Password)
 	ws.MY_USERNAME = USER_CONF.Username
 	ws.MY_SERVER_IP = USER_CONF.ServerIP
+	if USER_CONF.TransferStreams > 0 {
+		ws.TRANSFER_STREAMS = USER_CONF.TransferStreams
+	}
+
+	dialer.KCP_PROFILE, err = dialer.ResolveKCPProfile(USER_CONF.KCP)
+	if err != nil {
+		logger.LOGGER.Println("Invalid KCP Config in user-config:", err)
+		logger.LOGGER.Println("Source: init()")
+		os.Exit(1)
+	}
+	logger.LOGGER.Println("KCP Profile:", dialer.KCP_PROFILE.Name)
 
 	raw_query := "username=" + escaped_username + "&password=" + escaped_password
 	websock_server_ip := fmt.Sprintf("%s:%d", USER_CONF.ServerIP, USER_CONF.ServerWSPort)
@@ -66,6 +116,22 @@ func init() {
 }
 
 func main() {
+	if *list_listeners {
+		if err := listListeners(*shared_workspace); err != nil {
+			fmt.Println("Error while Listing Listeners:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *revoke_listener != "" {
+		if err := revokeListener(*shared_workspace, *revoke_listener); err != nil {
+			fmt.Println("Error while Revoking Listener:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Listener: %s can no longer Access Workspace: %s\n", *revoke_listener, *shared_workspace)
+		return
+	}
+
 	logger.LOGGER.Println("==========================================================")
 	logger.LOGGER.Println("\t\t\t\tPKR-Base Has Started")
 	logger.LOGGER.Println("==========================================================")
@@ -73,58 +139,14 @@ func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	var server_err error
-
-	websocker_dialer := websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 30 * time.Second,
-		NetDialContext: (&net.Dialer{
-			Timeout:   10 * time.Second, // TCP connection timeout
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-	}
-
-	logger.LOGGER.Println("Attempting to Connect to the Web Socket Server... | IP: ", WEBSOCKET_SERVER_ADDR_WITH_QUERY.String())
-	ws_conn, _, server_err := websocker_dialer.Dial(WEBSOCKET_SERVER_ADDR_WITH_QUERY.String(), nil)
-	for server_err != nil {
-		logger.LOGGER.Println("WebSocket connection failed:", server_err)
-
-		var netErr net.Error
-		if errors.As(server_err, &netErr) && netErr.Timeout() {
-			logger.LOGGER.Println("Connection timed out. Will retry in 15 minutes.")
-		} else if opErr, ok := server_err.(*net.OpError); ok {
-			if sysErr, ok := opErr.Err.(*os.SyscallError); ok && strings.Contains(sysErr.Error(), "actively refused") {
-				logger.LOGGER.Println("Server refused the connection.")
-			} else {
-				logger.LOGGER.Println("Unexpected Error - is an opError but not 'actively refused'")
-				logger.LOGGER.Println("Error while Dialing Websocket Connection to Server: ", opErr)
-				logger.LOGGER.Println("Source: main()")
-			}
-		} else {
-			logger.LOGGER.Println("Unexpected Error - Not opError or timeout")
-			logger.LOGGER.Println("Error while Dialing Websocket Connection to Server: ", server_err)
+	// Pulls Interrupted while Applying Updates're Finished (or Rolled Back) before anything else
+	for _, get_workspace := range USER_CONF.GetWorkspaces {
+		if err := filetracker.RecoverInterruptedApply(get_workspace.WorkspacePath); err != nil {
+			logger.LOGGER.Println("Error while Recovering Interrupted Apply of Workspace:", get_workspace.WorkspaceName, err)
 			logger.LOGGER.Println("Source: main()")
 		}
-
-		select {
-		case <-time.After(15 * time.Minute):
-			logger.LOGGER.Println("Retrying WebSocket connection...")
-		case <-interrupt:
-			logger.LOGGER.Println("Interrupt received. Exiting.")
-			return
-		}
-
-		ws_conn, _, server_err = websocker_dialer.Dial(WEBSOCKET_SERVER_ADDR_WITH_QUERY.String(), nil)
 	}
 
-	defer ws_conn.Close()
-	logger.LOGGER.Println("Connected to Server")
-
-	done := make(chan struct{})
-
-	go ws.ReadJSONMessage(done, ws_conn)
-	go ws.PingPongWriter(done, ws_conn)
-
 	logger.LOGGER.Println("Preparing gRPC Client ...")
 
 	// New GRPC Client
@@ -133,60 +155,22 @@ func main() {
 	if err != nil {
 		logger.LOGGER.Println("Error:", err)
 		logger.LOGGER.Println("Description: Cannot Create New GRPC Client")
-		logger.LOGGER.Println("Source: Install()")
+		logger.LOGGER.Println("Source: main()")
 		return
 	}
 
-	logger.LOGGER.Println("Checking for New Changes")
-	// Checking for New Changes
-	for _, get_workspace := range USER_CONF.GetWorkspaces {
-		logger.LOGGER.Println("GET Workspace: ")
-		logger.LOGGER.Println(get_workspace)
-		are_there_new_changes, err := dialer.CheckForNewChanges(gRPC_cli_service_client, get_workspace.WorkspaceName, get_workspace.WorkspaceOwnerName, USER_CONF.Username, USER_CONF.Password, get_workspace.LastPushNum)
-		if err != nil {
-			logger.LOGGER.Println("Error while Checking For New Changes:", err)
-			logger.LOGGER.Println("Source: main()")
-			continue
-		}
-		logger.LOGGER.Println("Are there new changes:", are_there_new_changes)
-
-		if are_there_new_changes {
-			err = ws.PullWorkspace(get_workspace.WorkspaceOwnerName, get_workspace.WorkspaceName, ws_conn)
-			if err != nil {
-				if err.Error() == "workspace owner is offline" {
-					logger.LOGGER.Println("Workspace Owner is Offline, Server'll notify when he's online")
-					break
-				}
-				if err.Error() == "you already've latest version of workspace" {
-					logger.LOGGER.Println("You've Lastest Version of Workspace, No Need to Transfer Data")
-					return
-				}
-				logger.LOGGER.Println("Error while Pulling Data:", err)
-				logger.LOGGER.Println("Source: main()")
-
-				logger.LOGGER.Println("Will Try Again after 5 minutes")
-				// Try Again only once after 5 minutes
-				time.Sleep(5 * time.Minute)
-				err = ws.PullWorkspace(get_workspace.WorkspaceOwnerName, get_workspace.WorkspaceName, ws_conn)
-				if err != nil {
-					logger.LOGGER.Println("Error while Pulling Data Again:", err)
-					logger.LOGGER.Println("Source: main()")
-				}
-			}
-		}
-	}
-	logger.LOGGER.Println("Done with Checking for New Changes ...")
+	// Limits on Data Served to Listeners
+	handler.StartBandwidthScheduler(USER_CONF.Bandwidth)
 
-	select {
-	case <-done:
-	case <-interrupt:
-		logger.LOGGER.Println("Interrupt Received, Closing Connection ...")
+	// Checking for New Changes after every (Re)Connect
+	ws.CONN_MANAGER = ws.NewConnectionManager(WEBSOCKET_SERVER_ADDR_WITH_QUERY.String(), func(ws_conn *websocket.Conn) {
+		ws.CheckForNewChanges(gRPC_cli_service_client, ws_conn)
+	})
 
-		err := ws_conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Bye"))
-		if err != nil {
-			logger.LOGGER.Println("Error while Writing Close Message to Server via WS:", err)
-			logger.LOGGER.Println("Source: main()")
-			return
-		}
+	// Pulls which Failed before Restart're Retried as per their Backoff
+	if err = ws.PULL_SCHEDULER.LoadRetries(); err != nil {
+		logger.LOGGER.Println("Error while Loading Pull Retries:", err)
+		logger.LOGGER.Println("Source: main()")
 	}
+	ws.CONN_MANAGER.Run(interrupt)
 }
@@ -15,7 +15,9 @@ type InitWorkspaceConnectionRequest struct {
 	WorkspacePassword string
 }
 
-type InitWorkspaceConnectionResponse struct{}
+type InitWorkspaceConnectionResponse struct {
+	AccessToken string // Encrypted with Listener's Public Key, Sent instead of Workspace Password from then on, Empty if Owner is Older
+}
 
 type GetMetaDataRequest struct {
 	WorkspaceName     string
@@ -24,7 +26,18 @@ type GetMetaDataRequest struct {
 	Username string
 	ServerIP string
 
-	LastPushNum int // -1 => Cloning for First Time
+	AccessToken       string // Encrypted with Public Key of Workspace Owner, Older Listeners only send Password
+	LastPushNum       int    // -1 => Cloning for First Time
+	EncryptionVersion int    // Older Listeners send 0
+
+	WorkspaceOwner string            // Set only when Fetching from another Listener of the Workspace
+	FileHashes     map[string]string // {"fileA": "hash"}, Listener's Files, so a Peer sends only what's Changed
+
+	SupportsChunks bool     // Listener can Fetch Changed Files as Chunks via GetChunks
+	ArchiveFormats []string // Archive Formats Listener can Extract, Older Listeners only Support Zip
+
+	KCPSendWindow int // Windows of Listener's KCP Profile, Older Listeners send 0
+	KCPRecvWindow int
 }
 
 type GetMetaDataResponse struct {
@@ -32,8 +45,90 @@ type GetMetaDataResponse struct {
 	KeyBytes []byte
 	IVBytes  []byte
 
-	Updates          map[string]string // {"fileA": "Updated", "fileB": "Removed"}, Updated & Created're treated equally
-	RequestPushRange string            // "Request Push Range" is to be sent during GetData, i.e., "2-5", Push2 to Push5
-	LastPushNum      int               // Latest Push Num of the Entire Workspace
-	LastPushDesc     string            // Latest Push Desc of the Entire Workspace
+	Updates           map[string]string // {"fileA": "Updated", "fileB": "Removed"}, Updated & Created're treated equally
+	RequestPushRange  string            // "Request Push Range" is to be sent during GetData, i.e., "2-5", Push2 to Push5
+	LastPushNum       int               // Latest Push Num of the Entire Workspace
+	LastPushDesc      string            // Latest Push Desc of the Entire Workspace
+	ZipHash           string            // SHA-256 of the Plaintext Zip, Listener verifies it before Unzipping
+	EncryptionVersion int               // Format of Data sent during GetData, Older Owners send 0
+
+	Manifest SignedPushManifest // Signed by Workspace Owner, Pushes without it are Rejected
+	Peers    []PeerInfo         // Other Listeners of the Workspace, only sent by Workspace Owner
+
+	// Set if Updated Files're to be Fetched as Chunks, then there's no Zip (LenData is 0)
+	UsesChunks bool
+	FileChunks map[string][]FileChunk // {"fileA": [Chunk0, Chunk1]}, Chunks of every Updated File
+
+	ArchiveFormat string // Format of Archive Sent during GetData, Zip if Empty
+	MaxStreams    int    // Max Num of Parallel Sessions for GetData, 0 if Sender Serves only One
+
+	KCPSendWindow int // Windows Agreed by Sender, from its side, Sessions after GetMetaData Use them, 0 if Sender is Older
+	KCPRecvWindow int
+}
+
+type FileChunk struct {
+	Hash string `json:"hash"` // SHA-256 of Chunk
+	Size int64  `json:"size"`
+}
+
+type GetChunksRequest struct {
+	WorkspaceName     string
+	WorkspacePassword string
+	AccessToken       string // Same as in GetMetaDataRequest
+	Username          string
+
+	RequestPushRange string   // Same as in GetMetaDataResponse
+	ChunkHashes      []string // Chunks Listener doesn't have, Sent in this Order
+}
+
+type GetChunksResponse struct {
+	PackID            string // Sent as Push Num during GetData with Type "Chunks"
+	LenData           int
+	KeyBytes          []byte
+	IVBytes           []byte
+	PackHash          string // SHA-256 of Plaintext Pack
+	EncryptionVersion int
+}
+
+// Header Frame of KCP-Plain Sessions, see framing package
+type DataRequest struct {
+	WorkspaceName  string `json:"workspace_name"`
+	PushRange      string `json:"push_range"`      // Push Num/Range, Archive Name or Pack ID, as per Type
+	Type           string `json:"type"`            // "Pull", "Clone", "Swarm" or "Chunks"
+	WorkspaceOwner string `json:"workspace_owner"` // Only for "Swarm"
+	DataRange      string `json:"data_range"`      // "<Start Offset>" or "<Start Offset>-<End Offset>" in Plaintext Bytes
+}
+
+// Progress Frame of KCP-Plain Sessions, Sent by Listener as it Receives Data
+type DataProgress struct {
+	NextChunk int64 `json:"next_chunk"` // Chunks before it're Received
+	EndChunk  int64 `json:"end_chunk"`
+}
+
+type PeerInfo struct {
+	Username  string
+	PublicKey []byte
+}
+
+// Files of the Workspace at a Push, Signed by Workspace Owner
+// So Data received from Workspace Owner or other Listeners can be Verified
+type PushManifest struct {
+	WorkspaceName  string         `json:"workspace_name"`
+	WorkspaceOwner string         `json:"workspace_owner"`
+	PushNum        int            `json:"push_num"`
+	PushDesc       string         `json:"push_desc"`
+	Files          []ManifestFile `json:"files"`
+	ArchiveHash    string         `json:"archive_hash,omitempty"` // SHA-256 of Zip of the Push, i.e., what a Clone Receives
+	// Listeners Peers may Serve this Push to, Revoked ones aren't in it, nil if Signed by an Older Owner
+	Listeners []string `json:"listeners"`
+}
+
+type ManifestFile struct {
+	FilePath string `json:"file_path"`
+	Hash     string `json:"hash"`
+}
+
+type SignedPushManifest struct {
+	Manifest  []byte `json:"manifest"` // JSON of PushManifest, Kept as it is so Signature can be Verified
+	Signature string `json:"signature"`
 }
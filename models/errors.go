@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors Sent to Peers or Received from Server carry a Code along with their Message
+// net/rpc & JSON only keep Messages, so Receivers Map Codes back to these Errors, which can then be
+// Compared via errors.Is(). Peers & Server which only Send Messages're Matched by Message instead
+
+type ErrorCode string
+
+const (
+	ERR_CODE_INTERNAL                  ErrorCode = "internal"
+	ERR_CODE_INCORRECT_PASSWORD        ErrorCode = "incorrect_password"
+	ERR_CODE_NO_SUCH_WORKSPACE         ErrorCode = "no_such_workspace"
+	ERR_CODE_ALREADY_LATEST            ErrorCode = "already_latest"
+	ERR_CODE_INVALID_LAST_PUSH_NUM     ErrorCode = "invalid_last_push_num"
+	ERR_CODE_UNSUPPORTED_ENCRYPTION    ErrorCode = "unsupported_encryption"
+	ERR_CODE_NOT_A_PEER                ErrorCode = "not_a_peer"
+	ERR_CODE_PEER_HAS_NO_NEWER_PUSH    ErrorCode = "peer_has_no_newer_push"
+	ERR_CODE_PEER_CANNOT_SERVE         ErrorCode = "peer_cannot_serve"
+	ERR_CODE_INVALID_CHUNK_REQUEST     ErrorCode = "invalid_chunk_request"
+	ERR_CODE_INCORRECT_PUSH_RANGE      ErrorCode = "incorrect_push_range"
+	ERR_CODE_INVALID_RESUME_OFFSET     ErrorCode = "invalid_resume_offset"
+	ERR_CODE_INVALID_DATA_REQUEST_TYPE ErrorCode = "invalid_data_request_type"
+	ERR_CODE_OWNER_OFFLINE             ErrorCode = "owner_offline"
+	ERR_CODE_OWNER_NOT_RESPONDING      ErrorCode = "owner_not_responding"
+	ERR_CODE_INCOMPATIBLE_PROTOCOL     ErrorCode = "incompatible_protocol"
+	ERR_CODE_MISSING_CAPABILITY        ErrorCode = "missing_capability"
+	ERR_CODE_PEER_AUTH_FAILED          ErrorCode = "peer_auth_failed"
+	ERR_CODE_UNKNOWN_PEER              ErrorCode = "unknown_peer"
+	ERR_CODE_LISTENER_REVOKED          ErrorCode = "listener_revoked"
+	ERR_CODE_INVALID_ACCESS_TOKEN      ErrorCode = "invalid_access_token"
+	ERR_CODE_MISSING_DATA_HASH         ErrorCode = "missing_data_hash"
+	ERR_CODE_TOO_MANY_DATA_STREAMS     ErrorCode = "too_many_data_streams"
+	ERR_CODE_UNKNOWN_METHOD            ErrorCode = "unknown_method"
+	ERR_CODE_PEER_MUST_UPGRADE         ErrorCode = "peer_must_upgrade"
+)
+
+type CodedError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// Errors with Unknown Codes, i.e., from a Newer Peer, are still Equal if their Codes are
+func (e *CodedError) Is(target error) bool {
+	t, ok := target.(*CodedError)
+	return ok && t.Code == e.Code
+}
+
+var (
+	codedErrors    = map[ErrorCode]*CodedError{}
+	legacyMessages = map[string]ErrorCode{} // Lowercased Messages Sent by Older Peers & Server
+)
+
+// 'legacy_messages' are what Older Peers or Server Send instead for this Error
+func NewCodedError(code ErrorCode, message string, legacy_messages ...string) *CodedError {
+	err := &CodedError{Code: code, Message: message}
+	codedErrors[code] = err
+	for _, msg := range append(legacy_messages, message) {
+		legacyMessages[strings.ToLower(msg)] = code
+	}
+	return err
+}
+
+var (
+	ErrInternalServerError           = NewCodedError(ERR_CODE_INTERNAL, "internal server error")
+	ErrIncorrectPassword             = NewCodedError(ERR_CODE_INCORRECT_PASSWORD, "incorrect password")
+	ErrNoSuchWorkspaceFound          = NewCodedError(ERR_CODE_NO_SUCH_WORKSPACE, "no such workspace found")
+	ErrUserAlreadyHasLatestWorkspace = NewCodedError(ERR_CODE_ALREADY_LATEST, "you already've latest version of workspace")
+	ErrInvalidLastPushNum            = NewCodedError(ERR_CODE_INVALID_LAST_PUSH_NUM, "invalid last push number")
+	ErrUnsupportedEncryptionVersion  = NewCodedError(ERR_CODE_UNSUPPORTED_ENCRYPTION, "listener uses an older encryption format, please update PKr")
+	ErrNotAPeerOfWorkspace           = NewCodedError(ERR_CODE_NOT_A_PEER, "you aren't a listener of this workspace")
+	ErrPeerHasNoNewerPush            = NewCodedError(ERR_CODE_PEER_HAS_NO_NEWER_PUSH, "peer doesn't have a newer push of workspace")
+	ErrPeerCannotServeWorkspace      = NewCodedError(ERR_CODE_PEER_CANNOT_SERVE, "peer can't serve this workspace")
+	ErrInvalidChunkRequest           = NewCodedError(ERR_CODE_INVALID_CHUNK_REQUEST, "requested chunks aren't part of the push range")
+	ErrIncorrectPushRange            = NewCodedError(ERR_CODE_INCORRECT_PUSH_RANGE, "incorrect workspace name/push num", "Incorrect Workspace Name/Push Num Range")
+	ErrInvalidResumeOffset           = NewCodedError(ERR_CODE_INVALID_RESUME_OFFSET, "invalid resume offset sent")
+	ErrInvalidDataRequestType        = NewCodedError(ERR_CODE_INVALID_DATA_REQUEST_TYPE, "invalid data request type sent")
+	ErrWorkspaceOwnerIsOffline       = NewCodedError(ERR_CODE_OWNER_OFFLINE, "workspace owner is offline")
+	ErrWorkspaceOwnerNotResponding   = NewCodedError(ERR_CODE_OWNER_NOT_RESPONDING, "workspace owner isn't responding")
+	ErrPeerAuthFailed                = NewCodedError(ERR_CODE_PEER_AUTH_FAILED, "peer couldn't be authenticated")
+	ErrUnknownPeer                   = NewCodedError(ERR_CODE_UNKNOWN_PEER, "public key of peer isn't known, connect to the workspace again")
+	ErrListenerRevoked               = NewCodedError(ERR_CODE_LISTENER_REVOKED, "your access to this workspace was revoked by its owner")
+	ErrInvalidAccessToken            = NewCodedError(ERR_CODE_INVALID_ACCESS_TOKEN, "invalid access token, connect to the workspace again")
+	ErrMissingDataHash               = NewCodedError(ERR_CODE_MISSING_DATA_HASH, "sender didn't send hash of data, it can't be verified")
+	ErrTooManyDataStreams            = NewCodedError(ERR_CODE_TOO_MANY_DATA_STREAMS, "too many parallel data sessions are open")
+	ErrUnknownMethod                 = NewCodedError(ERR_CODE_UNKNOWN_METHOD, "rpc method isn't known to peer")
+)
+
+// Code to Send along with 'err', Empty if it has None
+func GetErrorCode(err error) ErrorCode {
+	var coded_err *CodedError
+	if errors.As(err, &coded_err) {
+		return coded_err.Code
+	}
+	return ""
+}
+
+// Error Received with 'code' & 'message', Empty 'code' means Sender only Sent Message
+func ErrorFromCode(code ErrorCode, message string) error {
+	if code == "" {
+		code = legacyMessages[strings.ToLower(message)]
+	}
+	if err, ok := codedErrors[code]; ok {
+		return err
+	}
+	if code != "" {
+		return &CodedError{Code: code, Message: message}
+	}
+	return errors.New(message)
+}
+
+// Only Sent to Refuse Sessions of Older Listeners, which Read an Error in place of Data as "ERR:<Code>:<Message>"
+const (
+	ERROR_FRAME_PREFIX   = "ERR:"
+	MAX_ERROR_FRAME_SIZE = 512
+)
+
+func NewErrorFrame(err error) []byte {
+	frame := ERROR_FRAME_PREFIX + string(GetErrorCode(err)) + ":" + err.Error()
+	return []byte(frame[:min(len(frame), MAX_ERROR_FRAME_SIZE)])
+}
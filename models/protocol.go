@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Listener Calls Hello before any other Method of ClientHandler, to Agree on Protocol Version & Capabilities
+// Optional Capabilities're Used only if both Peers have them
+
+// Version 3 is the first with Authenticated Sessions, Framed Data & Signed Manifests, Older Peers're Refused
+const (
+	PROTOCOL_VERSION     = 3
+	MIN_PROTOCOL_VERSION = 3 // Oldest Version I still Talk to
+)
+
+type Capability uint32
+
+const (
+	CAP_AEAD            Capability = 1 << iota // Data is Sealed in AEAD Chunks
+	CAP_RESUME                                 // Data Sessions Start from a Resume Offset
+	CAP_MULTI_STREAM                           // Data is Fetched as Ranges over Parallel Sessions
+	CAP_COMPRESSION                            // Archives can be Tar+Zstd
+	CAP_CHUNKS                                 // Changed Files can be Fetched as Chunks via GetChunks
+	CAP_FRAMING                                // KCP-Plain Sessions're Framed, see framing package
+	CAP_SIGNED_MANIFEST                        // Owner always Sends Signed Push Manifest, Listener Rejects Pushes without it
+)
+
+const (
+	MY_CAPABILITIES       = CAP_AEAD | CAP_RESUME | CAP_MULTI_STREAM | CAP_COMPRESSION | CAP_CHUNKS | CAP_FRAMING | CAP_SIGNED_MANIFEST
+	REQUIRED_CAPABILITIES = CAP_AEAD | CAP_FRAMING | CAP_SIGNED_MANIFEST
+)
+
+var capabilityNames = map[Capability]string{
+	CAP_AEAD:            "AEAD",
+	CAP_RESUME:          "Resume",
+	CAP_MULTI_STREAM:    "Multi-Stream",
+	CAP_COMPRESSION:     "Compression",
+	CAP_CHUNKS:          "Chunks",
+	CAP_FRAMING:         "Framing",
+	CAP_SIGNED_MANIFEST: "Signed-Manifest",
+}
+
+var (
+	ErrIncompatibleProtocol = NewCodedError(ERR_CODE_INCOMPATIBLE_PROTOCOL, "peer's protocol version is incompatible, please update PKr")
+	ErrMissingCapability    = NewCodedError(ERR_CODE_MISSING_CAPABILITY, "peer doesn't support a required feature, please update PKr")
+	ErrPeerMustUpgrade      = NewCodedError(ERR_CODE_PEER_MUST_UPGRADE, "peer is running an older PKr without session authentication, it must upgrade")
+)
+
+type HelloRequest struct {
+	Username           string
+	ProtocolVersion    int
+	MinProtocolVersion int
+	Capabilities       Capability
+}
+
+type HelloResponse struct {
+	ProtocolVersion int        // Agreed Version
+	Capabilities    Capability // Agreed Capabilities
+}
+
+func (c Capability) Has(capability Capability) bool {
+	return c&capability == capability
+}
+
+func (c Capability) String() string {
+	names := []string{}
+	for capability := CAP_AEAD; capability <= CAP_SIGNED_MANIFEST; capability <<= 1 {
+		if c.Has(capability) {
+			names = append(names, capabilityNames[capability])
+		}
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Highest Version & Capabilities both Peers Support, Errors if they've none in Common or a Required Capability is Missing
+func NegotiateProtocol(peer_version, peer_min_version int, peer_capabilities Capability) (int, Capability, error) {
+	if peer_version < MIN_PROTOCOL_VERSION || peer_min_version > PROTOCOL_VERSION {
+		return 0, 0, fmt.Errorf("%w (peer: %d-%d, mine: %d-%d)", ErrIncompatibleProtocol, peer_min_version, peer_version, MIN_PROTOCOL_VERSION, PROTOCOL_VERSION)
+	}
+
+	capabilities := peer_capabilities & MY_CAPABILITIES
+	if missing := REQUIRED_CAPABILITIES &^ capabilities; missing != 0 {
+		return 0, 0, fmt.Errorf("%w (%s)", ErrMissingCapability, missing)
+	}
+	return min(peer_version, PROTOCOL_VERSION), capabilities, nil
+}
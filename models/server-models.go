@@ -1,8 +1,10 @@
 package models
 
-import "sync"
+// 'RequestID' is Generated by Listener for each RequestPunchFromReceiverRequest & Echoed back all the way
+// in NotifyToPunchRequest/Response & RequestPunchFromReceiverResponse, so Concurrent Requests aren't Mixed up
 
 type NotifyToPunchRequest struct {
+	RequestID           string `json:"request_id,omitempty"`
 	ListenerUsername    string `json:"listener_username"`
 	ListenerPublicIp    string `json:"listener_public_ip"`
 	ListenerPublicPort  string `json:"listener_public_port"`
@@ -11,6 +13,7 @@ type NotifyToPunchRequest struct {
 }
 
 type NotifyToPunchResponse struct {
+	RequestID                 string `json:"request_id,omitempty"`
 	WorkspaceOwnerPublicIp    string `json:"workspace_owner_public_ip"`
 	WorkspaceOwnerPublicPort  string `json:"workspace_owner_public_port"`
 	WorkspaceOwnerPrivateIp   string `json:"workspace_owner_private_ip"`
@@ -25,6 +28,7 @@ type NotifyNewPushToListeners struct {
 }
 
 type RequestPunchFromReceiverRequest struct {
+	RequestID              string `json:"request_id,omitempty"`
 	ListenerUsername       string `json:"listener_username"`
 	ListenerPublicIp       string `json:"listener_public_ip"`
 	ListenerPublicPort     string `json:"listener_public_port"`
@@ -34,20 +38,17 @@ type RequestPunchFromReceiverRequest struct {
 }
 
 type RequestPunchFromReceiverResponse struct {
-	Error                     string `json:"error"`
-	WorkspaceOwnerUsername    string `json:"workspace_owner_username"`
-	WorkspaceOwnerPublicIp    string `json:"workspace_owner_public_ip"`
-	WorkspaceOwnerPublicPort  string `json:"workspace_owner_public_port"`
-	WorkspaceOwnerPrivateIp   string `json:"workspace_owner_private_ip"`
-	WorkspaceOwnerPrivatePort string `json:"workspace_owner_private_port"`
+	RequestID                 string    `json:"request_id,omitempty"` // Empty if Server doesn't Echo it
+	Error                     string    `json:"error"`
+	ErrorCode                 ErrorCode `json:"error_code,omitempty"` // Empty if Server only Sends 'Error'
+	WorkspaceOwnerUsername    string    `json:"workspace_owner_username"`
+	WorkspaceOwnerPublicIp    string    `json:"workspace_owner_public_ip"`
+	WorkspaceOwnerPublicPort  string    `json:"workspace_owner_public_port"`
+	WorkspaceOwnerPrivateIp   string    `json:"workspace_owner_private_ip"`
+	WorkspaceOwnerPrivatePort string    `json:"workspace_owner_private_port"`
 }
 
 type WorkspaceOwnerIsOnline struct {
 	Error              string `json:"error"`
 	WorkspaceOwnerName string `json:"workspace_owner_username"`
 }
-
-type RequestPunchFromReceiverResponseMap struct {
-	sync.RWMutex
-	Map map[string]RequestPunchFromReceiverResponse
-}
@@ -81,3 +81,14 @@ func GetUserConfigFilePath() (string, error) {
 	}
 	return filepath.Join(user_config_root_dir, "Config", "user-config.json"), nil
 }
+
+// State of Failed Pulls which're to be Retried
+func GetPullRetriesFilePath() (string, error) {
+	user_config_root_dir, err := GetUserConfigRootDir()
+	if err != nil {
+		fmt.Println("Error while Getting Path of Local App Data:", err)
+		fmt.Println("Source: GetPullRetriesFilePath()")
+		return "", err
+	}
+	return filepath.Join(user_config_root_dir, "Config", "pull-retries.json"), nil
+}
@@ -0,0 +1,313 @@
+package ws
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/PKr-Parivar/PKr-Base/chunker"
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/dialer"
+	"github.com/PKr-Parivar/PKr-Base/filetracker"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/kcp-go"
+)
+
+// Local Versions of Updated Files usually share most of their Chunks with the New ones
+func chunkLocalFiles(store *chunker.Store, workspace_path string, file_chunks map[string][]models.FileChunk) {
+	for file_path, chunks := range file_chunks {
+		has_all_chunks := true
+		for _, chunk := range chunks {
+			if !store.Has(chunk.Hash) {
+				has_all_chunks = false
+				break
+			}
+		}
+		if has_all_chunks {
+			continue
+		}
+
+		local_path, err := filetracker.SafeJoin(workspace_path, file_path)
+		if err != nil {
+			continue
+		}
+		file, err := os.Open(local_path)
+		if err != nil {
+			// New File
+			continue
+		}
+		_, err = chunker.ChunkAndStore(store, file)
+		file.Close()
+		if err != nil {
+			logger.LOGGER.Println("Error while Chunking Local File:", err)
+			logger.LOGGER.Println("Source: chunkLocalFiles()")
+		}
+	}
+}
+
+// Every Chunk not in Store, in the Order they Appear & without Duplicates
+func getMissingChunks(store *chunker.Store, file_chunks map[string][]models.FileChunk) ([]string, map[string]int64) {
+	missing_chunks := []string{}
+	chunk_sizes := map[string]int64{}
+	for _, chunks := range file_chunks {
+		for _, chunk := range chunks {
+			if _, ok := chunk_sizes[chunk.Hash]; ok || store.Has(chunk.Hash) {
+				continue
+			}
+			chunk_sizes[chunk.Hash] = chunk.Size
+			missing_chunks = append(missing_chunks, chunk.Hash)
+		}
+	}
+	return missing_chunks, chunk_sizes
+}
+
+func callGetChunks(workspace_owner_ip, username, client_handler_name, workspace_name, encrypted_password, encrypted_access_token, request_push_range string, missing_chunks []string, udp_conn *net.UDPConn, kcp_profile dialer.KCPProfile) (*models.GetChunksResponse, error) {
+	kcp_conn, err := kcp.DialWithConnAndOptions(workspace_owner_ip, nil, kcp_profile.DataShards, kcp_profile.ParityShards, udp_conn)
+	if err != nil {
+		logger.LOGGER.Println("Error while Dialing Workspace Owner to Get Chunks:", err)
+		logger.LOGGER.Println("Source: callGetChunks()")
+		return nil, err
+	}
+	defer kcp_conn.Close()
+
+	// KCP Params for Congestion Control
+	dialer.ApplyKCPProfile(kcp_conn, kcp_profile)
+
+	if err = authenticateSession(kcp_conn, username); err != nil {
+		logger.LOGGER.Println("Error while Authenticating Session:", err)
+		logger.LOGGER.Println("Source: callGetChunks()")
+		return nil, err
+	}
+
+	rpc_buff := [3]byte{'R', 'P', 'C'}
+	_, err = kcp_conn.Write(rpc_buff[:])
+	if err != nil {
+		logger.LOGGER.Println("Error while Writing the type of Session(KCP-RPC or KCP-Plain):", err)
+		logger.LOGGER.Println("Source: callGetChunks()")
+		return nil, err
+	}
+
+	rpc_client := dialer.NewRPCClient(kcp_conn)
+	defer rpc_client.Close()
+	rpcClientHandler := dialer.ClientCallHandler{}
+
+	logger.LOGGER.Println("Calling GetChunks ...")
+	res, err := rpcClientHandler.CallGetChunks(MY_USERNAME, workspace_name, encrypted_password, encrypted_access_token, request_push_range, client_handler_name, missing_chunks, rpc_client)
+	if err != nil {
+		logger.LOGGER.Println("Error while Calling GetChunks:", err)
+		logger.LOGGER.Println("Source: callGetChunks()")
+		return nil, err
+	}
+	return res, nil
+}
+
+// Pack has Chunks in the Order they were Requested
+func storeChunksFromPack(store *chunker.Store, pack_path string, missing_chunks []string, chunk_sizes map[string]int64) error {
+	pack_file, err := os.Open(pack_path)
+	if err != nil {
+		logger.LOGGER.Println("Error while Opening Chunk Pack:", err)
+		logger.LOGGER.Println("Source: storeChunksFromPack()")
+		return err
+	}
+	defer pack_file.Close()
+
+	reader := bufio.NewReader(pack_file)
+	for _, hash := range missing_chunks {
+		size := chunk_sizes[hash]
+		if size < 0 || size > chunker.CHUNK_MAX_SIZE {
+			logger.LOGGER.Println("Invalid Chunk Size Received:", size)
+			logger.LOGGER.Println("Source: storeChunksFromPack()")
+			return ErrIntegrityCheckFailed
+		}
+
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(reader, chunk); err != nil {
+			logger.LOGGER.Println("Error while Reading Chunk from Pack:", err)
+			logger.LOGGER.Println("Source: storeChunksFromPack()")
+			return err
+		}
+
+		if err = store.Put(hash, chunk); err != nil {
+			logger.LOGGER.Println("Error while Storing Chunk:", err)
+			logger.LOGGER.Println("Source: storeChunksFromPack()")
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetches only Chunks I don't have & Assembles Updated Files from them
+func fetchChunksAndStoreIntoWorkspace(workspace_owner_ip, username, client_handler_name, workspace_name, encrypted_password, encrypted_access_token string, udp_conn *net.UDPConn, res models.GetMetaDataResponse, capabilities models.Capability, manifest *models.PushManifest, journal filetracker.ApplyJournal) error {
+	workspace_path, err := config.GetGetWorkspaceFilePath(workspace_name)
+	if err != nil {
+		logger.LOGGER.Println("Error while Fetching Workspace Path from Config:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		return err
+	}
+	logger.LOGGER.Println("Workspace Path: ", workspace_path)
+	kcp_profile := getAgreedKCPProfile(res)
+
+	for file_path, change_type := range res.Updates {
+		if _, ok := res.FileChunks[file_path]; change_type == "Updated" && !ok {
+			logger.LOGGER.Println("Workspace Owner didn't send Chunks of Updated File:", file_path)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return ErrIntegrityCheckFailed
+		}
+	}
+
+	store := chunker.NewStore(workspace_path)
+	chunkLocalFiles(store, workspace_path, res.FileChunks)
+
+	missing_chunks, chunk_sizes := getMissingChunks(store, res.FileChunks)
+	logger.LOGGER.Println("Chunks to be Fetched:", len(missing_chunks))
+
+	contents_path := filepath.Join(workspace_path, ".PKr", "Contents")
+	err = os.MkdirAll(contents_path, 0700)
+	if err != nil {
+		logger.LOGGER.Println("Error while Creating .PKr/Contents Directory:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		return err
+	}
+
+	if len(missing_chunks) > 0 {
+		chunks_res, err := callGetChunks(workspace_owner_ip, username, client_handler_name, workspace_name, encrypted_password, encrypted_access_token, res.RequestPushRange, missing_chunks, udp_conn, kcp_profile)
+		if err != nil {
+			logger.LOGGER.Println("Error while Getting Chunks:", err)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return err
+		}
+
+		if err = validateRemoteName(chunks_res.PackID); err != nil {
+			logger.LOGGER.Println("Invalid Pack ID Received:", chunks_res.PackID)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return err
+		}
+
+		chunk_cipher, err := decryptChunkCipher(chunks_res.EncryptionVersion, chunks_res.KeyBytes, chunks_res.IVBytes)
+		if err != nil {
+			logger.LOGGER.Println("Error while Decrypting Keys:", err)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return err
+		}
+
+		pack_path := filepath.Join(contents_path, chunks_res.PackID+".pack")
+		err = fetchVerifiedData(fetchRequest{
+			workspace_owner_ip: workspace_owner_ip,
+			username:           username,
+			workspace_name:     workspace_name,
+			data_req_type:      "Chunks",
+			push_range:         chunks_res.PackID,
+			len_data:           chunks_res.LenData,
+			expected_hash:      chunks_res.PackHash,
+			file_path:          pack_path,
+			udp_conn:           udp_conn,
+			chunk_cipher:       chunk_cipher,
+			max_streams:        res.MaxStreams,
+			capabilities:       getDataCapabilities(res, capabilities),
+			kcp_profile:        kcp_profile,
+		})
+		if err != nil {
+			logger.LOGGER.Println("Error while Fetching Chunk Pack:", err)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return err
+		}
+
+		err = storeChunksFromPack(store, pack_path, missing_chunks, chunk_sizes)
+		os.Remove(pack_path)
+		if err != nil {
+			logger.LOGGER.Println("Error while Storing Chunks from Pack:", err)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			return err
+		}
+	}
+
+	assemble_dest := filepath.Join(contents_path, res.RequestPushRange)
+	if err = os.MkdirAll(assemble_dest, 0700); err != nil {
+		logger.LOGGER.Println("Error while Creating .PKr/Push Num Directory:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		return err
+	}
+	for file_path, change_type := range res.Updates {
+		if change_type != "Updated" {
+			continue
+		}
+		dst_path, err := filetracker.SafeJoin(assemble_dest, file_path)
+		if err != nil {
+			logger.LOGGER.Println("Unsafe File Path Received:", file_path)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			os.RemoveAll(assemble_dest)
+			return err
+		}
+		if err = store.Assemble(res.FileChunks[file_path], dst_path); err != nil {
+			logger.LOGGER.Println("Error while Assembling File from Chunks:", err)
+			logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+			os.RemoveAll(assemble_dest)
+			return err
+		}
+	}
+
+	// Chunk Lists aren't Signed, so Assembled Files're Verified against Manifest
+	if err = verifyFilesAgainstManifest(assemble_dest, res.Updates, manifest); err != nil {
+		logger.LOGGER.Println("Error while Verifying Assembled Files against Manifest:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		os.RemoveAll(assemble_dest)
+		return err
+	}
+
+	conflicts, err := filetracker.ApplyUpdatesToWorkspace(workspace_path, assemble_dest, journal)
+	if err != nil {
+		logger.LOGGER.Println("Error while Applying Updates to Workspace:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		os.RemoveAll(assemble_dest)
+		return err
+	}
+	notifyConflicts(journal.WorkspaceName, journal.PushNum, conflicts)
+
+	err = os.RemoveAll(assemble_dest)
+	if err != nil {
+		logger.LOGGER.Println("Error while Removing the Assembled Files:", err)
+		logger.LOGGER.Println("Source: fetchChunksAndStoreIntoWorkspace()")
+		return err
+	}
+
+	pruneChunkStore(store, res.Updates, res.FileChunks)
+	return nil
+}
+
+// Chunks of Files my Workspace is at're kept, so the next Pull only Fetches what Changed
+// Chunks Fetched for a Failed Pull're Pruned by the next one that Succeeds
+func pruneChunkStore(store *chunker.Store, updates map[string]string, file_chunks map[string][]models.FileChunk) {
+	index, err := store.ReadIndex()
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading Chunk Index, Starting a New one:", err)
+		logger.LOGGER.Println("Source: pruneChunkStore()")
+		index = map[string][]models.FileChunk{}
+	}
+
+	for file_path, change_type := range updates {
+		if change_type == "Updated" {
+			index[file_path] = file_chunks[file_path]
+		} else {
+			delete(index, file_path)
+		}
+	}
+	if err = store.WriteIndex(index); err != nil {
+		logger.LOGGER.Println("Error while Writing Chunk Index:", err)
+		logger.LOGGER.Println("Source: pruneChunkStore()")
+		return
+	}
+
+	keep := map[string]bool{}
+	for _, chunks := range index {
+		for _, chunk := range chunks {
+			keep[chunk.Hash] = true
+		}
+	}
+	if err = store.Prune(keep); err != nil {
+		logger.LOGGER.Println("Error while Pruning Chunk Store:", err)
+		logger.LOGGER.Println("Source: pruneChunkStore()")
+	}
+}
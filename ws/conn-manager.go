@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+type ConnectionState int
+
+const (
+	STATE_DISCONNECTED ConnectionState = iota
+	STATE_CONNECTING
+	STATE_CONNECTED
+)
+
+const (
+	RECONNECT_MIN_BACKOFF = 2 * time.Second
+	RECONNECT_MAX_BACKOFF = 10 * time.Minute
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case STATE_CONNECTING:
+		return "Connecting"
+	case STATE_CONNECTED:
+		return "Connected"
+	default:
+		return "Disconnected"
+	}
+}
+
+// Keeps the WebSocket Connection to the Server alive
+// Re-Dials with Jittered Exponential Backoff whenever the Connection Drops
+type ConnectionManager struct {
+	sync.RWMutex
+	ws_url     string
+	dialer     websocket.Dialer
+	conn       *websocket.Conn
+	state      ConnectionState
+	on_connect func(conn *websocket.Conn)
+}
+
+var CONN_MANAGER *ConnectionManager
+
+// 'on_connect' is called in a new go routine after every successful (Re)Connect
+func NewConnectionManager(ws_url string, on_connect func(conn *websocket.Conn)) *ConnectionManager {
+	return &ConnectionManager{
+		ws_url: ws_url,
+		dialer: websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 30 * time.Second,
+			NetDialContext: (&net.Dialer{
+				Timeout:   10 * time.Second, // TCP connection timeout
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+		},
+		state:      STATE_DISCONNECTED,
+		on_connect: on_connect,
+	}
+}
+
+func (m *ConnectionManager) State() ConnectionState {
+	m.RLock()
+	defer m.RUnlock()
+	return m.state
+}
+
+func (m *ConnectionManager) IsConnected() bool {
+	return m.State() == STATE_CONNECTED
+}
+
+// Returns nil if not Connected
+func (m *ConnectionManager) CurrentConn() *websocket.Conn {
+	m.RLock()
+	defer m.RUnlock()
+	if m.state != STATE_CONNECTED {
+		return nil
+	}
+	return m.conn
+}
+
+func (m *ConnectionManager) setState(state ConnectionState, conn *websocket.Conn) {
+	m.Lock()
+	m.state = state
+	m.conn = conn
+	m.Unlock()
+	logger.LOGGER.Println("WebSocket Connection State:", state)
+}
+
+// Blocks until an Interrupt is Received
+func (m *ConnectionManager) Run(interrupt <-chan os.Signal) {
+	attempt := 0
+	for {
+		m.setState(STATE_CONNECTING, nil)
+		logger.LOGGER.Println("Attempting to Connect to the Web Socket Server... | IP: ", m.ws_url)
+		conn, _, err := m.dialer.Dial(m.ws_url, nil)
+		if err != nil {
+			logDialError(err)
+			m.setState(STATE_DISCONNECTED, nil)
+
+			wait_time := reconnectBackoff(attempt)
+			attempt += 1
+			logger.LOGGER.Printf("Will Retry WebSocket Connection in %v (Attempt: %d)\n", wait_time, attempt)
+
+			select {
+			case <-time.After(wait_time):
+				logger.LOGGER.Println("Retrying WebSocket connection...")
+				continue
+			case <-interrupt:
+				logger.LOGGER.Println("Interrupt received. Exiting.")
+				return
+			}
+		}
+
+		attempt = 0
+		m.setState(STATE_CONNECTED, conn)
+		logger.LOGGER.Println("Connected to Server")
+
+		done := make(chan struct{})
+		go ReadJSONMessage(done, conn)
+		go PingPongWriter(done, conn)
+
+		if m.on_connect != nil {
+			go m.on_connect(conn)
+		}
+
+		select {
+		case <-done:
+			logger.LOGGER.Println("WebSocket Connection to Server Lost, Reconnecting ...")
+			conn.Close()
+			m.setState(STATE_DISCONNECTED, nil)
+		case <-interrupt:
+			logger.LOGGER.Println("Interrupt Received, Closing Connection ...")
+			m.setState(STATE_DISCONNECTED, nil)
+
+			err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Bye"))
+			if err != nil {
+				logger.LOGGER.Println("Error while Writing Close Message to Server via WS:", err)
+				logger.LOGGER.Println("Source: Run()")
+			}
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Full Jitter between half & full of the Exponential Backoff
+func reconnectBackoff(attempt int) time.Duration {
+	backoff := RECONNECT_MIN_BACKOFF
+	for i := 0; i < attempt && backoff < RECONNECT_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, RECONNECT_MAX_BACKOFF)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func logDialError(err error) {
+	logger.LOGGER.Println("WebSocket connection failed:", err)
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		logger.LOGGER.Println("Connection timed out.")
+	} else if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok && strings.Contains(sysErr.Error(), "actively refused") {
+			logger.LOGGER.Println("Server refused the connection.")
+		} else {
+			logger.LOGGER.Println("Unexpected Error - is an opError but not 'actively refused'")
+			logger.LOGGER.Println("Error while Dialing Websocket Connection to Server: ", opErr)
+			logger.LOGGER.Println("Source: logDialError()")
+		}
+	} else {
+		logger.LOGGER.Println("Unexpected Error - Not opError or timeout")
+		logger.LOGGER.Println("Error while Dialing Websocket Connection to Server: ", err)
+		logger.LOGGER.Println("Source: logDialError()")
+	}
+}
@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/handler"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/PKr-Base/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// New Push Notifications, Owner coming Online & Checks on (Re)Connect all Trigger Pulls
+// Only one Pull of a Workspace Runs at a time, Triggers while it Runs're Collapsed into one more Pull
+// which Fetches whatever is Latest by then. Failed Pulls're Retried as per PullRetryQueue
+
+type PullTrigger string
+
+const (
+	PULL_TRIGGER_NEW_PUSH     PullTrigger = "New Push"
+	PULL_TRIGGER_OWNER_ONLINE PullTrigger = "Workspace Owner is Online"
+	PULL_TRIGGER_RECONNECT    PullTrigger = "New Changes since Last Connect"
+	PULL_TRIGGER_RETRY        PullTrigger = "Retry"
+)
+
+type scheduledPull struct {
+	workspace_owner string
+	workspace_name  string
+	conn            *websocket.Conn // Latest Conn it was Triggered with
+	is_pending      bool            // Triggered again while Running
+}
+
+type PullScheduler struct {
+	mutex        sync.Mutex
+	pulls        map[string]*scheduledPull // Running Pulls, by Workspace Owner & Name
+	retry_timers map[string]*time.Timer
+	retry_queue  *PullRetryQueue
+}
+
+var PULL_SCHEDULER = NewPullScheduler()
+
+func NewPullScheduler() *PullScheduler {
+	return &PullScheduler{
+		pulls:        map[string]*scheduledPull{},
+		retry_timers: map[string]*time.Timer{},
+		retry_queue:  &PullRetryQueue{retries: map[string]*PullRetry{}},
+	}
+}
+
+// Loads Failures from before a Restart & Resumes their Retries, must be Called before any Pull is Scheduled
+// Retries Due while there's no Conn to Server're left to the Check on (Re)Connect
+func (s *PullScheduler) LoadRetries() error {
+	file_path, err := utils.GetPullRetriesFilePath()
+	if err != nil {
+		return err
+	}
+	retry_queue, err := LoadPullRetryQueue(file_path)
+	if err != nil {
+		logger.LOGGER.Println("Error while Loading Pull Retries, Starting Afresh:", err)
+		logger.LOGGER.Println("Source: LoadRetries()")
+	}
+
+	s.retry_queue = retry_queue
+	for _, retry := range retry_queue.Pending() {
+		logger.LOGGER.Printf("Pull of Workspace: %s had Failed %d time(s): %s\n", retry.WorkspaceName, retry.Attempts, retry.Reason)
+		s.armRetry(retry)
+	}
+	return nil
+}
+
+// Pulls Workspace in a new go routine, unless it's already being Pulled
+// Workspaces whose last Pull Failed Permanently're only Pulled again on a New Push
+func (s *PullScheduler) Schedule(workspace_owner, workspace_name string, conn *websocket.Conn, trigger PullTrigger) {
+	key := getPullKey(workspace_owner, workspace_name)
+	if conn == nil {
+		logger.LOGGER.Printf("Not Connected to Server, Pull of Workspace: %s is left to next Connect (%s)\n", workspace_name, trigger)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if retry, ok := s.retry_queue.Get(workspace_owner, workspace_name); ok && retry.Kind == PULL_FAILURE_PERMANENT && trigger != PULL_TRIGGER_NEW_PUSH {
+		logger.LOGGER.Printf("Not Pulling Workspace: %s, its last Pull Failed Permanently: %s (%s)\n", workspace_name, retry.Reason, trigger)
+		return
+	}
+
+	if pull, ok := s.pulls[key]; ok {
+		pull.conn = conn
+		pull.is_pending = true
+		logger.LOGGER.Printf("Pull of Workspace: %s is Running, it'll be Pulled again once Done (%s)\n", workspace_name, trigger)
+		return
+	}
+
+	pull := &scheduledPull{workspace_owner: workspace_owner, workspace_name: workspace_name, conn: conn}
+	s.pulls[key] = pull
+	logger.LOGGER.Printf("Pull of Workspace: %s Scheduled (%s)\n", workspace_name, trigger)
+	go s.run(key, pull)
+}
+
+func (s *PullScheduler) run(key string, pull *scheduledPull) {
+	for {
+		s.mutex.Lock()
+		conn := pull.conn
+		pull.is_pending = false
+		s.mutex.Unlock()
+
+		err := PullWorkspace(pull.workspace_owner, pull.workspace_name, conn)
+		s.handlePullResult(pull, err)
+
+		s.mutex.Lock()
+		if !pull.is_pending {
+			delete(s.pulls, key)
+			s.mutex.Unlock()
+			return
+		}
+		s.mutex.Unlock()
+		logger.LOGGER.Println("Pulling Workspace again for Triggers while it was being Pulled:", pull.workspace_name)
+	}
+}
+
+// Owner being Offline isn't Retried, Server Notifies when Owner is Online
+func (s *PullScheduler) handlePullResult(pull *scheduledPull, err error) {
+	if errors.Is(err, handler.ErrUserAlreadyHasLatestWorkspace) {
+		logger.LOGGER.Println("You've Lastest Version of Workspace, No Need to Transfer Data")
+		err = nil
+	}
+	if errors.Is(err, models.ErrWorkspaceOwnerIsOffline) {
+		logger.LOGGER.Println("Workspace Owner is Offline, Server'll notify when he's online")
+		err = nil
+	}
+	if err == nil {
+		s.stopRetry(pull.workspace_owner, pull.workspace_name)
+		s.retry_queue.Clear(pull.workspace_owner, pull.workspace_name)
+		return
+	}
+
+	logger.LOGGER.Println("Error while Pulling Data:", err)
+	logger.LOGGER.Println("Source: handlePullResult()")
+
+	retry := s.retry_queue.RecordFailure(pull.workspace_owner, pull.workspace_name, err)
+	if retry.Kind == PULL_FAILURE_PERMANENT {
+		s.stopRetry(pull.workspace_owner, pull.workspace_name)
+		logger.LOGGER.Printf("Pull of Workspace: %s Failed Permanently, it'll be Retried on its next Push\n", pull.workspace_name)
+		return
+	}
+	s.armRetry(retry)
+}
+
+// Schedules Pull at 'retry.NextAttempt' with Conn of that time, Replacing any Earlier Timer
+func (s *PullScheduler) armRetry(retry PullRetry) {
+	delay := max(0, time.Until(retry.NextAttempt))
+	logger.LOGGER.Printf("Pull of Workspace: %s will be Retried in %v (Attempt: %d)\n", retry.WorkspaceName, delay.Round(time.Second), retry.Attempts+1)
+
+	key := getPullKey(retry.WorkspaceOwner, retry.WorkspaceName)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if timer, ok := s.retry_timers[key]; ok {
+		timer.Stop()
+	}
+	s.retry_timers[key] = time.AfterFunc(delay, func() {
+		var conn *websocket.Conn
+		if CONN_MANAGER != nil {
+			conn = CONN_MANAGER.CurrentConn()
+		}
+		s.Schedule(retry.WorkspaceOwner, retry.WorkspaceName, conn, PULL_TRIGGER_RETRY)
+	})
+}
+
+func (s *PullScheduler) stopRetry(workspace_owner, workspace_name string) {
+	key := getPullKey(workspace_owner, workspace_name)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if timer, ok := s.retry_timers[key]; ok {
+		timer.Stop()
+		delete(s.retry_timers, key)
+	}
+}
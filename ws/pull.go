@@ -1,13 +1,11 @@
 package ws
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 
 	"math/rand"
 	"net"
-	"net/rpc"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -28,6 +26,15 @@ import (
 
 const DATA_CHUNK = handler.DATA_CHUNK
 
+const (
+	MAX_FETCH_ATTEMPTS    = 3
+	FETCH_RETRY_WAIT_TIME = 5 * time.Second
+
+	MAX_CONFLICTS_IN_NOTIFICATION = 5
+)
+
+var ErrIntegrityCheckFailed = errors.New("integrity check of received data failed")
+
 var MY_USERNAME string
 var MY_SERVER_IP string
 
@@ -55,7 +62,17 @@ func connectToAnotherUser(workspace_owner_username string, conn *websocket.Conn)
 		return "", "", nil, nil, err
 	}
 
+	// Response is Matched to this Request by its ID, as other Pulls may be Connecting to the same Owner
+	request_id, response_chan, err := PUNCH_RESPONSE_WAITERS.register(workspace_owner_username)
+	if err != nil {
+		logger.LOGGER.Println("Error while Generating Punch Request ID:", err)
+		logger.LOGGER.Println("Source: connectToAnotherUser()")
+		return "", "", nil, nil, err
+	}
+	defer PUNCH_RESPONSE_WAITERS.unregister(request_id)
+
 	var req_punch_from_receiver_request models.RequestPunchFromReceiverRequest
+	req_punch_from_receiver_request.RequestID = request_id
 	req_punch_from_receiver_request.WorkspaceOwnerUsername = workspace_owner_username
 	req_punch_from_receiver_request.ListenerUsername = MY_USERNAME
 	req_punch_from_receiver_request.ListenerPublicIp = my_public_IP_only
@@ -75,39 +92,17 @@ func connectToAnotherUser(workspace_owner_username string, conn *websocket.Conn)
 
 	}
 
-	var req_punch_from_receiver_response models.RequestPunchFromReceiverResponse
-	var ok, invalid_flag bool
-	count := 0
-
-	for {
-		time.Sleep(5 * time.Second)
-		RequestPunchFromReceiverResponseMap.Lock()
-		req_punch_from_receiver_response, ok = RequestPunchFromReceiverResponseMap.Map[workspace_owner_username]
-		RequestPunchFromReceiverResponseMap.Unlock()
-		if ok {
-			RequestPunchFromReceiverResponseMap.Lock()
-			delete(RequestPunchFromReceiverResponseMap.Map, workspace_owner_username)
-			RequestPunchFromReceiverResponseMap.Unlock()
-			break
-		}
-
-		if count == 6 {
-			invalid_flag = true
-			break
-		}
-		count += 1
-	}
-
-	if invalid_flag {
+	req_punch_from_receiver_response, err := PUNCH_RESPONSE_WAITERS.wait(request_id, response_chan, PUNCH_RESPONSE_TIMEOUT)
+	if err != nil {
 		logger.LOGGER.Println("Error: Workspace Owner isn't Responding\nSource: connectToAnotherUser()")
-		return "", "", nil, nil, errors.New("workspace owner isn't responding")
+		return "", "", nil, nil, err
 	}
 
 	if req_punch_from_receiver_response.Error != "" {
 		logger.LOGGER.Println("Error Received from Server's WS:", req_punch_from_receiver_response.Error)
 		logger.LOGGER.Println("Description: Could Not Request Punch From Receiver")
 		logger.LOGGER.Println("Source: connectToAnotherUser()")
-		return "", "", nil, nil, errors.New(req_punch_from_receiver_response.Error)
+		return "", "", nil, nil, models.ErrorFromCode(req_punch_from_receiver_response.ErrorCode, req_punch_from_receiver_response.Error)
 	}
 
 	// Creating UDP Conn to Perform UDP NAT Hole Punching
@@ -141,181 +136,370 @@ func connectToAnotherUser(workspace_owner_username string, conn *websocket.Conn)
 	logger.LOGGER.Println("UDP NAT Hole Punching Completed Successfully")
 
 	// Creating KCP-Conn, KCP = Reliable UDP
-	kcp_conn, err := kcp.DialWithConnAndOptions(workspace_owner_ip, nil, 0, 0, udp_conn)
+	kcp_conn, err := kcp.DialWithConnAndOptions(workspace_owner_ip, nil, dialer.KCP_PROFILE.DataShards, dialer.KCP_PROFILE.ParityShards, udp_conn)
 	if err != nil {
 		logger.LOGGER.Println("Error while Dialing KCP Connection to Remote Addr:", err)
 		logger.LOGGER.Println("Source: connectToAnotherUser()")
+		udp_conn.Close()
 		return "", "", nil, nil, err
 	}
 
-	// KCP Params for Congestion Control
-	kcp_conn.SetWindowSize(128, 1024)
-	kcp_conn.SetNoDelay(1, 10, 2, 1)
-	kcp_conn.SetACKNoDelay(true)
-	kcp_conn.SetDSCP(46)
+	// KCP Params for Congestion Control, Windows're Agreed with Workspace Owner during GetMetaData
+	dialer.ApplyKCPProfile(kcp_conn, dialer.KCP_PROFILE)
 
 	return client_handler_name, workspace_owner_ip, udp_conn, kcp_conn, nil
 }
 
-func fetchAndStoreDataIntoWorkspace(workspace_owner_ip, workspace_name string, udp_conn *net.UDPConn, res models.GetMetaDataResponse) error {
-	// Decrypting AES Key
-	key, err := encrypt.RSADecryptData(string(res.KeyBytes))
+// Every Session is Authenticated before its Type is Sent, see dialer.AuthenticateToUser()
+// I only Pull from Users whose Keys I've, so an Unknown Key is an Error too
+func authenticateSession(kcp_conn *kcp.UDPSession, username string) error {
+	peer, err := dialer.AuthenticateToUser(kcp_conn, MY_USERNAME, username)
 	if err != nil {
-		logger.LOGGER.Println("Error while Decrypting Key:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
 		return err
 	}
+	if !peer.IsKnown {
+		return models.ErrUnknownPeer
+	}
+	return nil
+}
 
-	// Decrypting AES IV
-	iv, err := encrypt.RSADecryptData(string(res.IVBytes))
+// Everything needed to Fetch one Piece of Data from a User, Passed down to each of its Streams
+type fetchRequest struct {
+	workspace_owner_ip string
+	username           string // User Data is Fetched from
+	workspace_name     string
+	workspace_owner    string // Only Sent for "Swarm"
+	data_req_type      string // "Pull", "Chunks" or "Swarm"
+	push_range         string // Name of Requested Data, Push Range for Zips or Pack ID for Chunks
+	len_data           int
+	expected_hash      string // Hash of Plaintext, see verifyZipHash()
+	file_path          string // Data is Downloaded here
+	udp_conn           *net.UDPConn
+	chunk_cipher       *encrypt.ChunkCipher
+	max_streams        int               // From GetMetaDataResponse, Data is Fetched over that many Sessions at most
+	capabilities       models.Capability // Agreed with Sender, see getDataCapabilities()
+	kcp_profile        dialer.KCPProfile // Windows Agreed with Workspace Owner, see getAgreedKCPProfile()
+}
+
+// Older Senders Serve a single Session from Resume Offset till End
+func (r fetchRequest) useRanges() bool {
+	return r.max_streams > 0 && r.capabilities.Has(models.CAP_MULTI_STREAM)
+}
+
+// Downloads & Decrypts Data from 'fetch_req.username' into 'fetch_req.file_path', Resuming from the Chunks already Present in it
+// Partial File is kept on Errors, so the next Attempt only fetches the Remaining Chunks
+func fetchData(fetch_req fetchRequest) error {
+	len_data, zip_file_path := fetch_req.len_data, fetch_req.file_path
+	num_chunks, last_chunk_size, err := encrypt.SealedLayout(int64(len_data))
 	if err != nil {
-		logger.LOGGER.Println("Error while Decrypting 'IV':", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		logger.LOGGER.Println("Invalid Len Data Received from Workspace Owner:", err)
+		logger.LOGGER.Println("Source: fetchData()")
 		return err
 	}
+	plain_size := int64(len_data) - encrypt.AEAD_HEADER_SIZE - num_chunks*encrypt.AEAD_TAG_SIZE
 
-	workspace_path, err := config.GetGetWorkspaceFilePath(workspace_name)
-	if err != nil {
-		logger.LOGGER.Println("Error while Fetching Workspace Path from Config:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-		return err
+	// Sender can't Start from a Resume Offset, so Data from Previous Attempts is of no use
+	if !fetch_req.capabilities.Has(models.CAP_RESUME) {
+		removePartialDownload(zip_file_path)
 	}
-	logger.LOGGER.Println("Workspace Path: ", workspace_path)
 
-	zip_file_path := filepath.Join(workspace_path, ".PKr", "Contents", res.RequestPushRange+".zip")
-	// Create Zip File
-	zip_file_obj, err := os.Create(zip_file_path)
+	// Open without Truncating, to keep Data from Previous Attempts
+	zip_file_obj, err := os.OpenFile(zip_file_path, os.O_CREATE|os.O_WRONLY, 0700)
 	if err != nil {
 		logger.LOGGER.Println("Failed to Open & Create Zipped File:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		logger.LOGGER.Println("Source: fetchData()")
 		return err
 	}
 	defer zip_file_obj.Close()
 
-	// To Write Decrypted Data in Chunks
-	writer := bufio.NewWriter(zip_file_obj)
+	num_streams := 1
+	if fetch_req.useRanges() {
+		num_streams = max(1, min(TRANSFER_STREAMS, fetch_req.max_streams))
+	}
+
+	progress, ok := readTransferProgress(zip_file_path, len_data, num_chunks)
+	if !ok {
+		file_info, err := zip_file_obj.Stat()
+		if err != nil {
+			logger.LOGGER.Println("Failed to Get FileInfo of Zipped File:", err)
+			logger.LOGGER.Println("Source: fetchData()")
+			return err
+		}
+
+		partial_size := file_info.Size()
+		if partial_size > plain_size {
+			logger.LOGGER.Println("Partial File is Larger than Expected Data, Starting Over")
+			partial_size = 0
+		}
+		// Only Complete Chunks can be Resumed from
+		progress = newTransferProgress(len_data, partial_size/encrypt.AEAD_CHUNK, num_chunks, num_streams)
+	}
+	if !fetch_req.useRanges() && len(progress.Ranges) > 1 {
+		progress = newTransferProgress(len_data, progress.contiguousChunks(), num_chunks, 1)
+	}
+
+	// Anything after the Chunks already Present is Discarded
+	resume_offset := progress.Ranges[0].Start * encrypt.AEAD_CHUNK
+	if len(progress.Ranges) == 1 {
+		resume_offset = progress.Ranges[0].Next * encrypt.AEAD_CHUNK
+		err = zip_file_obj.Truncate(resume_offset)
+		if err != nil {
+			logger.LOGGER.Println("Failed to Truncate Zipped File to Resume Offset:", err)
+			logger.LOGGER.Println("Source: fetchData()")
+			return err
+		}
+	}
+	logger.LOGGER.Println("Resume Offset:", resume_offset)
+	logger.LOGGER.Println("Num of Streams:", len(progress.Ranges))
+
+	if err = progress.save(zip_file_path, zip_file_obj); err != nil {
+		logger.LOGGER.Println("Error while Saving Transfer Progress:", err)
+		logger.LOGGER.Println("Source: fetchData()")
+		return err
+	}
 
-	// Now Transfer Data using KCP ONLY, No RPC in chunks
-	logger.LOGGER.Println("Connecting Again to Workspace Owner")
-	kcp_conn, err := kcp.DialWithConnAndOptions(workspace_owner_ip, nil, 0, 0, udp_conn)
+	logger.LOGGER.Println("Len Data Bytes:", len_data)
+	logger.LOGGER.Println("Now Reading Data from Workspace Owner ...")
+	err = fetchRanges(fetch_req, progress, zip_file_obj, num_chunks, last_chunk_size)
 	if err != nil {
-		logger.LOGGER.Println("Error while Dialing Workspace Owner to Get Data:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		logger.LOGGER.Println("Error while Fetching Data:", err)
+		logger.LOGGER.Println("Source: fetchData()")
 		return err
 	}
-	defer kcp_conn.Close()
-	logger.LOGGER.Println("Connected Successfully to Workspace Owner")
+	logger.LOGGER.Println("Data Transfer Completed ...")
 
-	// KCP Params for Congestion Control
-	kcp_conn.SetWindowSize(128, 1024)
-	kcp_conn.SetNoDelay(1, 10, 2, 1)
-	kcp_conn.SetACKNoDelay(true)
-	kcp_conn.SetDSCP(46)
+	// Ranges're Written at their Offsets, so Size is Set only once all're Present
+	if err = zip_file_obj.Truncate(plain_size); err != nil {
+		logger.LOGGER.Println("Failed to Truncate Zipped File to its Size:", err)
+		logger.LOGGER.Println("Source: fetchData()")
+		return err
+	}
+	if err = zip_file_obj.Sync(); err != nil {
+		logger.LOGGER.Println("Error while Syncing Zipped File:", err)
+		logger.LOGGER.Println("Soure: fetchData()")
+		return err
+	}
+
+	if err = os.Remove(getProgressPath(zip_file_path)); err != nil {
+		logger.LOGGER.Println("Error while Removing Transfer Progress:", err)
+		logger.LOGGER.Println("Source: fetchData()")
+	}
+	return nil
+}
 
-	// Sending the Type of Session
-	kpc_buff := [3]byte{'K', 'C', 'P'}
-	_, err = kcp_conn.Write(kpc_buff[:])
+// Partial Downloads of older Push Ranges can't be Resumed anymore, as Owner has Pushed Again
+func removeStalePartialDownloads(contents_path, current_archive_name string) {
+	entries, err := os.ReadDir(contents_path)
 	if err != nil {
-		logger.LOGGER.Println("Error while Writing the type of Session(KCP-RPC or KCP-Plain):", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-		return err
+		logger.LOGGER.Println("Error while Reading Contents Dir:", err)
+		logger.LOGGER.Println("Source: removeStalePartialDownloads()")
+		return
 	}
 
-	logger.LOGGER.Println("Sending Workspace Name, Push Num & Data Request Type(Pull/Clone) to Workspace Owner")
-	// Sending Workspace Name & Push Num
-	_, err = kcp_conn.Write([]byte(workspace_name))
+	for _, entry := range entries {
+		// Progress of a Partial Download goes with it
+		name := strings.TrimSuffix(entry.Name(), ".progress")
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".zip" && ext != ".zst") || name == current_archive_name {
+			continue
+		}
+		logger.LOGGER.Println("Removing Stale Partial Download:", entry.Name())
+		if err = os.Remove(filepath.Join(contents_path, entry.Name())); err != nil {
+			logger.LOGGER.Println("Error while Removing Stale Partial Download:", err)
+			logger.LOGGER.Println("Source: removeStalePartialDownloads()")
+		}
+	}
+}
+
+// Names Sent by other Users're used as File Names under .PKr, so they must be a single Path Segment
+func validateRemoteName(name string) error {
+	if err := filetracker.ValidateRelPath(name); err != nil || filepath.Base(name) != name {
+		return filetracker.ErrUnsafePath
+	}
+	return nil
+}
+
+// Verify Plaintext Zip as a whole before it touches the Working Tree, GCM only Authenticates each Chunk
+// Only AEAD Senders're Supported (see decryptChunkCipher()) & all of them Send the Hash, so it's Mandatory
+func verifyZipHash(zip_file_path, expected_hash string) error {
+	if expected_hash == "" {
+		logger.LOGGER.Println("Error: Sender didn't send Hash of Data, it can't be Verified")
+		logger.LOGGER.Println("Source: verifyZipHash()")
+		return models.ErrMissingDataHash
+	}
+
+	zip_hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(zip_file_path)
 	if err != nil {
-		logger.LOGGER.Println("Error while Sending Workspace Name to Workspace Owner:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		logger.LOGGER.Println("Error while Generating Hash of Received Zip File:", err)
+		logger.LOGGER.Println("Source: verifyZipHash()")
 		return err
 	}
 
-	_, err = kcp_conn.Write([]byte(res.RequestPushRange))
+	if zip_hash != expected_hash {
+		logger.LOGGER.Println("Received Zip Hash:", zip_hash)
+		logger.LOGGER.Println("Expected Zip Hash:", expected_hash)
+		logger.LOGGER.Println("Source: verifyZipHash()")
+		return ErrIntegrityCheckFailed
+	}
+	logger.LOGGER.Println("Integrity of Received Zip File Verified")
+	return nil
+}
+
+// AES Key & IV're Encrypted with my Public Key
+func decryptChunkCipher(encryption_version int, key_bytes, iv_bytes []byte) (*encrypt.ChunkCipher, error) {
+	if encryption_version != encrypt.ENCRYPTION_VERSION_AEAD {
+		logger.LOGGER.Println("Workspace Owner's Encryption Version isn't Supported:", encryption_version)
+		logger.LOGGER.Println("Source: decryptChunkCipher()")
+		return nil, encrypt.ErrUnsupportedEncryptionVersion
+	}
+
+	// Decrypting AES Key
+	key, err := encrypt.RSADecryptData(string(key_bytes))
 	if err != nil {
-		logger.LOGGER.Println("Error while Sending Workspace Name to Workspace Owner:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-		return err
+		logger.LOGGER.Println("Error while Decrypting Key:", err)
+		logger.LOGGER.Println("Source: decryptChunkCipher()")
+		return nil, err
 	}
-	logger.LOGGER.Println("Workspace Name, Push Num & Data Request Type(Pull/Clone) Sent to Workspace Owner")
 
-	_, err = kcp_conn.Write([]byte("Pull"))
+	// Decrypting AES IV
+	iv, err := encrypt.RSADecryptData(string(iv_bytes))
 	if err != nil {
-		logger.LOGGER.Println("Error while Sending 'Pull' to Workspace Owner:", err)
-		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-		return err
+		logger.LOGGER.Println("Error while Decrypting 'IV':", err)
+		logger.LOGGER.Println("Source: decryptChunkCipher()")
+		return nil, err
 	}
 
-	buffer := make([]byte, DATA_CHUNK)
+	chunk_cipher, err := encrypt.NewChunkCipher([]byte(key), []byte(iv))
+	if err != nil {
+		logger.LOGGER.Println("Error while Creating Chunk Cipher:", err)
+		logger.LOGGER.Println("Source: decryptChunkCipher()")
+		return nil, err
+	}
+	return chunk_cipher, nil
+}
 
-	logger.LOGGER.Println("Len Data Bytes:", res.LenData)
-	offset := 0
+// My KCP Profile with Windows Agreed by Workspace Owner, Unchanged if Owner is Older
+func getAgreedKCPProfile(res models.GetMetaDataResponse) dialer.KCPProfile {
+	return dialer.KCP_PROFILE.WithPeerWindows(res.KCPSendWindow, res.KCPRecvWindow)
+}
 
-	logger.LOGGER.Println("Now Reading Data from Workspace Owner ...")
-	for offset < res.LenData {
-		n, err := kcp_conn.Read(buffer)
-		if err != nil {
-			logger.LOGGER.Println("\nError while Reading from Workspace Owner:", err)
-			logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-			return err
-		}
+// Capabilities Agreed in Hello, less the Data Session Features Sender didn't Offer in 'res'
+func getDataCapabilities(res models.GetMetaDataResponse, capabilities models.Capability) models.Capability {
+	if res.MaxStreams == 0 {
+		capabilities &^= models.CAP_MULTI_STREAM
+	}
+	return capabilities
+}
 
-		// Check for Errors on Workspace Owner's Side
-		if n < 30 {
-			msg := string(buffer[:n])
-			if msg == "Incorrect Workspace Name/Push Num" || msg == "Internal Server Error" {
-				logger.LOGGER.Println("\nError while Reading from Workspace on his/her side:", msg)
-				logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-				return errors.New(msg)
+// Retries fetchData, Resuming each time, till Data Matches 'fetch_req.expected_hash'
+func fetchVerifiedData(fetch_req fetchRequest) error {
+	for attempt := 1; ; attempt++ {
+		err := fetchData(fetch_req)
+		if err == nil {
+			err = verifyZipHash(fetch_req.file_path, fetch_req.expected_hash)
+			if err == nil {
+				return nil
+			}
+			// Corrupt Data mustn't be Resumed from, so Start Over
+			removePartialDownload(fetch_req.file_path)
+			// Fetching Again won't make Sender send the Hash
+			if errors.Is(err, models.ErrMissingDataHash) {
+				return err
 			}
 		}
-
-		// Decrypt Data
-		decrypted_data, err := encrypt.EncryptDecryptChunk(buffer[:n], []byte(key), []byte(iv))
-		if err != nil {
-			logger.LOGGER.Println("Error while Decrypting Chunk:", err)
-			logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		if attempt == MAX_FETCH_ATTEMPTS {
+			logger.LOGGER.Println("Error while Fetching Data, Giving Up:", err)
+			logger.LOGGER.Println("Source: fetchVerifiedData()")
 			return err
 		}
+		logger.LOGGER.Printf("Error while Fetching Data (Attempt %d/%d): %v\n", attempt, MAX_FETCH_ATTEMPTS, err)
+		logger.LOGGER.Println("Will Resume Download after", FETCH_RETRY_WAIT_TIME)
+		time.Sleep(FETCH_RETRY_WAIT_TIME)
+	}
+}
 
-		// Store data in chunks using 'writer'
-		_, err = writer.Write(decrypted_data)
-		if err != nil {
-			logger.LOGGER.Println("Error while Writing Decrypted Data in Chunks:", err)
-			logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-			return err
-		}
+// Local Versions of Files I had Modified're kept, so let me know where
+func notifyConflicts(workspace_name string, push_num int, conflicts []string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	logger.LOGGER.Println("Locally Modified or Deleted Files Overwritten by Pull:", conflicts)
 
-		// Flush buffer to disk after 'FLUSH_AFTER_EVERY_X_MB'
-		if offset%handler.FLUSH_AFTER_EVERY_X_MB == 0 {
-			err = writer.Flush()
-			if err != nil {
-				logger.LOGGER.Println("Error flushing 'writer' buffer:", err)
-				logger.LOGGER.Println("Soure: fetchAndStoreDataIntoWorkspace()")
-				return err
-			}
-		}
+	shown_conflicts := conflicts
+	if len(shown_conflicts) > MAX_CONFLICTS_IN_NOTIFICATION {
+		shown_conflicts = shown_conflicts[:MAX_CONFLICTS_IN_NOTIFICATION]
+	}
+	noti_msg := fmt.Sprintf("Your Changes to %s in Workspace: %s were Overwritten by Pull, Modified Files're kept in .PKr/Conflicts/%d", strings.Join(shown_conflicts, ", "), workspace_name, push_num)
+	if len(conflicts) > len(shown_conflicts) {
+		noti_msg = fmt.Sprintf("Your Changes to %s & %d more Files in Workspace: %s were Overwritten by Pull, Modified Files're kept in .PKr/Conflicts/%d", strings.Join(shown_conflicts, ", "), len(conflicts)-len(shown_conflicts), workspace_name, push_num)
+	}
 
-		offset += n
+	if err := beeep.Notify("Picker", noti_msg, ""); err != nil {
+		logger.LOGGER.Println("Error while Sending Push Notification:", err)
+		logger.LOGGER.Println("Source: notifyConflicts()")
 	}
-	logger.LOGGER.Println("Data Transfer Completed ...")
+}
+
+// Received Files are Verified against 'manifest', see verifyPushManifest()
+func fetchAndStoreDataIntoWorkspace(workspace_owner_ip, username, workspace_name, workspace_owner string, udp_conn *net.UDPConn, res models.GetMetaDataResponse, capabilities models.Capability, manifest *models.PushManifest, journal filetracker.ApplyJournal) error {
+	chunk_cipher, err := decryptChunkCipher(res.EncryptionVersion, res.KeyBytes, res.IVBytes)
+	if err != nil {
+		logger.LOGGER.Println("Error while Decrypting Keys:", err)
+		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		return err
+	}
+
+	workspace_path, err := config.GetGetWorkspaceFilePath(workspace_name)
+	if err != nil {
+		logger.LOGGER.Println("Error while Fetching Workspace Path from Config:", err)
+		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		return err
+	}
+	logger.LOGGER.Println("Workspace Path: ", workspace_path)
 
-	// Flush buffer to disk at end
-	err = writer.Flush()
+	contents_path := filepath.Join(workspace_path, ".PKr", "Contents")
+	err = os.MkdirAll(contents_path, 0700)
 	if err != nil {
-		logger.LOGGER.Println("Error flushing 'writer' buffer:", err)
-		logger.LOGGER.Println("Soure: fetchAndStoreDataIntoWorkspace()")
+		logger.LOGGER.Println("Error while Creating .PKr/Contents Directory:", err)
+		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
 		return err
 	}
-	zip_file_obj.Close()
 
-	_, err = kcp_conn.Write([]byte("Data Received"))
+	// Archive is Requested by its Name, which for Zip is just the Push Range
+	archive_name := config.GetArchiveName(res.RequestPushRange, res.ArchiveFormat)
+	zip_file_path := filepath.Join(contents_path, res.RequestPushRange+".zip")
+	if res.ArchiveFormat != "" && res.ArchiveFormat != config.ARCHIVE_FORMAT_ZIP {
+		zip_file_path = filepath.Join(contents_path, archive_name)
+	}
+	removeStalePartialDownloads(contents_path, filepath.Base(zip_file_path))
+
+	data_req_type := "Pull"
+	if workspace_owner != "" {
+		data_req_type = "Swarm"
+	}
+	err = fetchVerifiedData(fetchRequest{
+		workspace_owner_ip: workspace_owner_ip,
+		username:           username,
+		workspace_name:     workspace_name,
+		workspace_owner:    workspace_owner,
+		data_req_type:      data_req_type,
+		push_range:         archive_name,
+		len_data:           res.LenData,
+		expected_hash:      res.ZipHash,
+		file_path:          zip_file_path,
+		udp_conn:           udp_conn,
+		chunk_cipher:       chunk_cipher,
+		max_streams:        res.MaxStreams,
+		capabilities:       getDataCapabilities(res, capabilities),
+		kcp_profile:        getAgreedKCPProfile(res),
+	})
 	if err != nil {
-		logger.LOGGER.Println("Error while Sending Data Received Message:", err)
+		logger.LOGGER.Println("Error while Fetching Data:", err)
 		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
-		// Not Returning Error because, we got data, we don't care if workspace owner now is offline or not responding
+		return err
 	}
 
-	unzip_dest := filepath.Join(workspace_path, ".PKr", "Contents", res.RequestPushRange)
+	unzip_dest := filepath.Join(contents_path, res.RequestPushRange)
 	err = os.MkdirAll(unzip_dest, 0700)
 	if err != nil {
 		logger.LOGGER.Println("Error while Creating .PKr/Push Num Directory:", err)
@@ -323,19 +507,30 @@ func fetchAndStoreDataIntoWorkspace(workspace_owner_ip, workspace_name string, u
 		return err
 	}
 
-	// Unzip Content
-	if err = filetracker.UnzipData(zip_file_path, unzip_dest); err != nil {
-		logger.LOGGER.Println("Error while Unzipping Data into Workspace:", err)
+	// Extract Content
+	if err = filetracker.ExtractArchive(res.ArchiveFormat, zip_file_path, unzip_dest); err != nil {
+		logger.LOGGER.Println("Error while Extracting Data into Workspace:", err)
+		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		return err
+	}
+
+	if err = verifyFilesAgainstManifest(unzip_dest, res.Updates, manifest); err != nil {
+		logger.LOGGER.Println("Error while Verifying Received Files against Manifest:", err)
 		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		os.Remove(zip_file_path)
+		os.RemoveAll(unzip_dest)
 		return err
 	}
 
-	err = filetracker.UpdateFilesFromWorkspace(workspace_path, unzip_dest, res.Updates)
+	conflicts, err := filetracker.ApplyUpdatesToWorkspace(workspace_path, unzip_dest, journal)
 	if err != nil {
-		logger.LOGGER.Println("Error while Updating Files From Workspace:", err)
+		logger.LOGGER.Println("Error while Applying Updates to Workspace:", err)
 		logger.LOGGER.Println("Source: fetchAndStoreDataIntoWorkspace()")
+		os.Remove(zip_file_path)
+		os.RemoveAll(unzip_dest)
 		return err
 	}
+	notifyConflicts(journal.WorkspaceName, journal.PushNum, conflicts)
 
 	// Remove Zip File After Unzipping it
 	err = os.Remove(zip_file_path)
@@ -355,74 +550,136 @@ func fetchAndStoreDataIntoWorkspace(workspace_owner_ip, workspace_name string, u
 	return nil
 }
 
+// Returned when User couldn't be Connected to
+// Wrapped Error is kept as it is, so Callers can check for models.ErrWorkspaceOwnerIsOffline
+type unreachableUserError struct {
+	err error
+}
+
+func (e unreachableUserError) Error() string {
+	return e.err.Error()
+}
+
+func (e unreachableUserError) Unwrap() error {
+	return e.err
+}
+
 func PullWorkspace(workspace_owner_username, workspace_name string, conn *websocket.Conn) error {
 	logger.LOGGER.Println("Pulling Workspace:", workspace_name)
 	logger.LOGGER.Println("Workspace Owner:", workspace_owner_username)
 
-	client_handler_name, workspace_owner_ip, udp_conn, kcp_conn, err := connectToAnotherUser(workspace_owner_username, conn)
+	err := pullWorkspaceFromUser(workspace_owner_username, workspace_owner_username, workspace_name, conn)
+	var unreachable_err unreachableUserError
+	if !errors.As(err, &unreachable_err) {
+		return err
+	}
+
+	logger.LOGGER.Println("Workspace Owner is Unreachable, Trying to Fetch from other Listeners ...")
+	if peer_err := pullWorkspaceFromPeers(workspace_owner_username, workspace_name, conn); peer_err != nil {
+		logger.LOGGER.Println("Couldn't Fetch Workspace from other Listeners:", peer_err)
+		return err
+	}
+	return nil
+}
+
+// 'username' is either Workspace Owner or another Listener of the Workspace
+func pullWorkspaceFromUser(username, workspace_owner_username, workspace_name string, conn *websocket.Conn) error {
+	is_peer := username != workspace_owner_username
+
+	client_handler_name, user_ip, udp_conn, kcp_conn, err := connectToAnotherUser(username, conn)
 	if err != nil {
 		logger.LOGGER.Println("Error while Connecting to Another User:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
-		return err
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+		return unreachableUserError{err: err}
 	}
 	defer udp_conn.Close()
 	defer kcp_conn.Close()
 
+	if err = authenticateSession(kcp_conn, username); err != nil {
+		logger.LOGGER.Println("Error while Authenticating Session:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+		return err
+	}
+
 	rpc_buff := [3]byte{'R', 'P', 'C'}
 	_, err = kcp_conn.Write(rpc_buff[:])
 	if err != nil {
 		logger.LOGGER.Println("Error while Writing the type of Session(KCP-RPC or KCP-Plain):", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
-	user_conf, err := config.ReadFromUserConfigFile()
+	get_workspace, err := config.GetGetWorkspace(workspace_name, workspace_owner_username)
 	if err != nil {
-		logger.LOGGER.Println("Error while Reading User Config File:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Error while Getting Workspace from User Config:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
-	var workspace_password string
-	var last_push_num int
-	for _, workspace := range user_conf.GetWorkspaces {
-		if workspace.WorkspaceName == workspace_name && workspace.WorkspaceOwnerName == workspace_owner_username {
-			workspace_password = workspace.WorkspacePassword
-			last_push_num = workspace.LastPushNum
-		}
-	}
-
 	// Creating RPC Client
-	rpc_client := rpc.NewClient(kcp_conn)
+	rpc_client := dialer.NewRPCClient(kcp_conn)
 	defer rpc_client.Close()
 	rpcClientHandler := dialer.ClientCallHandler{}
 
-	// Get Public Key of Workspace Owner
-	logger.LOGGER.Println("Fetching Public Key of Workspace Owner from Config")
-	public_key, err := config.GetPublicKeyUsingUsername(workspace_owner_username)
+	// Get Public Key of User
+	logger.LOGGER.Println("Fetching Public Key of User from Config")
+	public_key, err := config.GetPublicKeyUsingUsername(username)
 	if err != nil {
-		logger.LOGGER.Println("Error while Getting Public Key of Workspace Owner:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Error while Getting Public Key of User:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
 	// Encrypting Workspace Password with Public Key
-	encrypted_password, err := encrypt.RSAEncryptData(workspace_password, string(public_key))
+	encrypted_password, err := encrypt.RSAEncryptData(get_workspace.WorkspacePassword, string(public_key))
 	if err != nil {
 		logger.LOGGER.Println("Error while Encrypting Workspace Password via Public Key:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
+	// Access Token is only Sent to Workspace Owner, who Issued it
+	var encrypted_access_token string
+	if !is_peer && get_workspace.AccessToken != "" {
+		encrypted_access_token, err = encrypt.RSAEncryptData(get_workspace.AccessToken, string(public_key))
+		if err != nil {
+			logger.LOGGER.Println("Error while Encrypting Access Token via Public Key:", err)
+			logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+			return err
+		}
+	}
+
+	// Peer doesn't know which Files I've, unlike Workspace Owner
+	var workspace_owner string
+	var file_hashes map[string]string
+	if is_peer {
+		workspace_owner = workspace_owner_username
+		file_hashes, err = getLocalFileHashes(get_workspace.WorkspacePath)
+		if err != nil {
+			logger.LOGGER.Println("Error while Getting Hashes of Local Files:", err)
+			logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+			return err
+		}
+	}
+
+	logger.LOGGER.Println("Calling Hello ...")
+	hello, err := rpcClientHandler.CallHello(MY_USERNAME, client_handler_name, rpc_client)
+	if err != nil {
+		logger.LOGGER.Println("Error while Calling Hello:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+		return err
+	}
+	logger.LOGGER.Printf("Protocol Version: %d, Capabilities: %s\n", hello.ProtocolVersion, hello.Capabilities)
+
 	logger.LOGGER.Println("Calling GetMetaData ...")
 	// Calling GetMetaData
-	res, err := rpcClientHandler.CallGetMetaData(MY_USERNAME, MY_SERVER_IP, workspace_name, encrypted_password, client_handler_name, last_push_num, rpc_client)
+	res, err := rpcClientHandler.CallGetMetaData(MY_USERNAME, MY_SERVER_IP, workspace_name, workspace_owner, encrypted_password, encrypted_access_token, client_handler_name, get_workspace.LastPushNum, file_hashes, hello.Capabilities, rpc_client)
 	if err != nil {
-		if err == handler.ErrUserAlreadyHasLatestWorkspace {
+		if errors.Is(err, handler.ErrUserAlreadyHasLatestWorkspace) {
 			return nil
 		}
 		logger.LOGGER.Println("Error while Calling GetMetaData:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 	logger.LOGGER.Println("Get Data Responded, now storing files into workspace")
@@ -434,27 +691,60 @@ func PullWorkspace(workspace_owner_username, workspace_name string, conn *websoc
 	kcp_conn.Close()
 	rpc_client.Close()
 
-	err = fetchAndStoreDataIntoWorkspace(workspace_owner_ip, workspace_name, udp_conn, *res)
+	if err = validateRemoteName(res.RequestPushRange); err != nil {
+		logger.LOGGER.Println("Invalid Request Push Range Received:", res.RequestPushRange)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+		return err
+	}
+
+	manifest, err := verifyPushManifest(*res, get_workspace, is_peer)
 	if err != nil {
-		logger.LOGGER.Println("Error while Fetching Data & Storing it in Workspace:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Error while Verifying Push Manifest:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
-	// Update user-config.json
-	err = config.UpdateLastPushNumInGetWorkspaceFolderToUserConfig(workspace_name, res.LastPushNum)
+	if is_peer {
+		if err = prepareUpdatesFromPeer(res, manifest, get_workspace, file_hashes); err != nil {
+			logger.LOGGER.Println("Error while Preparing Updates Received from Peer:", err)
+			logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
+			return err
+		}
+	}
+
+	// Files, Manifest & Last Push Num're Stored together, see filetracker.ApplyUpdatesToWorkspace()
+	journal := filetracker.ApplyJournal{
+		WorkspaceName: workspace_name,
+		BasePushNum:   get_workspace.LastPushNum,
+		PushNum:       res.LastPushNum,
+		Changes:       res.Updates,
+		Manifest:      &res.Manifest, // Lets me Serve this Push to other Listeners
+	}
+
+	if res.UsesChunks {
+		err = fetchChunksAndStoreIntoWorkspace(user_ip, username, client_handler_name, workspace_name, encrypted_password, encrypted_access_token, udp_conn, *res, hello.Capabilities, manifest, journal)
+	} else {
+		err = fetchAndStoreDataIntoWorkspace(user_ip, username, workspace_name, workspace_owner, udp_conn, *res, hello.Capabilities, manifest, journal)
+	}
 	if err != nil {
-		logger.LOGGER.Println("Error while Registering New GetWorkspace:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Error while Fetching Data & Storing it in Workspace:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		return err
 	}
 
+	if !is_peer && res.Peers != nil {
+		storePeersOfWorkspace(workspace_owner_username, workspace_name, res.Peers)
+	}
+
 	// Send Notification about new changes're fetched
 	noti_msg := fmt.Sprintf("New Updates of Workspace: %s from User: %s're Fetched!", workspace_name, workspace_owner_username)
+	if is_peer {
+		noti_msg = fmt.Sprintf("New Updates of Workspace: %s from User: %s're Fetched via %s!", workspace_name, workspace_owner_username, username)
+	}
 	err = beeep.Notify("Picker", noti_msg, "")
 	if err != nil {
 		logger.LOGGER.Println("Error while Sending Push Notification:", err)
-		logger.LOGGER.Println("Source: pullWorkspace()")
+		logger.LOGGER.Println("Source: pullWorkspaceFromUser()")
 		// Not Return Error, else it'll pull workspace again after sometime
 	}
 
@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Time Workspace Owner gets to Respond to a RequestPunchFromReceiverRequest via Server
+const PUNCH_RESPONSE_TIMEOUT = 35 * time.Second
+
+type punchResponseWaiter struct {
+	workspace_owner string
+	response_chan   chan models.RequestPunchFromReceiverResponse
+}
+
+// Delivers each RequestPunchFromReceiverResponse to the go routine which Sent its Request
+type punchResponseWaiters struct {
+	mutex    sync.Mutex
+	by_id    map[string]punchResponseWaiter
+	by_owner map[string][]string // Request IDs Waiting on each Workspace Owner, Oldest First
+}
+
+var PUNCH_RESPONSE_WAITERS = newPunchResponseWaiters()
+
+func newPunchResponseWaiters() *punchResponseWaiters {
+	return &punchResponseWaiters{
+		by_id:    map[string]punchResponseWaiter{},
+		by_owner: map[string][]string{},
+	}
+}
+
+func newPunchRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// New Request ID for 'workspace_owner' & Channel its Response is Delivered on, must be Unregistered once Done
+func (w *punchResponseWaiters) register(workspace_owner string) (string, chan models.RequestPunchFromReceiverResponse, error) {
+	request_id, err := newPunchRequestID()
+	if err != nil {
+		return "", nil, err
+	}
+	response_chan := make(chan models.RequestPunchFromReceiverResponse, 1)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.by_id[request_id] = punchResponseWaiter{workspace_owner: workspace_owner, response_chan: response_chan}
+	w.by_owner[workspace_owner] = append(w.by_owner[workspace_owner], request_id)
+	return request_id, response_chan, nil
+}
+
+func (w *punchResponseWaiters) unregister(request_id string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.remove(request_id)
+}
+
+// Caller must Hold Mutex
+func (w *punchResponseWaiters) remove(request_id string) {
+	waiter, ok := w.by_id[request_id]
+	if !ok {
+		return
+	}
+	delete(w.by_id, request_id)
+
+	request_ids := slices.DeleteFunc(w.by_owner[waiter.workspace_owner], func(id string) bool { return id == request_id })
+	if len(request_ids) == 0 {
+		delete(w.by_owner, waiter.workspace_owner)
+	} else {
+		w.by_owner[waiter.workspace_owner] = request_ids
+	}
+}
+
+// Waits for Response to 'request_id' till 'timeout', then it's Unregistered, so a Late Response isn't Delivered
+func (w *punchResponseWaiters) wait(request_id string, response_chan chan models.RequestPunchFromReceiverResponse, timeout time.Duration) (models.RequestPunchFromReceiverResponse, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-response_chan:
+		return res, nil
+	case <-timer.C:
+		w.unregister(request_id)
+		return models.RequestPunchFromReceiverResponse{}, models.ErrWorkspaceOwnerNotResponding
+	}
+}
+
+// Returns false if no one is Waiting for it, i.e., it came after Timeout
+// Responses without Request ID, from an Older Server, go to the Oldest Request to their Workspace Owner
+func (w *punchResponseWaiters) deliver(res models.RequestPunchFromReceiverResponse) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	request_id := res.RequestID
+	if request_id == "" {
+		request_ids := w.by_owner[res.WorkspaceOwnerUsername]
+		if len(request_ids) == 0 {
+			return false
+		}
+		request_id = request_ids[0]
+	}
+
+	waiter, ok := w.by_id[request_id]
+	if !ok {
+		return false
+	}
+	// Only the first Response to a Request is Delivered, Channel has Room for it
+	waiter.response_chan <- res
+	w.remove(request_id)
+	return true
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+func init() {
+	logger.LOGGER = log.New(io.Discard, "", 0)
+}
+
+func registerTestWaiter(t *testing.T, waiters *punchResponseWaiters, workspace_owner string) (string, chan models.RequestPunchFromReceiverResponse) {
+	t.Helper()
+	request_id, response_chan, err := waiters.register(workspace_owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request_id, response_chan
+}
+
+// Nothing must be left behind once every Request is Done
+func checkWaitersEmpty(t *testing.T, waiters *punchResponseWaiters) {
+	t.Helper()
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+	if len(waiters.by_id) != 0 || len(waiters.by_owner) != 0 {
+		t.Fatalf("Waiters left behind, By ID: %v, By Owner: %v", waiters.by_id, waiters.by_owner)
+	}
+}
+
+func TestPunchResponseWaitTimesOut(t *testing.T) {
+	waiters := newPunchResponseWaiters()
+	request_id, response_chan := registerTestWaiter(t, waiters, "owner")
+
+	_, err := waiters.wait(request_id, response_chan, 20*time.Millisecond)
+	if !errors.Is(err, models.ErrWorkspaceOwnerNotResponding) {
+		t.Fatalf("Error is %v, want %v", err, models.ErrWorkspaceOwnerNotResponding)
+	}
+	checkWaitersEmpty(t, waiters)
+
+	// Late Responses're Dropped, with or without Request ID
+	if waiters.deliver(models.RequestPunchFromReceiverResponse{RequestID: request_id, WorkspaceOwnerUsername: "owner"}) {
+		t.Fatal("Late Response was Delivered")
+	}
+	if waiters.deliver(models.RequestPunchFromReceiverResponse{WorkspaceOwnerUsername: "owner"}) {
+		t.Fatal("Late Response without Request ID was Delivered")
+	}
+}
+
+func TestPunchResponseDeliveredByRequestID(t *testing.T) {
+	waiters := newPunchResponseWaiters()
+	first_id, first_chan := registerTestWaiter(t, waiters, "owner")
+	second_id, second_chan := registerTestWaiter(t, waiters, "owner")
+
+	// Response to the Newer Request mustn't go to the Older one of the same Owner
+	if !waiters.deliver(models.RequestPunchFromReceiverResponse{RequestID: second_id, WorkspaceOwnerUsername: "owner"}) {
+		t.Fatal("Response wasn't Delivered")
+	}
+	res, err := waiters.wait(second_id, second_chan, time.Second)
+	if err != nil || res.RequestID != second_id {
+		t.Fatalf("Waiter got Response %q, Error %v, want %q", res.RequestID, err, second_id)
+	}
+	select {
+	case res := <-first_chan:
+		t.Fatalf("Response %q went to Another Request", res.RequestID)
+	default:
+	}
+
+	// Only the First Response to a Request is Delivered
+	if waiters.deliver(models.RequestPunchFromReceiverResponse{RequestID: second_id, WorkspaceOwnerUsername: "owner"}) {
+		t.Fatal("Second Response to the same Request was Delivered")
+	}
+
+	waiters.unregister(first_id)
+	checkWaitersEmpty(t, waiters)
+}
+
+func TestPunchResponseWithoutRequestIDGoesToOldest(t *testing.T) {
+	waiters := newPunchResponseWaiters()
+	first_id, first_chan := registerTestWaiter(t, waiters, "owner")
+	second_id, second_chan := registerTestWaiter(t, waiters, "owner")
+	other_id, _ := registerTestWaiter(t, waiters, "other-owner")
+
+	for _, want := range []struct {
+		request_id    string
+		response_chan chan models.RequestPunchFromReceiverResponse
+	}{{first_id, first_chan}, {second_id, second_chan}} {
+		if !waiters.deliver(models.RequestPunchFromReceiverResponse{WorkspaceOwnerUsername: "owner"}) {
+			t.Fatal("Response without Request ID wasn't Delivered")
+		}
+		if _, err := waiters.wait(want.request_id, want.response_chan, time.Second); err != nil {
+			t.Fatalf("Request %q didn't get the Response: %v", want.request_id, err)
+		}
+	}
+	if waiters.deliver(models.RequestPunchFromReceiverResponse{WorkspaceOwnerUsername: "owner"}) {
+		t.Fatal("Response was Delivered with no Request Waiting")
+	}
+
+	waiters.unregister(other_id)
+	checkWaitersEmpty(t, waiters)
+}
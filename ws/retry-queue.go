@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/handler"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+// Failed Pulls're Retried with Exponential Backoff, unless Failure is Permanent
+// Failures're Stored in utils.GetPullRetriesFilePath(), so Backoff carries on after a Restart
+
+const (
+	PULL_RETRY_MIN_BACKOFF = 1 * time.Minute
+	PULL_RETRY_MAX_BACKOFF = 6 * time.Hour
+)
+
+type PullFailureKind string
+
+const (
+	PULL_FAILURE_TRANSIENT PullFailureKind = "transient" // Retried after Backoff
+	PULL_FAILURE_PERMANENT PullFailureKind = "permanent" // Retried only on a New Push, see PullScheduler.Schedule()
+)
+
+// Errors which won't go away by Trying Again, those from Peers're Mapped back by models.ErrorFromCode()
+var PERMANENT_PULL_ERRORS = []error{
+	handler.ErrIncorrectPassword,
+	handler.ErrNoSuchWorkspaceFound,
+	handler.ErrNotAPeerOfWorkspace,
+	handler.ErrUnsupportedEncryptionVersion,
+	config.ErrInvalidManifest,
+	models.ErrUnknownPeer,
+	models.ErrListenerRevoked,
+	models.ErrInvalidAccessToken,
+	models.ErrMissingDataHash,
+}
+
+type PullRetry struct {
+	WorkspaceOwner string          `json:"workspace_owner"`
+	WorkspaceName  string          `json:"workspace_name"`
+	Kind           PullFailureKind `json:"kind"`
+	Reason         string          `json:"reason"`
+	Attempts       int             `json:"attempts"` // Failures in a Row
+	LastAttempt    time.Time       `json:"last_attempt"`
+	NextAttempt    time.Time       `json:"next_attempt,omitzero"` // Zero if Permanent
+}
+
+type PullRetryQueue struct {
+	mutex     sync.Mutex
+	file_path string
+	retries   map[string]*PullRetry // By Workspace Owner & Name
+}
+
+func getPullKey(workspace_owner, workspace_name string) string {
+	return workspace_owner + "/" + workspace_name
+}
+
+func classifyPullError(err error) PullFailureKind {
+	for _, permanent_err := range PERMANENT_PULL_ERRORS {
+		if errors.Is(err, permanent_err) {
+			return PULL_FAILURE_PERMANENT
+		}
+	}
+	return PULL_FAILURE_TRANSIENT
+}
+
+// Full Jitter between half & full of the Exponential Backoff, same as reconnectBackoff()
+func pullRetryBackoff(attempts int) time.Duration {
+	backoff := PULL_RETRY_MIN_BACKOFF
+	for i := 1; i < attempts && backoff < PULL_RETRY_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, PULL_RETRY_MAX_BACKOFF)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Missing File means there's Nothing to Retry
+func LoadPullRetryQueue(file_path string) (*PullRetryQueue, error) {
+	queue := &PullRetryQueue{file_path: file_path, retries: map[string]*PullRetry{}}
+
+	data, err := os.ReadFile(file_path)
+	if os.IsNotExist(err) {
+		return queue, nil
+	}
+	if err != nil {
+		return queue, err
+	}
+
+	var retries []*PullRetry
+	if err = json.Unmarshal(data, &retries); err != nil {
+		return queue, err
+	}
+	for _, retry := range retries {
+		queue.retries[getPullKey(retry.WorkspaceOwner, retry.WorkspaceName)] = retry
+	}
+	return queue, nil
+}
+
+// Caller must Hold Mutex, File is Replaced only once New one is Complete
+func (q *PullRetryQueue) save() {
+	if q.file_path == "" {
+		return
+	}
+
+	retries := make([]*PullRetry, 0, len(q.retries))
+	for _, retry := range q.retries {
+		retries = append(retries, retry)
+	}
+	slices.SortFunc(retries, func(a, b *PullRetry) int {
+		return a.LastAttempt.Compare(b.LastAttempt)
+	})
+
+	data, err := json.MarshalIndent(retries, "", "	")
+	if err == nil {
+		tmp_path := q.file_path + ".tmp"
+		if err = os.WriteFile(tmp_path, data, 0600); err == nil {
+			err = os.Rename(tmp_path, q.file_path)
+		}
+	}
+	if err != nil {
+		logger.LOGGER.Println("Error while Saving Pull Retries:", err)
+		logger.LOGGER.Println("Source: save()")
+	}
+}
+
+func (q *PullRetryQueue) Get(workspace_owner, workspace_name string) (PullRetry, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	retry, ok := q.retries[getPullKey(workspace_owner, workspace_name)]
+	if !ok {
+		return PullRetry{}, false
+	}
+	return *retry, true
+}
+
+// Transient Failures still to be Retried, i.e., after a Restart
+func (q *PullRetryQueue) Pending() []PullRetry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	pending := []PullRetry{}
+	for _, retry := range q.retries {
+		if retry.Kind == PULL_FAILURE_TRANSIENT {
+			pending = append(pending, *retry)
+		}
+	}
+	return pending
+}
+
+func (q *PullRetryQueue) RecordFailure(workspace_owner, workspace_name string, err error) PullRetry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := getPullKey(workspace_owner, workspace_name)
+	retry, ok := q.retries[key]
+	if !ok {
+		retry = &PullRetry{WorkspaceOwner: workspace_owner, WorkspaceName: workspace_name}
+		q.retries[key] = retry
+	}
+	retry.Kind = classifyPullError(err)
+	retry.Reason = err.Error()
+	retry.Attempts += 1
+	retry.LastAttempt = time.Now()
+	retry.NextAttempt = time.Time{}
+	if retry.Kind == PULL_FAILURE_TRANSIENT {
+		retry.NextAttempt = retry.LastAttempt.Add(pullRetryBackoff(retry.Attempts))
+	}
+
+	q.save()
+	return *retry
+}
+
+func (q *PullRetryQueue) Clear(workspace_owner, workspace_name string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := getPullKey(workspace_owner, workspace_name)
+	if _, ok := q.retries[key]; ok {
+		delete(q.retries, key)
+		q.save()
+	}
+}
@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/models"
+)
+
+func TestPullRetryBackoffBounds(t *testing.T) {
+	tests := []struct {
+		attempts int
+		backoff  time.Duration // Before Jitter
+	}{
+		{0, PULL_RETRY_MIN_BACKOFF},
+		{1, PULL_RETRY_MIN_BACKOFF},
+		{2, 2 * PULL_RETRY_MIN_BACKOFF},
+		{5, 16 * PULL_RETRY_MIN_BACKOFF},
+		{9, 256 * PULL_RETRY_MIN_BACKOFF},
+		{10, PULL_RETRY_MAX_BACKOFF},
+		{1000, PULL_RETRY_MAX_BACKOFF},
+	}
+
+	for _, test := range tests {
+		min_seen, max_seen := test.backoff, time.Duration(0)
+		for range 500 {
+			backoff := pullRetryBackoff(test.attempts)
+			if backoff < test.backoff/2 || backoff > test.backoff {
+				t.Fatalf("Attempts %d: Backoff %v isn't within [%v, %v]", test.attempts, backoff, test.backoff/2, test.backoff)
+			}
+			min_seen, max_seen = min(min_seen, backoff), max(max_seen, backoff)
+		}
+		// Jitter must Spread Retries, not always Pick the same Delay
+		if min_seen == max_seen {
+			t.Fatalf("Attempts %d: Backoff is always %v", test.attempts, min_seen)
+		}
+	}
+}
+
+func TestPullRetryQueueSaveAndLoad(t *testing.T) {
+	file_path := filepath.Join(t.TempDir(), "pull-retries.json")
+
+	queue, err := LoadPullRetryQueue(file_path)
+	if err != nil {
+		t.Fatal("Missing File wasn't taken as an Empty Queue:", err)
+	}
+
+	queue.RecordFailure("owner", "transient", errors.New("connection reset"))
+	transient := queue.RecordFailure("owner", "transient", errors.New("connection reset"))
+	permanent := queue.RecordFailure("owner", "permanent", models.ErrListenerRevoked)
+	if _, err = os.Stat(file_path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("Temp File was left behind:", err)
+	}
+
+	loaded, err := LoadPullRetryQueue(file_path)
+	if err != nil {
+		t.Fatal("Error while Loading Saved Queue:", err)
+	}
+	for _, want := range []PullRetry{transient, permanent} {
+		got, ok := loaded.Get(want.WorkspaceOwner, want.WorkspaceName)
+		if !ok {
+			t.Fatalf("Retry of %s wasn't Loaded", want.WorkspaceName)
+		}
+		if got.Kind != want.Kind || got.Reason != want.Reason || got.Attempts != want.Attempts ||
+			!got.LastAttempt.Equal(want.LastAttempt) || !got.NextAttempt.Equal(want.NextAttempt) {
+			t.Fatalf("Loaded Retry is %+v, want %+v", got, want)
+		}
+	}
+	if pending := loaded.Pending(); len(pending) != 1 || pending[0].WorkspaceName != "transient" {
+		t.Fatalf("Pending Retries're %+v, want only the Transient one", pending)
+	}
+
+	loaded.Clear("owner", "transient")
+	reloaded, err := LoadPullRetryQueue(file_path)
+	if err != nil {
+		t.Fatal("Error while Loading Saved Queue:", err)
+	}
+	if _, ok := reloaded.Get("owner", "transient"); ok {
+		t.Fatal("Cleared Retry was Loaded again")
+	}
+	if _, ok := reloaded.Get("owner", "permanent"); !ok {
+		t.Fatal("Retry which wasn't Cleared is Missing")
+	}
+}
+
+// A Save that can't Finish must leave the Last Complete File as it is
+func TestPullRetryQueueFailedSaveKeepsFile(t *testing.T) {
+	file_path := filepath.Join(t.TempDir(), "pull-retries.json")
+	queue, err := LoadPullRetryQueue(file_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.RecordFailure("owner", "workspace", errors.New("connection reset"))
+	saved, err := os.ReadFile(file_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Temp File can't be Written while a Dir is in its Place
+	if err = os.Mkdir(file_path+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+	queue.RecordFailure("owner", "workspace", errors.New("connection reset"))
+
+	current, err := os.ReadFile(file_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != string(saved) {
+		t.Fatal("File was Changed by a Save that Failed")
+	}
+}
+
+func TestLoadPullRetryQueueRejectsCorruptFile(t *testing.T) {
+	file_path := filepath.Join(t.TempDir(), "pull-retries.json")
+	if err := os.WriteFile(file_path, []byte(`[{"workspace_owner": "owner"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPullRetryQueue(file_path); err == nil {
+		t.Fatal("Corrupt File was Loaded")
+	}
+}
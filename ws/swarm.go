@@ -0,0 +1,233 @@
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"path/filepath"
+
+	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/filetracker"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/gorilla/websocket"
+)
+
+var ErrNoPeersOfWorkspace = errors.New("no other listeners of workspace are known")
+
+// Without it Files Removed since my Push can't be told, so only Workspace Owner can Update me
+var ErrNoManifestOfCurrentPush = errors.New("manifest of current push isn't present, workspace can only be pulled from its owner")
+
+// Tries other Listeners of the Workspace in Random Order, so Load is Spread among them
+func pullWorkspaceFromPeers(workspace_owner_username, workspace_name string, conn *websocket.Conn) error {
+	get_workspace, err := config.GetGetWorkspace(workspace_name, workspace_owner_username)
+	if err != nil {
+		logger.LOGGER.Println("Error while Getting Workspace from User Config:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromPeers()")
+		return err
+	}
+
+	if _, err = readManifestOfCurrentPush(get_workspace); err != nil {
+		logger.LOGGER.Println("Error while Reading Manifest of Current Push:", err)
+		logger.LOGGER.Println("Source: pullWorkspaceFromPeers()")
+		return err
+	}
+
+	err = ErrNoPeersOfWorkspace
+	for _, idx := range rand.Perm(len(get_workspace.Peers)) {
+		peer := get_workspace.Peers[idx]
+		if peer == MY_USERNAME || peer == workspace_owner_username {
+			continue
+		}
+
+		logger.LOGGER.Println("Trying to Fetch Workspace from Peer:", peer)
+		err = pullWorkspaceFromUser(peer, workspace_owner_username, workspace_name, conn)
+		if err == nil {
+			return nil
+		}
+		logger.LOGGER.Println("Couldn't Fetch Workspace from Peer:", err)
+	}
+	return err
+}
+
+func getLocalFileHashes(workspace_path string) (map[string]string, error) {
+	file_tree, err := config.GetNewTree(workspace_path)
+	if err != nil {
+		return nil, err
+	}
+
+	file_hashes := map[string]string{}
+	for _, node := range file_tree.Nodes {
+		if node.FilePath != "" {
+			file_hashes[node.FilePath] = node.Hash
+		}
+	}
+	return file_hashes, nil
+}
+
+// Manifest is a must, whether Data comes from Workspace Owner or a Peer
+func verifyPushManifest(res models.GetMetaDataResponse, get_workspace config.GetWorkspaceFolder, is_peer bool) (*models.PushManifest, error) {
+	if res.Manifest.Signature == "" {
+		return nil, config.ErrInvalidManifest
+	}
+
+	manifest, err := config.VerifySignedPushManifest(res.Manifest, get_workspace.WorkspaceName, get_workspace.WorkspaceOwnerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.PushNum != res.LastPushNum || manifest.PushDesc != res.LastPushDesc {
+		logger.LOGGER.Println("Push Num or Desc of Manifest doesn't Match:", manifest.PushNum, res.LastPushNum)
+		return nil, config.ErrInvalidManifest
+	}
+
+	// Nobody must be able to Roll Back my Workspace to an older Push
+	if manifest.PushNum <= get_workspace.LastPushNum {
+		logger.LOGGER.Println("Manifest is of an older Push:", manifest.PushNum)
+		return nil, config.ErrInvalidManifest
+	}
+
+	// Clone from Owner Receives the Zip of the Push as it is, Older Manifests don't have its Hash
+	is_clone := !is_peer && res.Updates == nil && !res.UsesChunks
+	if is_clone && res.ArchiveFormat == "" && manifest.ArchiveHash != "" && manifest.ArchiveHash != res.ZipHash {
+		logger.LOGGER.Println("Hash of Zip doesn't Match Manifest")
+		return nil, config.ErrInvalidManifest
+	}
+	return &manifest, nil
+}
+
+// Manifest of the Push my Workspace is at, Nil if I haven't Cloned it yet
+// Pulls from Older Workspace Owners don't Store one, Stored one is of an older Push then
+func readManifestOfCurrentPush(get_workspace config.GetWorkspaceFolder) (*models.PushManifest, error) {
+	if get_workspace.LastPushNum == -1 {
+		return nil, nil
+	}
+
+	signed_manifest, err := config.ReadManifestFile(get_workspace.WorkspacePath)
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading Manifest File:", err)
+		logger.LOGGER.Println("Source: readManifestOfCurrentPush()")
+		return nil, ErrNoManifestOfCurrentPush
+	}
+
+	manifest, err := config.VerifySignedPushManifest(signed_manifest, get_workspace.WorkspaceName, get_workspace.WorkspaceOwnerName)
+	if err != nil || manifest.PushNum != get_workspace.LastPushNum {
+		logger.LOGGER.Println("Manifest File is Invalid or Outdated:", err)
+		logger.LOGGER.Println("Source: readManifestOfCurrentPush()")
+		return nil, ErrNoManifestOfCurrentPush
+	}
+	return &manifest, nil
+}
+
+// Updates sent by Peer aren't Trusted, so they're Rebuilt from Manifest
+// Removed Files are the ones in Manifest of my Current Push but not in the New one
+func prepareUpdatesFromPeer(res *models.GetMetaDataResponse, manifest *models.PushManifest, get_workspace config.GetWorkspaceFolder, file_hashes map[string]string) error {
+	updates := map[string]string{}
+	manifest_files := map[string]bool{}
+	for _, file := range manifest.Files {
+		manifest_files[file.FilePath] = true
+		if file_hashes[file.FilePath] == file.Hash {
+			continue
+		}
+		if res.Updates[file.FilePath] != "Updated" {
+			logger.LOGGER.Println("Peer didn't send Changed File:", file.FilePath)
+			return ErrIntegrityCheckFailed
+		}
+		updates[file.FilePath] = "Updated"
+	}
+
+	prev_manifest, err := readManifestOfCurrentPush(get_workspace)
+	if err != nil {
+		return err
+	}
+	if prev_manifest != nil {
+		for _, file := range prev_manifest.Files {
+			if !manifest_files[file.FilePath] {
+				updates[file.FilePath] = "Removed"
+			}
+		}
+	}
+
+	res.Updates = updates
+	return nil
+}
+
+// Every File of Manifest is Verified after a Clone, as 'updates' is Empty then
+func verifyFilesAgainstManifest(unzip_dest string, updates map[string]string, manifest *models.PushManifest) error {
+	manifest_hashes := map[string]string{}
+	for _, file := range manifest.Files {
+		manifest_hashes[file.FilePath] = file.Hash
+	}
+	if updates == nil {
+		updates = map[string]string{}
+		for file_path := range manifest_hashes {
+			updates[file_path] = "Updated"
+		}
+	}
+
+	for file_path, change_type := range updates {
+		// Removing a File Manifest still has would Delete it from my Workspace without Owner saying so
+		if change_type == "Removed" {
+			if _, ok := manifest_hashes[file_path]; ok {
+				logger.LOGGER.Println("Removed File is still in Manifest:", file_path)
+				logger.LOGGER.Println("Source: verifyFilesAgainstManifest()")
+				return ErrIntegrityCheckFailed
+			}
+			continue
+		}
+		if change_type != "Updated" {
+			continue
+		}
+
+		received_file, err := filetracker.SafeJoin(unzip_dest, file_path)
+		if err != nil {
+			logger.LOGGER.Println("Unsafe File Path in Manifest:", file_path)
+			logger.LOGGER.Println("Source: verifyFilesAgainstManifest()")
+			return err
+		}
+
+		hash, err := encrypt.GenerateHashFromFileNames_BufferedAndPooled(received_file)
+		if err != nil {
+			logger.LOGGER.Println("Error while Generating Hash of Received File:", err)
+			logger.LOGGER.Println("Source: verifyFilesAgainstManifest()")
+			return err
+		}
+
+		if hash != manifest_hashes[file_path] {
+			logger.LOGGER.Println("Received File doesn't Match Manifest:", file_path)
+			logger.LOGGER.Println("Source: verifyFilesAgainstManifest()")
+			return ErrIntegrityCheckFailed
+		}
+	}
+	logger.LOGGER.Println("Received Files Verified against Push Manifest")
+	return nil
+}
+
+// Keys of Peers come from Workspace Owner, an existing Key is never Replaced by them
+func storePeersOfWorkspace(workspace_owner_username, workspace_name string, peers []models.PeerInfo) {
+	peer_usernames := []string{}
+	for _, peer := range peers {
+		if peer.Username == MY_USERNAME || peer.Username == workspace_owner_username || filepath.Base(peer.Username) != peer.Username {
+			continue
+		}
+
+		public_key, err := config.GetPublicKeyUsingUsername(peer.Username)
+		if err != nil {
+			if err = config.StorePublicKeyOfOtherUser(peer.Username, peer.PublicKey); err != nil {
+				logger.LOGGER.Println("Error while Storing Public Key of Peer:", err)
+				logger.LOGGER.Println("Source: storePeersOfWorkspace()")
+				continue
+			}
+		} else if !bytes.Equal(public_key, peer.PublicKey) {
+			logger.LOGGER.Println("Public Key of Peer doesn't Match the Stored one, Skipping Peer:", peer.Username)
+			continue
+		}
+		peer_usernames = append(peer_usernames, peer.Username)
+	}
+
+	if err := config.UpdatePeersOfGetWorkspace(workspace_name, workspace_owner_username, peer_usernames); err != nil {
+		logger.LOGGER.Println("Error while Updating Peers of Workspace:", err)
+		logger.LOGGER.Println("Source: storePeersOfWorkspace()")
+	}
+}
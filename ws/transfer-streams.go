@@ -0,0 +1,339 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PKr-Parivar/PKr-Base/dialer"
+	"github.com/PKr-Parivar/PKr-Base/encrypt"
+	"github.com/PKr-Parivar/PKr-Base/framing"
+	"github.com/PKr-Parivar/PKr-Base/logger"
+	"github.com/PKr-Parivar/PKr-Base/models"
+	"github.com/PKr-Parivar/kcp-go"
+)
+
+// Large Files're Fetched as Ranges of Sealed Chunks over Parallel KCP Sessions,
+// all sharing the Punched UDP Socket, see dialer.KCPMux
+const (
+	DEFAULT_TRANSFER_STREAMS = 4
+	PROGRESS_SAVE_INTERVAL   = 2 * time.Second
+)
+
+// Num of Parallel Sessions used per File, Capped by what Sender Allows
+var TRANSFER_STREAMS = DEFAULT_TRANSFER_STREAMS
+
+// Chunks [Start, End) of Sealed File, 'Next' is the first Chunk not yet Written
+type transferRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Next  int64 `json:"next"`
+}
+
+// Stored beside Partial File, so every Range Resumes from where it Stopped
+// Chunks before first Range's Start're already Present
+type transferProgress struct {
+	LenData int             `json:"len_data"`
+	Ranges  []transferRange `json:"ranges"`
+
+	mutex sync.Mutex
+}
+
+func getProgressPath(file_path string) string {
+	return file_path + ".progress"
+}
+
+// Splits Chunks [start_index, num_chunks) into at most 'num_streams' Ranges
+func newTransferProgress(len_data int, start_index, num_chunks int64, num_streams int) *transferProgress {
+	progress := &transferProgress{LenData: len_data}
+	remaining := num_chunks - start_index
+	num_streams = int(max(1, min(int64(num_streams), remaining)))
+
+	range_size := (remaining + int64(num_streams) - 1) / int64(num_streams)
+	for start := start_index; start < num_chunks || len(progress.Ranges) == 0; start += range_size {
+		end := min(start+range_size, num_chunks)
+		progress.Ranges = append(progress.Ranges, transferRange{Start: start, End: end, Next: start})
+	}
+	return progress
+}
+
+// Progress of an Earlier Attempt, only if it's of the same Data
+func readTransferProgress(file_path string, len_data int, num_chunks int64) (*transferProgress, bool) {
+	data, err := os.ReadFile(getProgressPath(file_path))
+	if err != nil {
+		return nil, false
+	}
+
+	var progress transferProgress
+	if err = json.Unmarshal(data, &progress); err != nil || progress.LenData != len_data || len(progress.Ranges) == 0 {
+		return nil, false
+	}
+	for i, r := range progress.Ranges {
+		if r.Start < 0 || r.Start > r.Next || r.Next > r.End {
+			return nil, false
+		}
+		if i > 0 && progress.Ranges[i-1].End != r.Start {
+			return nil, false
+		}
+	}
+	if progress.Ranges[len(progress.Ranges)-1].End != num_chunks {
+		return nil, false
+	}
+	return &progress, true
+}
+
+// Progress is Taken before 'file' is Synced, so it never Claims Chunks which aren't on Disk yet after a Crash
+func (p *transferProgress) save(file_path string, file *os.File) error {
+	p.mutex.Lock()
+	data, err := json.Marshal(p)
+	p.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	return os.WriteFile(getProgressPath(file_path), data, 0600)
+}
+
+func (p *transferProgress) setNext(range_index int, next int64) {
+	p.mutex.Lock()
+	p.Ranges[range_index].Next = next
+	p.mutex.Unlock()
+}
+
+// Num of Chunks from Start of File which're all Present
+func (p *transferProgress) contiguousChunks() int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	contiguous := p.Ranges[0].Start
+	for _, r := range p.Ranges {
+		contiguous = r.Next
+		if r.Next < r.End {
+			break
+		}
+	}
+	return contiguous
+}
+
+func (p *transferProgress) logProgress() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, r := range p.Ranges {
+		logger.LOGGER.Printf("Stream %d: %d/%d Chunks\n", i, r.Next-r.Start, r.End-r.Start)
+	}
+}
+
+func removePartialDownload(file_path string) {
+	if err := os.Remove(file_path); err != nil && !os.IsNotExist(err) {
+		logger.LOGGER.Println("Error while Removing Partial Download:", err)
+		logger.LOGGER.Println("Source: removePartialDownload()")
+	}
+	if err := os.Remove(getProgressPath(file_path)); err != nil && !os.IsNotExist(err) {
+		logger.LOGGER.Println("Error while Removing Progress of Partial Download:", err)
+		logger.LOGGER.Println("Source: removePartialDownload()")
+	}
+}
+
+// Sends Data Request to Sender, & Returns a func which Returns each Piece of Data Received
+func sendDataRequest(kcp_conn *kcp.UDPSession, req models.DataRequest) (func() ([]byte, error), error) {
+	if _, err := kcp_conn.Write([]byte(framing.SESSION_TAG)); err != nil {
+		return nil, err
+	}
+	if err := framing.WriteJSONFrame(kcp_conn, framing.FRAME_HEADER, req); err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) {
+		frame, err := framing.ReadFrame(kcp_conn)
+		if err != nil {
+			return nil, err
+		}
+		switch frame.Type {
+		case framing.FRAME_DATA:
+			return frame.Payload, nil
+		case framing.FRAME_ERROR:
+			return nil, frame.Err()
+		}
+		return nil, fmt.Errorf("%w: %s", framing.ErrUnexpectedFrame, frame.Type)
+	}, nil
+}
+
+// Fetches Chunks of one Range over its own Session & Writes them at their Offsets in 'file'
+// Older Senders don't understand Ranges, they get just the Resume Offset & Send till End
+func fetchRange(mux *dialer.KCPMux, fetch_req fetchRequest, progress *transferProgress, range_index int, file *os.File, num_chunks, last_chunk_size int64) error {
+	chunk_cipher := fetch_req.chunk_cipher
+	progress.mutex.Lock()
+	data_range := progress.Ranges[range_index]
+	progress.mutex.Unlock()
+
+	kcp_conn, err := mux.Dial(fetch_req.workspace_owner_ip, fetch_req.kcp_profile)
+	if err != nil {
+		logger.LOGGER.Println("Error while Dialing Workspace Owner to Get Data:", err)
+		logger.LOGGER.Println("Source: fetchRange()")
+		return err
+	}
+	defer kcp_conn.Close()
+
+	if err = authenticateSession(kcp_conn, fetch_req.username); err != nil {
+		logger.LOGGER.Println("Error while Authenticating Session:", err)
+		logger.LOGGER.Println("Source: fetchRange()")
+		return err
+	}
+
+	resume_offset := strconv.FormatInt(data_range.Next*encrypt.AEAD_CHUNK, 10)
+	if fetch_req.useRanges() {
+		resume_offset += "-" + strconv.FormatInt(data_range.End*encrypt.AEAD_CHUNK, 10)
+	}
+
+	req := models.DataRequest{
+		WorkspaceName: fetch_req.workspace_name,
+		PushRange:     fetch_req.push_range,
+		Type:          fetch_req.data_req_type,
+		DataRange:     resume_offset,
+	}
+	if fetch_req.data_req_type == "Swarm" {
+		req.WorkspaceOwner = fetch_req.workspace_owner
+	}
+	read_data, err := sendDataRequest(kcp_conn, req)
+	if err != nil {
+		logger.LOGGER.Println("Error while Sending Data Request to Workspace Owner:", err)
+		logger.LOGGER.Println("Source: fetchRange()")
+		return err
+	}
+	logger.LOGGER.Printf("Stream %d: Fetching Chunks %d to %d\n", range_index, data_range.Next, data_range.End)
+
+	pending := []byte{}
+	is_header_verified := false
+	index := data_range.Next
+	last_progress_sent := time.Now()
+
+	for index < data_range.End || !is_header_verified {
+		data, err := read_data()
+		if err != nil {
+			logger.LOGGER.Println("Error while Reading from Workspace Owner:", err)
+			logger.LOGGER.Println("Source: fetchRange()")
+			return err
+		}
+		pending = append(pending, data...)
+
+		if !is_header_verified {
+			if len(pending) < encrypt.AEAD_HEADER_SIZE {
+				continue
+			}
+			if err = chunk_cipher.VerifyHeader(pending[:encrypt.AEAD_HEADER_SIZE]); err != nil {
+				logger.LOGGER.Println("Error while Verifying Encryption Header:", err)
+				logger.LOGGER.Println("Source: fetchRange()")
+				return err
+			}
+			pending = pending[encrypt.AEAD_HEADER_SIZE:]
+			is_header_verified = true
+		}
+
+		// Decrypt every Complete Sealed Chunk Received so far
+		for index < data_range.End {
+			is_final := index == num_chunks-1
+			sealed_size := int64(encrypt.AEAD_SEALED_CHUNK)
+			if is_final {
+				sealed_size = last_chunk_size
+			}
+			if int64(len(pending)) < sealed_size {
+				break
+			}
+
+			decrypted_data, err := chunk_cipher.OpenChunk(uint32(index), pending[:sealed_size], is_final)
+			if err != nil {
+				logger.LOGGER.Println("Error while Decrypting Chunk:", err)
+				logger.LOGGER.Println("Source: fetchRange()")
+				return err
+			}
+
+			if _, err = file.WriteAt(decrypted_data, index*encrypt.AEAD_CHUNK); err != nil {
+				logger.LOGGER.Println("Error while Writing Decrypted Chunk:", err)
+				logger.LOGGER.Println("Source: fetchRange()")
+				return err
+			}
+
+			pending = pending[sealed_size:]
+			index += 1
+			progress.setNext(range_index, index)
+		}
+
+		if time.Since(last_progress_sent) >= PROGRESS_SAVE_INTERVAL {
+			last_progress_sent = time.Now()
+			err = framing.WriteJSONFrame(kcp_conn, framing.FRAME_PROGRESS, models.DataProgress{NextChunk: index, EndChunk: data_range.End})
+			if err != nil {
+				logger.LOGGER.Println("Error while Sending Progress to Workspace Owner:", err)
+				logger.LOGGER.Println("Source: fetchRange()")
+				return err
+			}
+		}
+	}
+
+	if err = framing.WriteFrame(kcp_conn, framing.FRAME_ACK, nil); err != nil {
+		logger.LOGGER.Println("Error while Sending Data Received Message:", err)
+		logger.LOGGER.Println("Source: fetchRange()")
+		// Not Returning Error because, we got data, we don't care if workspace owner now is offline or not responding
+	}
+	return nil
+}
+
+// Fetches every Incomplete Range in Parallel, Saving Progress as it goes
+// Ranges keep going if one Fails, so the next Attempt has less to Fetch
+func fetchRanges(fetch_req fetchRequest, progress *transferProgress, file *os.File, num_chunks, last_chunk_size int64) error {
+	file_path := fetch_req.file_path
+	mux := dialer.NewKCPMux(fetch_req.udp_conn)
+	defer func() {
+		if err := mux.Close(); err != nil {
+			logger.LOGGER.Println("Error while Closing KCP Mux:", err)
+			logger.LOGGER.Println("Source: fetchRanges()")
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(PROGRESS_SAVE_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				progress.logProgress()
+				if err := progress.save(file_path, file); err != nil {
+					logger.LOGGER.Println("Error while Saving Transfer Progress:", err)
+					logger.LOGGER.Println("Source: fetchRanges()")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	errs := make([]error, len(progress.Ranges))
+	var wg sync.WaitGroup
+	for i, r := range progress.Ranges {
+		if r.Next >= r.End {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fetchRange(mux, fetch_req, progress, i, file, num_chunks, last_chunk_size)
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	if err := progress.save(file_path, file); err != nil {
+		logger.LOGGER.Println("Error while Saving Transfer Progress:", err)
+		logger.LOGGER.Println("Source: fetchRanges()")
+	}
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("stream %d: %w", i, err)
+		}
+	}
+	return nil
+}
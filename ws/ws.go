@@ -5,9 +5,11 @@ import (
 	"time"
 
 	"github.com/PKr-Parivar/PKr-Base/config"
+	"github.com/PKr-Parivar/PKr-Base/dialer"
 	"github.com/PKr-Parivar/PKr-Base/handler"
 	"github.com/PKr-Parivar/PKr-Base/logger"
 	"github.com/PKr-Parivar/PKr-Base/models"
+	pb "github.com/PKr-Parivar/PKr-Base/pb"
 
 	"github.com/gorilla/websocket"
 )
@@ -17,8 +19,6 @@ const (
 	PING_WAIT_TIME = (PONG_WAIT_TIME * 9) / 10
 )
 
-var RequestPunchFromReceiverResponseMap = models.RequestPunchFromReceiverResponseMap{Map: map[string]models.RequestPunchFromReceiverResponse{}}
-
 func handleNotifyToPunchRequest(conn *websocket.Conn, msg models.WSMessage) {
 	msg_bytes, err := json.Marshal(msg.Message)
 	if err != nil {
@@ -33,7 +33,7 @@ func handleNotifyToPunchRequest(conn *websocket.Conn, msg models.WSMessage) {
 		return
 	}
 
-	my_public_ip, my_public_port, my_private_ip, my_private_port, err := handler.HandleNotifyToPunchRequest(noti_to_punch_req.ListenerPublicIp, noti_to_punch_req.ListenerPublicPort, noti_to_punch_req.ListenerPrivateIp, noti_to_punch_req.ListenerPrivatePort)
+	my_public_ip, my_public_port, my_private_ip, my_private_port, err := handler.HandleNotifyToPunchRequest(noti_to_punch_req.ListenerUsername, noti_to_punch_req.ListenerPublicIp, noti_to_punch_req.ListenerPublicPort, noti_to_punch_req.ListenerPrivateIp, noti_to_punch_req.ListenerPrivatePort)
 	if err != nil {
 		logger.LOGGER.Println("Error while Handling NotifyToPunch:", err)
 		logger.LOGGER.Println("Source: handleNotifyToPunchRequest()")
@@ -41,6 +41,7 @@ func handleNotifyToPunchRequest(conn *websocket.Conn, msg models.WSMessage) {
 	}
 
 	noti_to_punch_res := models.NotifyToPunchResponse{
+		RequestID:                 noti_to_punch_req.RequestID,
 		WorkspaceOwnerPublicIp:    my_public_ip,
 		WorkspaceOwnerPublicPort:  my_public_port,
 		ListenerUsername:          noti_to_punch_req.ListenerUsername,
@@ -75,28 +76,7 @@ func handleNotifyNewPushToListeners(msg models.WSMessage, conn *websocket.Conn)
 		return
 	}
 
-	err = PullWorkspace(noti_new_push.WorkspaceOwnerUsername, noti_new_push.WorkspaceName, conn)
-	if err != nil {
-		if err.Error() == "workspace owner is offline" {
-			logger.LOGGER.Println("Workspace Owner is Offline, Server'll notify when he's online")
-			return
-		}
-		if err.Error() == "you already've latest version of workspace" {
-			logger.LOGGER.Println("You've Lastest Version of Workspace, No Need to Transfer Data")
-			return
-		}
-		logger.LOGGER.Println("Error while Pulling Data:", err)
-		logger.LOGGER.Println("Source: handleNotifyNewPushToListeners()")
-
-		// Try Again only once after 5 minutes
-		logger.LOGGER.Println("Will Try Again after 5 minutes")
-		time.Sleep(5 * time.Minute)
-		err = PullWorkspace(noti_new_push.WorkspaceOwnerUsername, noti_new_push.WorkspaceName, conn)
-		if err != nil {
-			logger.LOGGER.Println("Error while Pulling Data Again:", err)
-			logger.LOGGER.Println("Source: handleNotifyNewPushToListeners()")
-		}
-	}
+	PULL_SCHEDULER.Schedule(noti_new_push.WorkspaceOwnerUsername, noti_new_push.WorkspaceName, conn, PULL_TRIGGER_NEW_PUSH)
 }
 
 func handleRequestPunchFromReceiverResponse(msg models.WSMessage) {
@@ -112,9 +92,9 @@ func handleRequestPunchFromReceiverResponse(msg models.WSMessage) {
 		logger.LOGGER.Println("Source: handleNotifyToPunchResponse()")
 		return
 	}
-	RequestPunchFromReceiverResponseMap.Lock()
-	RequestPunchFromReceiverResponseMap.Map[msg_obj.WorkspaceOwnerUsername] = msg_obj
-	RequestPunchFromReceiverResponseMap.Unlock()
+	if !PUNCH_RESPONSE_WAITERS.deliver(msg_obj) {
+		logger.LOGGER.Printf("No one is Waiting for Punch Response of Workspace Owner: %s (Request ID: %q)\n", msg_obj.WorkspaceOwnerUsername, msg_obj.RequestID)
+	}
 }
 
 func handleWorkspaceOwnerIsOnline(msg models.WSMessage, conn *websocket.Conn) {
@@ -141,11 +121,7 @@ func handleWorkspaceOwnerIsOnline(msg models.WSMessage, conn *websocket.Conn) {
 
 	for _, workspace := range user_conf.GetWorkspaces {
 		if workspace.WorkspaceOwnerName == msg_obj.WorkspaceOwnerName {
-			err := PullWorkspace(msg_obj.WorkspaceOwnerName, workspace.WorkspaceName, conn)
-			if err != nil {
-				logger.LOGGER.Println("Error while Pulling Data:", err)
-				logger.LOGGER.Println("Source: handleWorkspaceOwnerIsOnline()")
-			}
+			PULL_SCHEDULER.Schedule(msg_obj.WorkspaceOwnerName, workspace.WorkspaceName, conn, PULL_TRIGGER_OWNER_ONLINE)
 		}
 	}
 }
@@ -187,15 +163,49 @@ func ReadJSONMessage(done chan struct{}, conn *websocket.Conn) {
 	}
 }
 
+// Closing 'conn' on Ping Failure makes ReadJSONMessage return, which closes 'done'
 func PingPongWriter(done chan struct{}, conn *websocket.Conn) {
-	defer close(done)
-
 	ticker := time.NewTicker(PING_WAIT_TIME)
+	defer ticker.Stop()
 	for {
-		<-ticker.C
-		if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-			logger.LOGGER.Println("No response of Ping from Server")
+		select {
+		case <-done:
 			return
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				logger.LOGGER.Println("No response of Ping from Server")
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Runs on every (Re)Connect, so updates pushed while we were offline are fetched
+func CheckForNewChanges(grpc_client pb.CliServiceClient, conn *websocket.Conn) {
+	logger.LOGGER.Println("Checking for New Changes")
+
+	user_conf, err := config.ReadFromUserConfigFile()
+	if err != nil {
+		logger.LOGGER.Println("Error while Reading User Config File:", err)
+		logger.LOGGER.Println("Source: CheckForNewChanges()")
+		return
+	}
+
+	for _, get_workspace := range user_conf.GetWorkspaces {
+		logger.LOGGER.Println("GET Workspace: ")
+		logger.LOGGER.Println(get_workspace)
+		are_there_new_changes, err := dialer.CheckForNewChanges(grpc_client, get_workspace.WorkspaceName, get_workspace.WorkspaceOwnerName, user_conf.Username, user_conf.Password, get_workspace.LastPushNum)
+		if err != nil {
+			logger.LOGGER.Println("Error while Checking For New Changes:", err)
+			logger.LOGGER.Println("Source: CheckForNewChanges()")
+			continue
+		}
+		logger.LOGGER.Println("Are there new changes:", are_there_new_changes)
+
+		if are_there_new_changes {
+			PULL_SCHEDULER.Schedule(get_workspace.WorkspaceOwnerName, get_workspace.WorkspaceName, conn, PULL_TRIGGER_RECONNECT)
 		}
 	}
+	logger.LOGGER.Println("Done with Checking for New Changes ...")
 }